@@ -0,0 +1,95 @@
+package muxedsocket
+
+import (
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"strings"
+)
+
+// Alias is a named scheme, like "wss" standing for "tls+ws+tls+tcp". Scheme may contain other aliases. Parameters are
+// defaults for the layers of Scheme, indexed within it (so "tls[0].sni" is the bottom-most tls of Scheme), and are
+// overridden by parameters given in URI.
+type Alias struct {
+	Scheme     string
+	Parameters utils.Parameters
+}
+
+// getAddrSolution looks scheme up among addr solutions, unless it is an alias.
+func getAddrSolution(creators *Creators, scheme string) (types.AddrSolutionImplementation, bool) {
+	if _, isAlias := creators.Aliases().Get(scheme); isAlias {
+		return nil, false
+	}
+	solution, found := creators.AddrSolutions().Get(scheme)
+	return solution, found && solution != nil
+}
+
+// ExpandSchemeParts replaces aliases among scheme parts with the parts they stand for, recursively. Returned
+// parameters are defaults collected from the aliases, re-indexed to match the expanded parts.
+func ExpandSchemeParts(creators *Creators, schemeParts []string) ([]string, utils.Parameters, error) {
+	return expandSchemeParts(creators, schemeParts, nil)
+}
+
+// GetSchemePartsWithRegistry is like GetSchemeParts, but expands aliases registered in creators.
+func GetSchemePartsWithRegistry(creators *Creators, scheme string) ([]string, utils.Parameters, error) {
+	return ExpandSchemeParts(creators, GetSchemeParts(scheme))
+}
+
+func expandSchemeParts(creators *Creators, schemeParts []string, expanding []string) ([]string, utils.Parameters, error) {
+	expandedParts := make([][]string, len(schemeParts))
+	expandedParams := make([]utils.Parameters, len(schemeParts))
+	for i, part := range schemeParts {
+		alias, found := creators.Aliases().Get(part)
+		if !found {
+			expandedParts[i] = []string{part}
+			continue
+		}
+		for j, name := range expanding {
+			if name == part {
+				return nil, nil, ErrAliasCycle(append(append([]string{}, expanding[j:]...), part))
+			}
+		}
+		parts, params, err := expandSchemeParts(creators, GetSchemeParts(alias.Scheme), append(expanding, part))
+		if err != nil {
+			return nil, nil, err
+		}
+		// alias' own defaults take precedence over the ones of aliases it contains.
+		expandedParts[i] = parts
+		expandedParams[i] = utils.CombineParameters(params, alias.Parameters)
+	}
+
+	var result []string
+	parameters := make(utils.Parameters)
+	// go bottom-up, as sections are indexed by occurrences below them.
+	occurrences := make(map[string]int)
+	for i := len(schemeParts) - 1; i >= 0; i-- {
+		for key, value := range reindexParameters(expandedParams[i], occurrences) {
+			if _, exists := parameters[key]; !exists {
+				parameters[key] = value
+			}
+		}
+		for _, part := range expandedParts[i] {
+			occurrences[part]++
+		}
+		result = append(append([]string{}, expandedParts[i]...), result...)
+	}
+	return result, parameters, nil
+}
+
+// reindexParameters shifts section indexes of parameters by given offsets.
+func reindexParameters(parameters utils.Parameters, offsets map[string]int) utils.Parameters {
+	reindexed := make(utils.Parameters, len(parameters))
+	for key, value := range parameters {
+		dot := strings.Index(key, ".")
+		if dot == -1 {
+			reindexed[key] = value
+			continue
+		}
+		name, index, indexed := utils.TryGetParamsSectionIndex(key[:dot])
+		if !indexed {
+			reindexed[key] = value
+			continue
+		}
+		reindexed[utils.GetIndexedParamsSection(name, index+offsets[name])+key[dot:]] = value
+	}
+	return reindexed
+}
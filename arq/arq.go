@@ -0,0 +1,241 @@
+// Package arq puts reliable streams on top of packet connections, as an alternative to KCP. It is a selective-repeat
+// ARQ: lost packets are found from selective acknowledgements (SACK) and retransmission timeouts, and only those are
+// sent again. Unlike KCP, it retransmits conservatively and lets a congestion control decide the window: NewReno by
+// default, or LEDBAT, which backs off once delay starts to grow, for links that should stay usable by other traffic.
+//
+// Packet size starts at a safe size and grows as probes of larger sizes get through (path MTU discovery). Each
+// connection is identified by a random connection ID chosen by the client, so servers keep connections alive when
+// NAT of the client assigns it a new address. Connection IDs are not authenticated; put an obfuscator that
+// authenticates packets underneath if that matters.
+//
+// Peers ping each other every keepalive interval, so that a connection is ended only once its peer is gone for
+// idletimeout. With keepalive=false nothing is sent while there is nothing to send, and a connection left idle for
+// idletimeout ends too.
+package arq
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"net"
+	"time"
+)
+
+const (
+	ParamCongestion  = "cc"
+	ParamWindow      = "window"
+	ParamSendBuffer  = "sendbuffer"
+	ParamMTU         = "mtu"
+	ParamMaxMTU      = "maxmtu"
+	ParamProbeMTU    = "pmtud"
+	ParamIdleTimeout = "idletimeout"
+	ParamBacklog     = "backlog"
+
+	DefaultCongestion  = "newreno"
+	DefaultWindow      = 1024
+	DefaultSendBuffer  = 4 * 1024 * 1024
+	DefaultMTU         = 1200
+	DefaultMaxMTU      = 1472
+	DefaultIdleTimeout = 30 * time.Second
+	DefaultBacklog     = 128
+)
+
+var (
+	ErrTimeout         = errors.New("arq: peer stopped responding")
+	ErrConnectionReset = errors.New("arq: connection reset by peer")
+)
+
+var parametersHint = []utils.ParameterHint{
+	{Key: ParamCongestion, Description: "congestion control: newreno or ledbat", Type: utils.ParameterTypeString, DefaultValue: DefaultCongestion},
+	{Key: ParamTargetDelay, Description: "queuing delay ledbat aims for", Type: utils.ParameterTypeDuration, DefaultValue: DefaultTargetDelay.String()},
+	{Key: ParamWindow, Description: "receive window in packets", Type: utils.ParameterTypeInt, DefaultValue: "1024"},
+	{Key: ParamSendBuffer, Description: "bytes written and not yet acknowledged, before writes block", Type: utils.ParameterTypeInt, DefaultValue: "4194304"},
+	{Key: ParamMTU, Description: "packet size to start with, which has to get through", Type: utils.ParameterTypeInt, DefaultValue: "1200"},
+	{Key: ParamMaxMTU, Description: "largest packet size probed for", Type: utils.ParameterTypeInt, DefaultValue: "1472"},
+	{Key: ParamProbeMTU, Description: "probe for larger packet sizes", Type: utils.ParameterTypeBool, DefaultValue: "true"},
+	{Key: ParamIdleTimeout, Description: "close connection after hearing nothing from peer this long; with keepalive=false, connections that sit idle end this way", Type: utils.ParameterTypeDuration, DefaultValue: DefaultIdleTimeout.String()},
+}
+
+var serverParametersHint = append(append([]utils.ParameterHint{}, parametersHint...),
+	utils.ParameterHint{Key: ParamBacklog, Description: "connections in handshake or waiting to be accepted", Type: utils.ParameterTypeInt, DefaultValue: "128"},
+)
+
+type options struct {
+	newCongestionControl func() CongestionControl
+	window               int
+	sendBuffer           int
+	mtu                  int
+	maxMTU               int
+	probeMTU             bool
+	idleTimeout          time.Duration
+	keepAlive            time.Duration
+	backlog              int
+}
+
+func optionsFromParameters(parameters utils.Parameters) (*options, error) {
+	o := &options{
+		window:      utils.IntegerFromParameters(parameters, ParamWindow, DefaultWindow),
+		sendBuffer:  utils.IntegerFromParameters(parameters, ParamSendBuffer, DefaultSendBuffer),
+		mtu:         utils.IntegerFromParameters(parameters, ParamMTU, DefaultMTU),
+		maxMTU:      utils.IntegerFromParameters(parameters, ParamMaxMTU, DefaultMaxMTU),
+		probeMTU:    utils.BoolFromParameters(parameters, ParamProbeMTU, true),
+		idleTimeout: utils.DurationFromParameters(parameters, ParamIdleTimeout, DefaultIdleTimeout),
+		backlog:     utils.IntegerFromParameters(parameters, ParamBacklog, DefaultBacklog),
+	}
+	o.keepAlive, _ = muxedsocket.KeepAliveFromParameters(parameters)
+
+	var problems []muxedsocket.ParameterProblem
+	name := utils.StringFromParameters(parameters, ParamCongestion, DefaultCongestion)
+	newCongestionControl, found := CongestionControls.Get(name)
+	if found && newCongestionControl != nil {
+		o.newCongestionControl = func() CongestionControl {
+			return newCongestionControl(parameters)
+		}
+	} else {
+		problems = append(problems, muxedsocket.ParameterProblem{Key: ParamCongestion, Reason: "unknown congestion control " + name})
+	}
+	if o.window < 1 || o.window > 0xffff {
+		problems = append(problems, muxedsocket.ParameterProblem{Key: ParamWindow, Reason: "must be between 1 and 65535"})
+	}
+	if o.sendBuffer < 1 {
+		problems = append(problems, muxedsocket.ParameterProblem{Key: ParamSendBuffer, Reason: "must be positive"})
+	}
+	if o.mtu < dataHeaderSize+minimumPayload || o.mtu > maxPacketSize {
+		problems = append(problems, muxedsocket.ParameterProblem{Key: ParamMTU, Reason: "out of range"})
+	}
+	if o.maxMTU > maxPacketSize {
+		problems = append(problems, muxedsocket.ParameterProblem{Key: ParamMaxMTU, Reason: "out of range"})
+	}
+	if o.idleTimeout <= 0 {
+		problems = append(problems, muxedsocket.ParameterProblem{Key: ParamIdleTimeout, Reason: "must be positive"})
+	}
+	if len(problems) > 0 {
+		return nil, muxedsocket.ErrInvalidParameters{Problems: problems}
+	}
+	if o.maxMTU < o.mtu {
+		o.maxMTU = o.mtu
+	}
+	if o.backlog < 1 {
+		o.backlog = DefaultBacklog
+	}
+	return o, nil
+}
+
+type Implementation struct {
+	// nothing.
+}
+
+var _ types.StreamAdapterImplementation = &Implementation{}
+var _ types.StreamAdapterContextImplementation = &Implementation{}
+var _ types.HasParametersHint = &Implementation{}
+
+func (i *Implementation) Server(conn types.PacketConnFunc, parameters utils.Parameters) (types.StreamListenFunc, error) {
+	listenFunc, err := i.ServerContext(conn.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return listenFunc.WithoutContext(), nil
+}
+
+func (i *Implementation) Client(conn types.PacketConnFunc, parameters utils.Parameters) (types.StreamDialFunc, error) {
+	dialFunc, err := i.ClientContext(conn.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return dialFunc.WithoutContext(), nil
+}
+
+func (i *Implementation) ServerContext(conn types.PacketConnContextFunc, parameters utils.Parameters) (types.StreamListenContextFunc, error) {
+	options, err := optionsFromParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) (types.StreamListener, error) {
+		packetConn, err := conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return listen(packetConn, options), nil
+	}, nil
+}
+
+func (i *Implementation) ClientContext(conn types.PacketConnContextFunc, parameters utils.Parameters) (types.StreamDialContextFunc, error) {
+	options, err := optionsFromParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+	var dialFunc types.StreamDialContextFunc
+	dialFunc = func(ctx context.Context) (types.StreamConn, error) {
+		packetConn, err := conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return dial(ctx, packetConn, options, dialFunc)
+	}
+	return dialFunc, nil
+}
+
+// dial connects to the remote address of packetConn, which it takes over.
+func dial(ctx context.Context, packetConn types.PacketConn, options *options, dialFunc types.StreamDialContextFunc) (types.StreamConn, error) {
+	remoteAddr := packetConn.RemoteAddr()
+	if remoteAddr == nil {
+		_ = packetConn.Close()
+		return nil, muxedsocket.ErrNoRemoteAddr
+	}
+	var cid connID
+	if _, err := rand.Read(cid[:]); err != nil {
+		_ = packetConn.Close()
+		return nil, err
+	}
+	output := func(b []byte, addr net.Addr) {
+		_, _ = packetConn.WriteTo(b, addr)
+	}
+	c := newConn(cid, options, packetConn.LocalAddr(), remoteAddr, output, func() {
+		_ = packetConn.Close()
+	})
+	c.dialFunc = dialFunc
+	go readClient(packetConn, c)
+
+	c.mutex.Lock()
+	c.send(&packet{kind: typeSYN, version: protocolVersion, window: uint16(c.receiveWindow())})
+	c.mutex.Unlock()
+	select {
+	case <-c.ready:
+		return c, nil
+	case <-c.closed:
+		return nil, c.err
+	case <-ctx.Done():
+		c.abort()
+		return nil, ctx.Err()
+	}
+}
+
+// readClient hands packets of the server over to c, until packetConn fails.
+func readClient(packetConn types.PacketConn, c *Conn) {
+	buffer := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := packetConn.ReadFrom(buffer)
+		if err != nil {
+			c.mutex.Lock()
+			c.die(err)
+			c.mutex.Unlock()
+			return
+		}
+		p, err := decodePacket(buffer[:n])
+		if err != nil || p.cid != c.cid {
+			continue
+		}
+		c.input(p, addr)
+	}
+}
+
+func (i *Implementation) ClientParametersHint() []utils.ParameterHint {
+	return parametersHint
+}
+
+func (i *Implementation) ServerParametersHint() []utils.ParameterHint {
+	return serverParametersHint
+}
@@ -0,0 +1,301 @@
+package arq
+
+import (
+	"bytes"
+	"context"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lossyConn is one end of an in-memory packet link that drops a share of packets written to it, and those larger
+// than maxSize if it is set.
+type lossyConn struct {
+	*utils.PacketQueue
+	remote  net.Addr
+	peer    *lossyConn
+	loss    float64
+	maxSize int
+
+	mutex  sync.Mutex
+	local  net.Addr
+	random *rand.Rand
+}
+
+func lossyPair(loss float64) (*lossyConn, *lossyConn) {
+	a := &lossyConn{
+		PacketQueue: utils.NewPacketQueue(256),
+		local:       &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1000},
+		loss:        loss,
+		random:      rand.New(rand.NewSource(1)),
+	}
+	b := &lossyConn{
+		PacketQueue: utils.NewPacketQueue(256),
+		local:       &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2000},
+		loss:        loss,
+		random:      rand.New(rand.NewSource(2)),
+	}
+	a.peer, b.peer = b, a
+	a.remote = b.local
+	return a, b
+}
+
+func (c *lossyConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if c.IsClosed() {
+		return 0, net.ErrClosed
+	}
+	c.mutex.Lock()
+	drop := c.random.Float64() < c.loss || (c.maxSize > 0 && len(p) > c.maxSize)
+	local := c.local
+	c.mutex.Unlock()
+	if !drop {
+		c.peer.TryDeliver(append([]byte(nil), p...), local)
+	}
+	return len(p), nil
+}
+
+// rebind makes packets written from now on come from addr, as when NAT assigns a new address.
+func (c *lossyConn) rebind(addr net.Addr) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.local = addr
+}
+
+func (c *lossyConn) Close() error {
+	c.Shutdown()
+	return nil
+}
+
+func (c *lossyConn) LocalAddr() net.Addr {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.local
+}
+
+func (c *lossyConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *lossyConn) CanRedial() bool {
+	return false
+}
+
+func (c *lossyConn) Redial() (types.Socket, error) {
+	return nil, net.ErrClosed
+}
+
+func testOptions(t *testing.T) *options {
+	o, err := optionsFromParameters(utils.Parameters{ParamBacklog: "4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+// connect dials a connection over clientConn and accepts it on listener.
+func connect(t *testing.T, clientConn *lossyConn, listener *Listener, options *options) (*Conn, *Conn) {
+	accepted := make(chan types.StreamConn, 1)
+	go func() {
+		conn, _ := listener.AcceptConn()
+		accepted <- conn
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := dial(ctx, clientConn, options, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case server := <-accepted:
+		if server == nil {
+			t.Fatal("accepting failed")
+		}
+		return client.(*Conn), server.(*Conn)
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection wasn't accepted")
+	}
+	return nil, nil
+}
+
+// exchange sends data from one end to other one, and waits for it to arrive.
+func exchange(t *testing.T, from *Conn, to *Conn, data []byte) {
+	if _, err := from.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	_ = to.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, len(data))
+	if _, err := io.ReadFull(to, buf); err != nil || !bytes.Equal(buf, data) {
+		t.Fatal(err)
+	}
+}
+
+func TestTransferUnderLoss(t *testing.T) {
+	clientConn, serverConn := lossyPair(0.2)
+	options := testOptions(t)
+	listener := listen(serverConn, options)
+	defer listener.Close()
+
+	payload := make([]byte, 256*1024)
+	rand.New(rand.NewSource(3)).Read(payload)
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.AcceptConn()
+		if err != nil {
+			received <- nil
+			return
+		}
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := dial(ctx, clientConn, options, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = client.SetWriteDeadline(time.Now().Add(20 * time.Second))
+	if _, err := client.Write(payload); err != nil {
+		t.Fatal(err)
+	}
+	_ = client.Close()
+
+	select {
+	case data := <-received:
+		if !bytes.Equal(data, payload) {
+			t.Fatalf("received %d bytes, which differ from %d sent", len(data), len(payload))
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("transfer didn't complete")
+	}
+}
+
+func TestHalfOpenConnections(t *testing.T) {
+	peerConn, serverConn := lossyPair(0)
+	listener := listen(serverConn, testOptions(t))
+	defer listener.Close()
+
+	// SYNs that are never followed by an ACK.
+	for i := 0; i < 10; i++ {
+		cid := connID{byte(i + 1)}
+		syn := &packet{kind: typeSYN, version: protocolVersion, cid: cid, window: 64}
+		_, _ = peerConn.WriteTo(syn.encode(), nil)
+	}
+
+	accepted := make(chan struct{})
+	go func() {
+		if _, err := listener.AcceptConn(); err == nil {
+			close(accepted)
+		}
+	}()
+	select {
+	case <-accepted:
+		t.Fatal("accepted a connection whose handshake is not complete")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	listener.mutex.Lock()
+	halfOpen := listener.halfOpen
+	listener.mutex.Unlock()
+	if halfOpen != 4 {
+		t.Fatalf("%d half-open connections, want 4", halfOpen)
+	}
+}
+
+func TestPathMTUDiscovery(t *testing.T) {
+	clientConn, serverConn := lossyPair(0)
+	// packets larger than this don't get through, either way.
+	const pathMTU = 1400
+	clientConn.maxSize, serverConn.maxSize = pathMTU, pathMTU
+	options := testOptions(t)
+	listener := listen(serverConn, options)
+	defer listener.Close()
+	client, server := connect(t, clientConn, listener, options)
+	defer client.Close()
+
+	// round trips bring retransmission timeout, which failed probes wait for, down.
+	for i := 0; i < 10; i++ {
+		exchange(t, client, server, []byte("ping"))
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for client.MTU() <= pathMTU-probeAccuracy {
+		if time.Now().After(deadline) {
+			t.Fatalf("MTU stayed at %d", client.MTU())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if client.MTU() > pathMTU {
+		t.Fatalf("MTU %d is beyond path MTU", client.MTU())
+	}
+
+	// full-sized packets get through.
+	data := make([]byte, 64*1024)
+	rand.New(rand.NewSource(4)).Read(data)
+	exchange(t, client, server, data)
+}
+
+func TestConnectionFollowsClient(t *testing.T) {
+	clientConn, serverConn := lossyPair(0)
+	options := testOptions(t)
+	listener := listen(serverConn, options)
+	defer listener.Close()
+	client, server := connect(t, clientConn, listener, options)
+	defer client.Close()
+	exchange(t, client, server, []byte("hello"))
+
+	rebound := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 3000}
+	clientConn.rebind(rebound)
+	// a ping only claims the connection, and could come from anyone who knows its ID.
+	client.mutex.Lock()
+	client.send(&packet{kind: typePING})
+	client.mutex.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	if server.RemoteAddr().String() == rebound.String() {
+		t.Fatal("connection moved on a ping")
+	}
+
+	exchange(t, client, server, []byte("moved"))
+	if server.RemoteAddr().String() != rebound.String() {
+		t.Fatalf("connection stayed at %s", server.RemoteAddr())
+	}
+	exchange(t, server, client, []byte("reply"))
+}
+
+func TestLEDBATYieldsToQueuing(t *testing.T) {
+	cc := NewLEDBAT(utils.Parameters{ParamTargetDelay: "100ms"})
+	base := 20 * time.Millisecond
+	for i := 0; i < 100; i++ {
+		cc.OnAck(1, 0, base)
+	}
+	grown := cc.Window()
+	if grown <= initialWindow {
+		t.Fatalf("window is %d without queuing", grown)
+	}
+
+	// delay grows beyond target as queues build up.
+	for i := 0; i < 1000 && cc.Window() > minimumWindow; i++ {
+		cc.OnAck(1, 0, base+300*time.Millisecond)
+	}
+	if cc.Window() != minimumWindow {
+		t.Fatalf("window is %d with queuing beyond target", cc.Window())
+	}
+
+	// once queues drain, window grows again.
+	for i := 0; i < 100; i++ {
+		cc.OnAck(1, 0, base)
+	}
+	if cc.Window() <= minimumWindow {
+		t.Fatal("window didn't grow once queuing stopped")
+	}
+	before := cc.Window()
+	cc.OnLoss()
+	if cc.Window() != before/2 && cc.Window() != minimumWindow {
+		t.Fatalf("window is %d after loss, was %d", cc.Window(), before)
+	}
+}
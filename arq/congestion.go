@@ -0,0 +1,159 @@
+package arq
+
+import (
+	"github.com/hadi77ir/muxedsocket/utils"
+	"time"
+)
+
+const (
+	initialWindow = 10
+	minimumWindow = 2
+	maximumWindow = 1 << 16
+
+	ParamTargetDelay   = "targetdelay"
+	DefaultTargetDelay = 100 * time.Millisecond
+
+	ledbatGain         = 1.0
+	ledbatBaseHistory  = 10
+	ledbatBaseInterval = time.Minute
+	ledbatCurrentCount = 4
+)
+
+// CongestionControl decides how many packets may be in flight. Its methods are called with lock of the connection
+// held, so they don't need to be safe for concurrent use.
+type CongestionControl interface {
+	// Window returns how many packets may be in flight.
+	Window() int
+	// OnAck is called when packets get acknowledged, with smoothed round-trip time and latest one-way delay reported by
+	// peer. One-way delay includes offset of clocks of both ends, so only its changes are meaningful.
+	OnAck(acked int, rtt time.Duration, delay time.Duration)
+	// OnLoss is called once a loss is detected from selective acknowledgements, at most once per round trip.
+	OnLoss()
+	// OnTimeout is called when retransmission timer expires.
+	OnTimeout()
+}
+
+// NewCongestionControlFunc creates congestion control of a connection.
+type NewCongestionControlFunc func(parameters utils.Parameters) CongestionControl
+
+// CongestionControls holds congestion controls that may be chosen by "cc" parameter. More may be registered.
+var CongestionControls = &utils.Registry[NewCongestionControlFunc]{}
+
+func init() {
+	CongestionControls.Register("newreno", NewNewReno)
+	CongestionControls.Register("ledbat", NewLEDBAT)
+}
+
+func clampWindow(window float64) float64 {
+	if window < minimumWindow {
+		return minimumWindow
+	}
+	if window > maximumWindow {
+		return maximumWindow
+	}
+	return window
+}
+
+// newReno is loss-based congestion control of RFC 6582, counted in packets.
+type newReno struct {
+	window    float64
+	threshold float64
+}
+
+func NewNewReno(_ utils.Parameters) CongestionControl {
+	return &newReno{window: initialWindow, threshold: maximumWindow}
+}
+
+func (c *newReno) Window() int {
+	return int(c.window)
+}
+
+func (c *newReno) OnAck(acked int, _ time.Duration, _ time.Duration) {
+	if c.window < c.threshold {
+		// slow start
+		c.window += float64(acked)
+	} else {
+		c.window += float64(acked) / c.window
+	}
+	c.window = clampWindow(c.window)
+}
+
+func (c *newReno) OnLoss() {
+	c.threshold = clampWindow(c.window / 2)
+	c.window = c.threshold
+}
+
+func (c *newReno) OnTimeout() {
+	c.threshold = clampWindow(c.window / 2)
+	c.window = minimumWindow
+}
+
+// ledbat is delay-based congestion control of RFC 6817. It backs off as soon as queues start to build up, yielding to
+// other traffic on the link.
+type ledbat struct {
+	window float64
+	target time.Duration
+
+	// base holds minimum delay seen in each of the last minutes.
+	base        []time.Duration
+	baseStarted time.Time
+	// current holds latest delays, whose minimum filters out noise.
+	current []time.Duration
+}
+
+func NewLEDBAT(parameters utils.Parameters) CongestionControl {
+	target := utils.DurationFromParameters(parameters, ParamTargetDelay, DefaultTargetDelay)
+	if target <= 0 {
+		target = DefaultTargetDelay
+	}
+	return &ledbat{window: initialWindow, target: target}
+}
+
+func (c *ledbat) Window() int {
+	return int(c.window)
+}
+
+func (c *ledbat) OnAck(acked int, _ time.Duration, delay time.Duration) {
+	c.addDelay(delay)
+	queuing := minDuration(c.current) - minDuration(c.base)
+	offTarget := float64(c.target-queuing) / float64(c.target)
+	c.window = clampWindow(c.window + ledbatGain*offTarget*float64(acked)/c.window)
+}
+
+func (c *ledbat) addDelay(delay time.Duration) {
+	now := time.Now()
+	if len(c.base) == 0 || now.Sub(c.baseStarted) >= ledbatBaseInterval {
+		c.base = append(c.base, delay)
+		if len(c.base) > ledbatBaseHistory {
+			c.base = c.base[1:]
+		}
+		c.baseStarted = now
+	} else if delay < c.base[len(c.base)-1] {
+		c.base[len(c.base)-1] = delay
+	}
+	c.current = append(c.current, delay)
+	if len(c.current) > ledbatCurrentCount {
+		c.current = c.current[1:]
+	}
+}
+
+func (c *ledbat) OnLoss() {
+	c.window = clampWindow(c.window / 2)
+}
+
+func (c *ledbat) OnTimeout() {
+	c.window = minimumWindow
+}
+
+func minDuration(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	least := durations[0]
+	for _, d := range durations[1:] {
+		if d < least {
+			least = d
+		}
+	}
+	return least
+}
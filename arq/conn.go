@@ -0,0 +1,781 @@
+package arq
+
+import (
+	"context"
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	tickInterval   = 10 * time.Millisecond
+	initialRTO     = time.Second
+	minimumRTO     = 200 * time.Millisecond
+	maximumRTO     = 60 * time.Second
+	maxTimeouts    = 10
+	lossThreshold  = 3
+	ackEvery       = 2
+	probeAttempts  = 3
+	probeInterval  = 10 * time.Minute
+	probeAccuracy  = 16
+	minimumPayload = 64
+)
+
+var _ types.StreamConn = &Conn{}
+
+// segment is a packet sent and not yet acknowledged cumulatively.
+type segment struct {
+	seq    uint32
+	data   []byte
+	fin    bool
+	sentAt time.Time
+	sacked bool
+	lost   bool
+}
+
+// received is a packet received out of order, waiting for the ones before it.
+type received struct {
+	data []byte
+	fin  bool
+}
+
+// prober searches for the largest packet that gets through, between a size known to pass and one assumed not to.
+type prober struct {
+	low        int
+	high       int
+	candidate  int
+	id         uint32
+	sentAt     time.Time
+	attempts   int
+	nextSearch time.Time
+}
+
+type Conn struct {
+	cid     connID
+	options *options
+	output  func(b []byte, addr net.Addr)
+	local   net.Addr
+	// accepted is true for server side connections. They answer SYN instead of sending it, and follow their peer to
+	// new addresses, identifying it by connection ID.
+	accepted bool
+	// onEstablish, if set, is called once handshake completes.
+	onEstablish func()
+	epoch       time.Time
+
+	mutex       sync.Mutex
+	remote      net.Addr
+	established bool
+	ready       chan struct{}
+	lastSend    time.Time
+	lastReceive time.Time
+
+	// sending
+	cc          CongestionControl
+	pending     []byte
+	unacked     []*segment
+	unackedSize int
+	nextSeq     uint32
+	peerWindow  int
+	finSent     bool
+	srtt        time.Duration
+	rttvar      time.Duration
+	rto         time.Duration
+	inRecovery  bool
+	recovery    uint32
+	timeouts    int
+	lastPing    time.Time
+
+	// receiving
+	rcvNext      uint32
+	outOfOrder   map[uint32]*received
+	readBuffer   []byte
+	peerFinished bool
+	ackPending   int
+	ackNow       bool
+	lastStamp    uint32
+	lastDelay    uint32
+	lastWindow   int
+
+	mtu   int
+	probe prober
+
+	readable      chan struct{}
+	writable      chan struct{}
+	readDeadline  *utils.Deadline
+	writeDeadline *utils.Deadline
+
+	// closed is closed by Close, or when connection dies. Connection keeps running after Close until its FIN is
+	// acknowledged, then finished is closed and release is called.
+	closed     chan struct{}
+	closedAt   time.Time
+	closing    bool
+	err        error
+	finished   chan struct{}
+	finishOnce sync.Once
+	release    func()
+
+	// dialFunc dials a new connection, for redialing. It is nil for accepted connections.
+	dialFunc types.StreamDialContextFunc
+}
+
+func newConn(cid connID, options *options, local, remote net.Addr, output func(b []byte, addr net.Addr), release func()) *Conn {
+	now := time.Now()
+	c := &Conn{
+		cid:           cid,
+		options:       options,
+		output:        output,
+		local:         local,
+		remote:        remote,
+		epoch:         now,
+		ready:         make(chan struct{}),
+		lastSend:      now,
+		lastReceive:   now,
+		cc:            options.newCongestionControl(),
+		peerWindow:    initialWindow,
+		rto:           initialRTO,
+		outOfOrder:    make(map[uint32]*received),
+		lastWindow:    options.window,
+		mtu:           options.mtu,
+		probe:         prober{low: options.mtu, high: options.maxMTU + 1},
+		readable:      make(chan struct{}, 1),
+		writable:      make(chan struct{}, 1),
+		readDeadline:  utils.NewDeadline(),
+		writeDeadline: utils.NewDeadline(),
+		closed:        make(chan struct{}),
+		finished:      make(chan struct{}),
+		release:       release,
+	}
+	go c.run()
+	return c
+}
+
+// now32 is the timestamp put on packets. It starts from 1, as 0 means no timestamp.
+func (c *Conn) now32() uint32 {
+	return uint32(time.Since(c.epoch)/time.Microsecond) + 1
+}
+
+func (c *Conn) run() {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.finished:
+			return
+		case now := <-ticker.C:
+			c.mutex.Lock()
+			c.onTick(now)
+			c.mutex.Unlock()
+		}
+	}
+}
+
+func signal(channel chan struct{}) {
+	select {
+	case channel <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Conn) send(p *packet) {
+	p.cid = c.cid
+	c.lastSend = time.Now()
+	c.output(p.encode(), c.remote)
+}
+
+// input handles a packet of this connection, coming from addr.
+func (c *Conn) input(p *packet, addr net.Addr) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.isFinished() {
+		return
+	}
+	c.lastReceive = time.Now()
+	// only packets that carry new data, or acknowledge it, move the connection; anyone who knows its ID could send
+	// the rest.
+	advanced := false
+	switch p.kind {
+	case typeSYN:
+		c.peerWindow = int(p.window)
+		c.send(&packet{kind: typeSYNACK, window: uint16(c.receiveWindow())})
+	case typeSYNACK:
+		c.peerWindow = int(p.window)
+		c.establish()
+		// server side waits for this ack before handing the connection out.
+		c.ackNow = true
+	case typeDATA, typeFIN:
+		c.establish()
+		advanced = c.onData(p)
+	case typeACK:
+		c.establish()
+		advanced = c.onAck(p)
+	case typePING:
+		c.ackNow = true
+	case typePROBE:
+		c.send(&packet{kind: typePROBEACK, probeID: p.probeID, probeSize: p.probeSize})
+	case typePROBEACK:
+		c.onProbeAck(p)
+	case typeRST:
+		c.die(ErrConnectionReset)
+		return
+	}
+	if advanced && c.accepted && addr != nil {
+		c.remote = addr
+	}
+	c.flush()
+}
+
+func (c *Conn) establish() {
+	if !c.established {
+		c.established = true
+		close(c.ready)
+		if c.onEstablish != nil {
+			// onEstablish takes other locks; connection lock is held here.
+			go c.onEstablish()
+		}
+	}
+}
+
+func (c *Conn) receiveWindow() int {
+	payload := c.mtu - dataHeaderSize
+	window := c.options.window - len(c.outOfOrder) - (len(c.readBuffer)+payload-1)/payload
+	if window < 0 {
+		return 0
+	}
+	return window
+}
+
+// onData takes a DATA or FIN packet. It returns true if the packet was new and within receive window.
+func (c *Conn) onData(p *packet) bool {
+	now := c.now32()
+	c.lastStamp = p.timestamp
+	c.lastDelay = now - p.timestamp
+	offset := p.seq - c.rcvNext
+	if seqLess(p.seq, c.rcvNext) || int(offset) >= c.options.window {
+		// duplicate, or beyond what was ever allowed.
+		c.ackNow = true
+		return false
+	}
+	if offset != 0 {
+		c.ackNow = true
+	}
+	_, exists := c.outOfOrder[p.seq]
+	if !exists {
+		c.outOfOrder[p.seq] = &received{data: append([]byte(nil), p.payload...), fin: p.kind == typeFIN}
+	}
+	delivered := false
+	for {
+		next, found := c.outOfOrder[c.rcvNext]
+		if !found {
+			break
+		}
+		delete(c.outOfOrder, c.rcvNext)
+		c.rcvNext++
+		delivered = true
+		if next.fin {
+			c.peerFinished = true
+		} else if !c.closing {
+			c.readBuffer = append(c.readBuffer, next.data...)
+		}
+	}
+	if len(c.outOfOrder) > 0 || c.peerFinished {
+		c.ackNow = true
+	} else {
+		c.ackPending++
+		if c.ackPending >= ackEvery {
+			c.ackNow = true
+		}
+	}
+	if delivered {
+		signal(c.readable)
+	}
+	return !exists
+}
+
+func (c *Conn) sendAck() {
+	keys := make([]uint32, 0, len(c.outOfOrder))
+	for seq := range c.outOfOrder {
+		keys = append(keys, seq)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return seqLess(keys[i], keys[j])
+	})
+	var blocks []sackBlock
+	for _, seq := range keys {
+		if n := len(blocks); n > 0 && blocks[n-1].end == seq {
+			blocks[n-1].end++
+			continue
+		}
+		if len(blocks) == maxSackBlocks {
+			break
+		}
+		blocks = append(blocks, sackBlock{start: seq, end: seq + 1})
+	}
+	c.lastWindow = c.receiveWindow()
+	c.send(&packet{kind: typeACK, ack: c.rcvNext, echo: c.lastStamp, delay: c.lastDelay, window: uint16(c.lastWindow), blocks: blocks})
+	c.ackPending = 0
+	c.ackNow = false
+}
+
+// onAck takes an ACK packet. It returns true if the packet acknowledged segments that were not acknowledged before.
+func (c *Conn) onAck(p *packet) bool {
+	c.peerWindow = int(p.window)
+	acked := 0
+	advanced := false
+	for len(c.unacked) > 0 && seqLess(c.unacked[0].seq, p.ack) {
+		advanced = true
+		if !c.unacked[0].sacked {
+			acked++
+		}
+		c.unackedSize -= len(c.unacked[0].data)
+		c.unacked[0] = nil
+		c.unacked = c.unacked[1:]
+	}
+	for _, s := range c.unacked {
+		if s.sacked {
+			continue
+		}
+		for _, block := range p.blocks {
+			if !seqLess(s.seq, block.start) && seqLess(s.seq, block.end) {
+				s.sacked = true
+				s.lost = false
+				acked++
+				break
+			}
+		}
+	}
+	if acked == 0 {
+		return advanced
+	}
+	if p.echo != 0 {
+		c.updateRTT(time.Duration(c.now32()-p.echo) * time.Microsecond)
+	}
+	c.timeouts = 0
+	c.cc.OnAck(acked, c.srtt, time.Duration(int32(p.delay))*time.Microsecond)
+	if c.inRecovery && !seqLess(p.ack, c.recovery) {
+		c.inRecovery = false
+	}
+	c.detectLoss()
+	signal(c.writable)
+	if c.closing && c.finSent && len(c.unacked) == 0 {
+		c.finish()
+	}
+	return true
+}
+
+// updateRTT updates round-trip time estimations, as in RFC 6298.
+func (c *Conn) updateRTT(rtt time.Duration) {
+	if c.srtt == 0 {
+		c.srtt = rtt
+		c.rttvar = rtt / 2
+	} else {
+		diff := c.srtt - rtt
+		if diff < 0 {
+			diff = -diff
+		}
+		c.rttvar = (3*c.rttvar + diff) / 4
+		c.srtt = (7*c.srtt + rtt) / 8
+	}
+	variance := 4 * c.rttvar
+	if variance < tickInterval {
+		variance = tickInterval
+	}
+	c.rto = c.srtt + variance
+	if c.rto < minimumRTO {
+		c.rto = minimumRTO
+	}
+	if c.rto > maximumRTO {
+		c.rto = maximumRTO
+	}
+}
+
+// detectLoss marks segments as lost once enough segments after them are acknowledged selectively.
+func (c *Conn) detectLoss() {
+	after := 0
+	lost := false
+	for i := len(c.unacked) - 1; i >= 0; i-- {
+		s := c.unacked[i]
+		if s.sacked {
+			after++
+			continue
+		}
+		if after >= lossThreshold && !s.lost {
+			s.lost = true
+			lost = true
+		}
+	}
+	if lost && !c.inRecovery {
+		c.cc.OnLoss()
+		c.inRecovery = true
+		c.recovery = c.nextSeq
+	}
+}
+
+func (c *Conn) onTimeout() {
+	c.timeouts++
+	if c.timeouts > maxTimeouts {
+		c.die(ErrTimeout)
+		return
+	}
+	c.cc.OnTimeout()
+	c.inRecovery = true
+	c.recovery = c.nextSeq
+	c.rto *= 2
+	if c.rto > maximumRTO {
+		c.rto = maximumRTO
+	}
+	for _, s := range c.unacked {
+		if !s.sacked {
+			s.lost = true
+		}
+	}
+}
+
+// flush sends a pending ack, retransmits lost segments and sends new ones, as far as windows allow.
+func (c *Conn) flush() {
+	if c.isFinished() {
+		return
+	}
+	if c.ackNow {
+		c.sendAck()
+	}
+	if !c.established {
+		return
+	}
+	inFlight := 0
+	for _, s := range c.unacked {
+		if !s.sacked && !s.lost {
+			inFlight++
+		}
+	}
+	window := c.cc.Window()
+	if c.peerWindow < window {
+		window = c.peerWindow
+	}
+	for _, s := range c.unacked {
+		if inFlight >= window {
+			return
+		}
+		if s.lost {
+			s.lost = false
+			c.transmit(s)
+			inFlight++
+		}
+	}
+	payload := c.mtu - dataHeaderSize
+	for inFlight < window {
+		s := &segment{seq: c.nextSeq}
+		if len(c.pending) > 0 {
+			size := len(c.pending)
+			if size > payload {
+				size = payload
+			}
+			s.data = append([]byte(nil), c.pending[:size]...)
+			c.pending = c.pending[size:]
+			if len(c.pending) == 0 {
+				c.pending = nil
+			}
+		} else if c.closing && !c.finSent {
+			s.fin = true
+			c.finSent = true
+		} else {
+			return
+		}
+		c.nextSeq++
+		c.unacked = append(c.unacked, s)
+		c.unackedSize += len(s.data)
+		c.transmit(s)
+		inFlight++
+	}
+}
+
+func (c *Conn) transmit(s *segment) {
+	kind := typeDATA
+	if s.fin {
+		kind = typeFIN
+	}
+	s.sentAt = time.Now()
+	c.send(&packet{kind: kind, seq: s.seq, timestamp: c.now32(), payload: s.data})
+}
+
+func (c *Conn) onTick(now time.Time) {
+	if c.isFinished() {
+		return
+	}
+	if now.Sub(c.lastReceive) > c.options.idleTimeout {
+		c.die(ErrTimeout)
+		return
+	}
+	if c.closing && now.Sub(c.closedAt) > c.options.idleTimeout {
+		// peer never acknowledged FIN.
+		c.finish()
+		return
+	}
+	if !c.established {
+		if now.Sub(c.lastSend) < c.rto {
+			return
+		}
+		if c.accepted {
+			c.send(&packet{kind: typeSYNACK, window: uint16(c.receiveWindow())})
+		} else {
+			c.send(&packet{kind: typeSYN, version: protocolVersion, window: uint16(c.receiveWindow())})
+		}
+		return
+	}
+	if c.ackPending > 0 {
+		c.ackNow = true
+	}
+	for _, s := range c.unacked {
+		if s.sacked || s.lost {
+			continue
+		}
+		if now.Sub(s.sentAt) > c.rto {
+			c.onTimeout()
+			if c.isFinished() {
+				return
+			}
+		}
+		break
+	}
+	if c.peerWindow == 0 && len(c.pending) > 0 && now.Sub(c.lastPing) > c.rto {
+		// window probe; peer answers with an ack telling its window.
+		c.lastPing = now
+		c.send(&packet{kind: typePING})
+	} else if c.options.keepAlive > 0 && now.Sub(c.lastSend) > c.options.keepAlive {
+		c.send(&packet{kind: typePING})
+	}
+	c.probeTick(now)
+	c.flush()
+}
+
+// probeTick searches for path MTU, as in RFC 8899: a probe of the size halfway between the largest one known to
+// get through and the smallest one assumed not to is sent, and the size is taken once its probe is acknowledged.
+func (c *Conn) probeTick(now time.Time) {
+	if !c.options.probeMTU {
+		return
+	}
+	p := &c.probe
+	if p.candidate == 0 {
+		if now.Before(p.nextSearch) {
+			return
+		}
+		if p.high-p.low <= probeAccuracy {
+			// search is over. look for a larger size again later.
+			p.high = c.options.maxMTU + 1
+			p.nextSearch = now.Add(probeInterval)
+			return
+		}
+		p.candidate = p.low + (p.high-p.low)/2
+		p.attempts = 0
+	} else if now.Sub(p.sentAt) < c.rto {
+		return
+	} else if p.attempts >= probeAttempts {
+		p.high = p.candidate
+		p.candidate = 0
+		return
+	}
+	p.id++
+	p.attempts++
+	p.sentAt = now
+	c.send(&packet{kind: typePROBE, probeID: p.id, probeSize: uint16(p.candidate)})
+}
+
+func (c *Conn) onProbeAck(pk *packet) {
+	p := &c.probe
+	if p.candidate == 0 || pk.probeID != p.id || int(pk.probeSize) != p.candidate {
+		return
+	}
+	p.low = p.candidate
+	p.candidate = 0
+	if p.low > c.mtu {
+		c.mtu = p.low
+	}
+}
+
+func (c *Conn) isFinished() bool {
+	select {
+	case <-c.finished:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Conn) markClosed() {
+	if !c.closing {
+		c.closing = true
+		c.closedAt = time.Now()
+		close(c.closed)
+	}
+}
+
+// die ends connection right away, because of err.
+func (c *Conn) die(err error) {
+	if c.isFinished() {
+		return
+	}
+	c.err = err
+	c.markClosed()
+	c.finish()
+}
+
+func (c *Conn) finish() {
+	c.finishOnce.Do(func() {
+		close(c.finished)
+		if c.release != nil {
+			// release takes other locks; connection lock is held here.
+			go c.release()
+		}
+	})
+}
+
+// abort ends connection right away, telling peer.
+func (c *Conn) abort() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.isFinished() {
+		c.send(&packet{kind: typeRST})
+		c.die(net.ErrClosed)
+	}
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	for {
+		c.mutex.Lock()
+		if len(c.readBuffer) > 0 && !c.closing {
+			n := copy(b, c.readBuffer)
+			c.readBuffer = c.readBuffer[n:]
+			if len(c.readBuffer) == 0 {
+				c.readBuffer = nil
+			}
+			if c.lastWindow == 0 && c.receiveWindow() > 0 {
+				// tell peer that it may send again.
+				c.sendAck()
+			}
+			c.mutex.Unlock()
+			return n, nil
+		}
+		err := c.readError()
+		c.mutex.Unlock()
+		if err != nil {
+			return 0, err
+		}
+		select {
+		case <-c.readable:
+		case <-c.closed:
+		case <-c.readDeadline.Done():
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+func (c *Conn) readError() error {
+	switch {
+	case c.err != nil && c.err != net.ErrClosed:
+		return c.err
+	case c.closing:
+		return net.ErrClosed
+	case c.peerFinished:
+		return io.EOF
+	}
+	return nil
+}
+
+func (c *Conn) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		c.mutex.Lock()
+		if c.err != nil {
+			c.mutex.Unlock()
+			return written, c.err
+		}
+		if c.closing {
+			c.mutex.Unlock()
+			return written, net.ErrClosed
+		}
+		room := c.options.sendBuffer - len(c.pending) - c.unackedSize
+		if room > 0 {
+			if room > len(b)-written {
+				room = len(b) - written
+			}
+			c.pending = append(c.pending, b[written:written+room]...)
+			written += room
+			c.flush()
+			c.mutex.Unlock()
+			continue
+		}
+		c.mutex.Unlock()
+		select {
+		case <-c.writable:
+		case <-c.closed:
+		case <-c.writeDeadline.Done():
+			return written, os.ErrDeadlineExceeded
+		}
+	}
+	return written, nil
+}
+
+// Close closes connection, after sending what was written to it.
+func (c *Conn) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closing {
+		return net.ErrClosed
+	}
+	c.markClosed()
+	c.flush()
+	return nil
+}
+
+func (c *Conn) CloseChan() <-chan struct{} {
+	return c.closed
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.remote
+}
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.readDeadline.Set(t)
+	c.writeDeadline.Set(t)
+	return nil
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Set(t)
+	return nil
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.Set(t)
+	return nil
+}
+
+// MTU returns the largest packet size that is known to get through.
+func (c *Conn) MTU() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.mtu
+}
+
+func (c *Conn) CanRedial() bool {
+	return c.dialFunc != nil
+}
+
+func (c *Conn) Redial() (types.Socket, error) {
+	if c.dialFunc == nil {
+		return nil, muxedsocket.ErrRedialNotSupported
+	}
+	return c.dialFunc(context.Background())
+}
@@ -0,0 +1,7 @@
+package arq
+
+import "github.com/hadi77ir/muxedsocket"
+
+func init() {
+	muxedsocket.GlobalCreators().StreamAdapters().Register("arq", &Implementation{})
+}
@@ -0,0 +1,172 @@
+package arq
+
+import (
+	"github.com/hadi77ir/muxedsocket/types"
+	"net"
+	"sync"
+)
+
+var _ types.StreamListener = &Listener{}
+
+type Listener struct {
+	packetConn types.PacketConn
+	options    *options
+
+	mutex sync.Mutex
+	conns map[connID]*Conn
+	// halfOpen counts connections whose handshake is not complete. They are kept out of backlog until it is.
+	halfOpen int
+
+	backlog   chan *Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+func listen(packetConn types.PacketConn, options *options) *Listener {
+	l := &Listener{
+		packetConn: packetConn,
+		options:    options,
+		conns:      make(map[connID]*Conn),
+		backlog:    make(chan *Conn, options.backlog),
+		closed:     make(chan struct{}),
+	}
+	go l.readLoop()
+	return l
+}
+
+func (l *Listener) readLoop() {
+	buffer := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := l.packetConn.ReadFrom(buffer)
+		if err != nil {
+			select {
+			case <-l.closed:
+			default:
+				l.mutex.Lock()
+				l.err = err
+				l.mutex.Unlock()
+				_ = l.Close()
+			}
+			return
+		}
+		p, err := decodePacket(buffer[:n])
+		if err != nil {
+			continue
+		}
+		l.mutex.Lock()
+		c, found := l.conns[p.cid]
+		if !found && p.kind == typeSYN && p.version == protocolVersion {
+			c = l.accept(p.cid, addr)
+		}
+		l.mutex.Unlock()
+		if c != nil {
+			c.input(p, addr)
+		} else if p.kind != typeRST && p.kind != typeSYN {
+			// peer has a connection that is gone here.
+			_, _ = l.packetConn.WriteTo((&packet{kind: typeRST, cid: p.cid}).encode(), addr)
+		}
+	}
+}
+
+// accept creates a half-open connection for a SYN with a new connection ID, which goes to backlog once peer
+// acknowledges SYNACK. It returns nil if too many connections are half-open or waiting in backlog, so the SYN is
+// dropped and retried later by peer. It is called with lock of the listener held.
+func (l *Listener) accept(cid connID, addr net.Addr) *Conn {
+	select {
+	case <-l.closed:
+		return nil
+	default:
+	}
+	if l.halfOpen >= cap(l.backlog) || len(l.backlog) == cap(l.backlog) {
+		return nil
+	}
+	output := func(b []byte, addr net.Addr) {
+		_, _ = l.packetConn.WriteTo(b, addr)
+	}
+	// halfOpen is left once, either when handshake completes or when connection ends before that.
+	counted := true
+	c := newConn(cid, l.options, l.packetConn.LocalAddr(), addr, output, func() {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		delete(l.conns, cid)
+		if counted {
+			counted = false
+			l.halfOpen--
+		}
+	})
+	onEstablish := func() {
+		l.mutex.Lock()
+		if !counted {
+			l.mutex.Unlock()
+			return
+		}
+		counted = false
+		l.halfOpen--
+		queued := false
+		select {
+		case <-l.closed:
+		case l.backlog <- c:
+			queued = true
+		default:
+			// backlog filled up during handshake.
+		}
+		l.mutex.Unlock()
+		if !queued {
+			c.abort()
+		}
+	}
+	// connection is running already.
+	c.mutex.Lock()
+	c.accepted = true
+	c.onEstablish = onEstablish
+	c.mutex.Unlock()
+	l.conns[cid] = c
+	l.halfOpen++
+	return c
+}
+
+func (l *Listener) AcceptConn() (types.StreamConn, error) {
+	select {
+	case c := <-l.backlog:
+		return c, nil
+	case <-l.closed:
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		if l.err != nil {
+			return nil, l.err
+		}
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *Listener) Accept() (types.Socket, error) {
+	return l.AcceptConn()
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.packetConn.LocalAddr()
+}
+
+func (l *Listener) CloseChan() <-chan struct{} {
+	return l.closed
+}
+
+// Close closes the listener along with its packet connection, ending all connections accepted by it.
+func (l *Listener) Close() error {
+	err := net.ErrClosed
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		l.mutex.Lock()
+		conns := make([]*Conn, 0, len(l.conns))
+		for _, c := range l.conns {
+			conns = append(conns, c)
+		}
+		l.mutex.Unlock()
+		for _, c := range conns {
+			c.abort()
+		}
+		err = l.packetConn.Close()
+	})
+	return err
+}
@@ -0,0 +1,178 @@
+package arq
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	typeSYN byte = iota + 1
+	typeSYNACK
+	typeDATA
+	typeFIN
+	typeACK
+	typePING
+	typePROBE
+	typePROBEACK
+	typeRST
+)
+
+const (
+	protocolVersion = 1
+
+	connIDSize      = 8
+	headerSize      = 1 + connIDSize
+	dataHeaderSize  = headerSize + 4 + 4
+	ackHeaderSize   = headerSize + 4 + 4 + 4 + 2 + 1
+	sackBlockSize   = 4 + 4
+	probeHeaderSize = headerSize + 4
+	maxSackBlocks   = 8
+	maxPacketSize   = 0xffff
+)
+
+var ErrBadPacket = errors.New("bad packet")
+
+type connID [connIDSize]byte
+
+// sackBlock is a range of sequence numbers received out of order, end excluded.
+type sackBlock struct {
+	start uint32
+	end   uint32
+}
+
+// packet is a decoded packet. Fields that don't belong to its kind are left zero.
+type packet struct {
+	kind byte
+	cid  connID
+
+	// DATA and FIN. timestamp is time of sending, in microseconds since the sender started.
+	seq       uint32
+	timestamp uint32
+	payload   []byte
+
+	// ACK. echo is timestamp of the latest packet received, and delay is how long it took to arrive, both in
+	// microseconds. delay includes offset of the clocks, which doesn't matter when comparing delays.
+	ack    uint32
+	echo   uint32
+	delay  uint32
+	blocks []sackBlock
+
+	// ACK, SYN and SYNACK. window is how many more packets receiver accepts.
+	window  uint16
+	version byte
+
+	// PROBE and PROBEACK.
+	probeID   uint32
+	probeSize uint16
+}
+
+// seqLess compares sequence numbers, allowing them to wrap around.
+func seqLess(a, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+func (p *packet) encode() []byte {
+	var b []byte
+	switch p.kind {
+	case typeSYN:
+		b = make([]byte, headerSize+3)
+		b[headerSize] = p.version
+		binary.BigEndian.PutUint16(b[headerSize+1:], p.window)
+	case typeSYNACK:
+		b = make([]byte, headerSize+2)
+		binary.BigEndian.PutUint16(b[headerSize:], p.window)
+	case typeDATA, typeFIN:
+		b = make([]byte, dataHeaderSize+len(p.payload))
+		binary.BigEndian.PutUint32(b[headerSize:], p.seq)
+		binary.BigEndian.PutUint32(b[headerSize+4:], p.timestamp)
+		copy(b[dataHeaderSize:], p.payload)
+	case typeACK:
+		b = make([]byte, ackHeaderSize+len(p.blocks)*sackBlockSize)
+		binary.BigEndian.PutUint32(b[headerSize:], p.ack)
+		binary.BigEndian.PutUint32(b[headerSize+4:], p.echo)
+		binary.BigEndian.PutUint32(b[headerSize+8:], p.delay)
+		binary.BigEndian.PutUint16(b[headerSize+12:], p.window)
+		b[headerSize+14] = byte(len(p.blocks))
+		for i, block := range p.blocks {
+			offset := ackHeaderSize + i*sackBlockSize
+			binary.BigEndian.PutUint32(b[offset:], block.start)
+			binary.BigEndian.PutUint32(b[offset+4:], block.end)
+		}
+	case typePROBE:
+		// padded up to the size being probed.
+		b = make([]byte, int(p.probeSize))
+		binary.BigEndian.PutUint32(b[headerSize:], p.probeID)
+	case typePROBEACK:
+		b = make([]byte, probeHeaderSize+2)
+		binary.BigEndian.PutUint32(b[headerSize:], p.probeID)
+		binary.BigEndian.PutUint16(b[probeHeaderSize:], p.probeSize)
+	default:
+		b = make([]byte, headerSize)
+	}
+	b[0] = p.kind
+	copy(b[1:headerSize], p.cid[:])
+	return b
+}
+
+// decodePacket decodes b. Payload of the packet points into b.
+func decodePacket(b []byte) (*packet, error) {
+	if len(b) < headerSize {
+		return nil, ErrBadPacket
+	}
+	p := &packet{kind: b[0]}
+	copy(p.cid[:], b[1:headerSize])
+	body := b[headerSize:]
+	switch p.kind {
+	case typeSYN:
+		if len(body) < 3 {
+			return nil, ErrBadPacket
+		}
+		p.version = body[0]
+		p.window = binary.BigEndian.Uint16(body[1:])
+	case typeSYNACK:
+		if len(body) < 2 {
+			return nil, ErrBadPacket
+		}
+		p.window = binary.BigEndian.Uint16(body)
+	case typeDATA, typeFIN:
+		if len(body) < 8 {
+			return nil, ErrBadPacket
+		}
+		p.seq = binary.BigEndian.Uint32(body)
+		p.timestamp = binary.BigEndian.Uint32(body[4:])
+		p.payload = body[8:]
+	case typeACK:
+		if len(b) < ackHeaderSize {
+			return nil, ErrBadPacket
+		}
+		p.ack = binary.BigEndian.Uint32(body)
+		p.echo = binary.BigEndian.Uint32(body[4:])
+		p.delay = binary.BigEndian.Uint32(body[8:])
+		p.window = binary.BigEndian.Uint16(body[12:])
+		count := int(body[14])
+		if count > maxSackBlocks || len(b) < ackHeaderSize+count*sackBlockSize {
+			return nil, ErrBadPacket
+		}
+		p.blocks = make([]sackBlock, count)
+		for i := range p.blocks {
+			offset := ackHeaderSize + i*sackBlockSize
+			p.blocks[i] = sackBlock{start: binary.BigEndian.Uint32(b[offset:]), end: binary.BigEndian.Uint32(b[offset+4:])}
+		}
+	case typePROBE:
+		if len(body) < 4 {
+			return nil, ErrBadPacket
+		}
+		p.probeID = binary.BigEndian.Uint32(body)
+		p.probeSize = uint16(len(b))
+	case typePROBEACK:
+		if len(body) < 6 {
+			return nil, ErrBadPacket
+		}
+		p.probeID = binary.BigEndian.Uint32(body)
+		p.probeSize = binary.BigEndian.Uint16(body[4:])
+	case typePING, typeRST:
+	default:
+		return nil, ErrBadPacket
+	}
+	return p, nil
+}
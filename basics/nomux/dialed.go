@@ -1,6 +1,7 @@
 package nomux
 
 import (
+	"context"
 	"github.com/hadi77ir/muxedsocket/types"
 	"net"
 	"sync"
@@ -10,11 +11,24 @@ func WrapDialedConn(dialFunc types.StreamDialFunc) (types.MuxedSocket, error) {
 	return &DialedConn{dialer: dialFunc, closed: make(chan struct{}, 1)}, nil
 }
 
+// WrapDialedConnContext dials the first stream right away with ctx, and hands it out on the first DialStream. Later
+// streams are dialed lazily, like in WrapDialedConn, as ctx only bounds establishing the connection.
+func WrapDialedConnContext(ctx context.Context, dialFunc types.StreamDialContextFunc) (types.MuxedSocket, error) {
+	conn, err := dialFunc(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &DialedConn{dialer: dialFunc.WithoutContext(), closed: make(chan struct{}, 1), pending: conn}, nil
+}
+
 type DialedConn struct {
 	dialer          types.StreamDialFunc
 	closed          chan struct{}
 	remoteAddr      net.Addr
 	remoteAddrMutex sync.Mutex
+	// pending is the stream dialed by WrapDialedConnContext, not handed out yet.
+	pending      types.StreamConn
+	pendingMutex sync.Mutex
 }
 
 func (c *DialedConn) CloseChan() <-chan struct{} {
@@ -28,6 +42,13 @@ func (c *DialedConn) Close() error {
 	default:
 	}
 	close(c.closed)
+	c.pendingMutex.Lock()
+	pending := c.pending
+	c.pending = nil
+	c.pendingMutex.Unlock()
+	if pending != nil {
+		_ = pending.Close()
+	}
 	return nil
 }
 
@@ -59,9 +80,15 @@ func (c *DialedConn) OpenStream() (stream types.MuxStream, err error) {
 }
 
 func (c *DialedConn) DialStream() (stream types.MuxStream, err error) {
-	conn, err := c.dialer()
-	if err != nil {
-		return
+	c.pendingMutex.Lock()
+	conn := c.pending
+	c.pending = nil
+	c.pendingMutex.Unlock()
+	if conn == nil {
+		conn, err = c.dialer()
+		if err != nil {
+			return
+		}
 	}
 	stream = &Stream{StreamConn: conn, dialer: c.DialStream}
 	c.remoteAddrMutex.Lock()
@@ -1,6 +1,7 @@
 package nomux
 
 import (
+	"context"
 	"github.com/hadi77ir/muxedsocket/types"
 	"net"
 )
@@ -41,4 +42,12 @@ func WrapServer(conn types.StreamListenFunc) (types.MuxedListener, error) {
 	return &Listener{listener: listener}, nil
 }
 
+func WrapServerContext(ctx context.Context, conn types.StreamListenContextFunc) (types.MuxedListener, error) {
+	listener, err := conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Listener{listener: listener}, nil
+}
+
 var _ types.MuxedListener = &Listener{}
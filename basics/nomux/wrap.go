@@ -1,6 +1,7 @@
 package nomux
 
 import (
+	"context"
 	"github.com/hadi77ir/muxedsocket/types"
 	"github.com/hadi77ir/muxedsocket/utils"
 )
@@ -10,15 +11,33 @@ type Implementation struct {
 }
 
 func (i Implementation) Server(conn types.StreamListenFunc, parameters utils.Parameters) (types.MuxListenFunc, error) {
-	return func() (types.MuxedListener, error) {
-		return WrapServer(conn)
-	}, nil
+	listenFunc, err := i.ServerContext(conn.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return listenFunc.WithoutContext(), nil
 }
 
+// Client dials the first stream right away, as ClientContext does.
 func (i Implementation) Client(conn types.StreamDialFunc, parameters utils.Parameters) (types.MuxDialFunc, error) {
-	return func() (types.MuxedSocket, error) {
-		return WrapDialedConn(conn)
+	dialFunc, err := i.ClientContext(conn.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return dialFunc.WithoutContext(), nil
+}
+
+func (i Implementation) ServerContext(conn types.StreamListenContextFunc, parameters utils.Parameters) (types.MuxListenContextFunc, error) {
+	return func(ctx context.Context) (types.MuxedListener, error) {
+		return WrapServerContext(ctx, conn)
+	}, nil
+}
+
+func (i Implementation) ClientContext(conn types.StreamDialContextFunc, parameters utils.Parameters) (types.MuxDialContextFunc, error) {
+	return func(ctx context.Context) (types.MuxedSocket, error) {
+		return WrapDialedConnContext(ctx, conn)
 	}, nil
 }
 
 var _ types.StreamSolutionImplementation = &Implementation{}
+var _ types.StreamSolutionContextImplementation = &Implementation{}
@@ -1,18 +1,24 @@
 package packet
 
 import (
+	"errors"
 	"github.com/hadi77ir/muxedsocket"
 	"github.com/hadi77ir/muxedsocket/types"
 	"github.com/hadi77ir/muxedsocket/utils"
 	"net"
+	"sync"
+	"sync/atomic"
 )
 
 type basicWrapper struct {
 	net.PacketConn
 	remoteAddr net.Addr
 	closed     chan struct{}
+	closeOnce  sync.Once
 	dialFunc   StandardPrimedPacketConnFunc
 	afterDial  WrappedHookFunc
+	// connected is set once conn refuses writes with an address, as dialed UDP sockets do.
+	connected atomic.Bool
 }
 
 func (c *basicWrapper) CloseChan() <-chan struct{} {
@@ -20,13 +26,10 @@ func (c *basicWrapper) CloseChan() <-chan struct{} {
 }
 
 func (c *basicWrapper) Close() error {
-	select {
-	case <-c.closed:
-		break
-	default:
+	c.closeOnce.Do(func() {
 		close(c.closed)
-	}
-	return c.Close()
+	})
+	return c.PacketConn.Close()
 }
 
 func (c *basicWrapper) RemoteAddr() net.Addr {
@@ -54,8 +57,18 @@ func (c *basicWrapper) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
 	return
 }
 
+// WriteTo sends p to addr. Connections that are connected to their peer send p to it instead, as layers like QUIC pass
+// the address of the peer even then.
 func (c *basicWrapper) WriteTo(p []byte, addr net.Addr) (n int, err error) {
-	n, err = c.PacketConn.WriteTo(p, addr)
+	if c.connected.Load() {
+		n, err = c.PacketConn.(net.Conn).Write(p)
+	} else {
+		n, err = c.PacketConn.WriteTo(p, addr)
+		if _, isConn := c.PacketConn.(net.Conn); isConn && errors.Is(err, net.ErrWriteToConnected) {
+			c.connected.Store(true)
+			return c.WriteTo(p, addr)
+		}
+	}
 	c.handleError(err)
 	return
 }
@@ -0,0 +1,49 @@
+package packet
+
+import (
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"net"
+	"sync/atomic"
+)
+
+// FromPacketConn wraps an existing packet connection into a function giving it out. remoteAddr is the peer to send to
+// on client side, and may be nil on server side. Connection is given out only once; later calls fail with
+// muxedsocket.ErrConnAlreadyUsed.
+func FromPacketConn(conn net.PacketConn, remoteAddr net.Addr) types.PacketConnFunc {
+	var used atomic.Bool
+	return func() (types.PacketConn, error) {
+		if used.Swap(true) {
+			return nil, muxedsocket.ErrConnAlreadyUsed
+		}
+		return WrapConn(conn, remoteAddr, nil, nil), nil
+	}
+}
+
+// InjectedImplementation is a transport that ignores address and gives out the functions it was created with.
+type InjectedImplementation struct {
+	dialFunc   types.PacketConnFunc
+	listenFunc types.PacketConnFunc
+}
+
+func (i *InjectedImplementation) Server(addr string, parameters utils.Parameters) (types.PacketConnFunc, error) {
+	if i.listenFunc == nil {
+		return nil, muxedsocket.ErrOpNotSupported
+	}
+	return i.listenFunc, nil
+}
+
+func (i *InjectedImplementation) Client(addr string, parameters utils.Parameters) (types.PacketConnFunc, error) {
+	if i.dialFunc == nil {
+		return nil, muxedsocket.ErrOpNotSupported
+	}
+	return i.dialFunc, nil
+}
+
+var _ types.PacketConnImplementation = &InjectedImplementation{}
+
+// WrapInjected creates a transport out of given functions. Either of them may be nil if that side is not needed.
+func WrapInjected(dialFunc types.PacketConnFunc, listenFunc types.PacketConnFunc) *InjectedImplementation {
+	return &InjectedImplementation{dialFunc: dialFunc, listenFunc: listenFunc}
+}
@@ -1,6 +1,7 @@
 package packet
 
 import (
+	"errors"
 	"github.com/hadi77ir/muxedsocket"
 	"net"
 	"syscall"
@@ -37,12 +38,36 @@ func (c *oobConnWrapper) ReadMsgUDP(b, oob []byte) (n, oobn, flags int, addr *ne
 
 func (c *oobConnWrapper) WriteMsgUDP(b, oob []byte, addr *net.UDPAddr) (n, oobn int, err error) {
 	if oobConn, ok := c.PacketConn.(OOBCapablePacketConn); ok {
-		return oobConn.WriteMsgUDP(b, oob, addr)
+		if c.connected.Load() {
+			return oobConn.WriteMsgUDP(b, oob, nil)
+		}
+		n, oobn, err = oobConn.WriteMsgUDP(b, oob, addr)
+		if errors.Is(err, net.ErrWriteToConnected) {
+			c.connected.Store(true)
+			return oobConn.WriteMsgUDP(b, oob, nil)
+		}
+		return n, oobn, err
 	}
 	return 0, 0, muxedsocket.ErrOpNotSupported
 }
 
+// Read and Write make the wrapper a net.Conn, which golang.org/x/net/ipv4 requires for batch reads done by quic-go.
+func (c *oobConnWrapper) Read(b []byte) (int, error) {
+	if conn, ok := c.PacketConn.(net.Conn); ok {
+		return conn.Read(b)
+	}
+	return 0, muxedsocket.ErrOpNotSupported
+}
+
+func (c *oobConnWrapper) Write(b []byte) (int, error) {
+	if conn, ok := c.PacketConn.(net.Conn); ok {
+		return conn.Write(b)
+	}
+	return 0, muxedsocket.ErrOpNotSupported
+}
+
 var _ OOBCapablePacketConn = &oobConnWrapper{}
+var _ net.Conn = &oobConnWrapper{}
 
 func wrapOOBConn(conn OOBCapablePacketConn, remoteAddr net.Addr, dialFunc StandardPrimedPacketConnFunc, afterDial WrappedHookFunc) *oobConnWrapper {
 	return &oobConnWrapper{&basicWrapper{closed: make(chan struct{}, 1), PacketConn: conn, remoteAddr: remoteAddr, dialFunc: dialFunc, afterDial: afterDial}}
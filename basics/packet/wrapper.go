@@ -1,20 +1,22 @@
 package packet
 
 import (
+	"context"
 	"github.com/hadi77ir/muxedsocket/types"
 	"github.com/hadi77ir/muxedsocket/utils"
 	"net"
 )
 
 type StandardPacketConnFunc func(network, addr string) (net.PacketConn, error)
+type StandardPacketConnContextFunc func(ctx context.Context, network, addr string) (net.PacketConn, error)
 type StandardPrimedPacketConnFunc func() (net.PacketConn, error)
 type StandardResolveFunc func(network, addr string) (net.Addr, error)
 type AfterConnectHookFunc func(conn net.PacketConn, parameters utils.Parameters)
 type WrappedHookFunc func(conn net.PacketConn)
 
 type PacketConnImplementation struct {
-	dialFunc        StandardPacketConnFunc
-	listenFunc      StandardPacketConnFunc
+	dialFunc        StandardPacketConnContextFunc
+	listenFunc      StandardPacketConnContextFunc
 	resolveFunc     StandardResolveFunc
 	network         string
 	afterDialHook   *utils.Hook[AfterConnectHookFunc]
@@ -22,34 +24,52 @@ type PacketConnImplementation struct {
 }
 
 var _ types.PacketConnImplementation = &PacketConnImplementation{}
+var _ types.PacketConnContextImplementation = &PacketConnImplementation{}
 
 func (p *PacketConnImplementation) Server(addr string, parameters utils.Parameters) (types.PacketConnFunc, error) {
-	afterDial := WrapAfterConnectHooksFunc(p.afterDialHook, parameters)
-	dialer := WrapPacketConnFunc(p.dialFunc, p.network, addr)
-	return func() (types.PacketConn, error) {
-		conn, err := dialer()
+	listenFunc, err := p.ServerContext(addr, parameters)
+	if err != nil {
+		return nil, err
+	}
+	return listenFunc.WithoutContext(), nil
+}
+
+func (p *PacketConnImplementation) ServerContext(addr string, parameters utils.Parameters) (types.PacketConnContextFunc, error) {
+	afterListen := WrapAfterConnectHooksFunc(p.afterListenHook, parameters)
+	relistener := WrapPacketConnContextFunc(p.listenFunc, p.network, addr)
+	return func(ctx context.Context) (types.PacketConn, error) {
+		conn, err := p.listenFunc(ctx, p.network, addr)
 		if err != nil {
 			return nil, err
 		}
-		afterDial(conn)
-		return WrapConn(conn, nil, dialer, afterDial), nil
+		afterListen(conn)
+		return WrapConn(conn, nil, relistener, afterListen), nil
 	}, nil
 }
 
 func (p *PacketConnImplementation) Client(addr string, parameters utils.Parameters) (types.PacketConnFunc, error) {
+	dialFunc, err := p.ClientContext(addr, parameters)
+	if err != nil {
+		return nil, err
+	}
+	return dialFunc.WithoutContext(), nil
+}
+
+func (p *PacketConnImplementation) ClientContext(addr string, parameters utils.Parameters) (types.PacketConnContextFunc, error) {
 	afterDial := WrapAfterConnectHooksFunc(p.afterDialHook, parameters)
 	remoteAddr, err := p.resolveFunc(p.network, addr)
 	if err != nil {
 		return nil, err
 	}
-	dialer := WrapPacketConnFunc(p.dialFunc, p.network, remoteAddr.String())
-	return func() (types.PacketConn, error) {
-		conn, err := dialer()
+	// redialing happens later, outside the lifetime of dial context.
+	redialer := WrapPacketConnContextFunc(p.dialFunc, p.network, remoteAddr.String())
+	return func(ctx context.Context) (types.PacketConn, error) {
+		conn, err := p.dialFunc(ctx, p.network, remoteAddr.String())
 		if err != nil {
 			return nil, err
 		}
 		afterDial(conn)
-		return WrapConn(conn, remoteAddr, dialer, afterDial), nil
+		return WrapConn(conn, remoteAddr, redialer, afterDial), nil
 	}, nil
 }
 
@@ -67,6 +87,23 @@ func WrapPacketConnFunc(dialFunc StandardPacketConnFunc, network string, addr st
 	}
 }
 
+func WrapPacketConnContextFunc(dialFunc StandardPacketConnContextFunc, network string, addr string) StandardPrimedPacketConnFunc {
+	return func() (net.PacketConn, error) {
+		return dialFunc(context.Background(), network, addr)
+	}
+}
+
+// PacketConnContextAdapter makes a function without context support usable where a context is expected. As creating
+// a packet conn doesn't block, it only refuses to proceed if ctx is already done.
+func PacketConnContextAdapter(connFunc StandardPacketConnFunc) StandardPacketConnContextFunc {
+	return func(ctx context.Context, network, addr string) (net.PacketConn, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return connFunc(network, addr)
+	}
+}
+
 func WrapAfterConnectHooksFunc(hook *utils.Hook[AfterConnectHookFunc], parameters utils.Parameters) WrappedHookFunc {
 	return func(conn net.PacketConn) {
 		if hook != nil {
@@ -87,6 +124,10 @@ func callHookFuncs(hook *utils.Hook[AfterConnectHookFunc], conn net.PacketConn,
 }
 
 func WrapImplementation(network string, dialFunc, listenFunc StandardPacketConnFunc, resolveFunc StandardResolveFunc) *PacketConnImplementation {
+	return WrapContextImplementation(network, PacketConnContextAdapter(dialFunc), PacketConnContextAdapter(listenFunc), resolveFunc)
+}
+
+func WrapContextImplementation(network string, dialFunc, listenFunc StandardPacketConnContextFunc, resolveFunc StandardResolveFunc) *PacketConnImplementation {
 	return &PacketConnImplementation{
 		network:         network,
 		dialFunc:        dialFunc,
@@ -0,0 +1,160 @@
+package stream
+
+import (
+	"github.com/hadi77ir/muxedsocket/utils"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type ioResult struct {
+	data []byte
+	n    int
+	err  error
+}
+
+// DeadlineConn gives deadlines to a connection that doesn't support them, or whose own deadlines are better left
+// alone. Reads and writes of the connection happen in background, so the ones that time out keep going there: data of
+// a timed out read is returned by the next Read, and a timed out write leaves the connection unable to write, as with
+// tls.Conn. Once Passthrough is called, the connection is used as is.
+type DeadlineConn struct {
+	net.Conn
+	closed      chan struct{}
+	closeOnce   sync.Once
+	passthrough atomic.Bool
+
+	readMutex    sync.Mutex
+	readDeadline *utils.Deadline
+	pendingRead  chan ioResult
+	leftover     []byte
+	readErr      error
+
+	writeMutex    sync.Mutex
+	writeDeadline *utils.Deadline
+	writeErr      error
+}
+
+var _ net.Conn = &DeadlineConn{}
+
+func WrapDeadlineConn(conn net.Conn) *DeadlineConn {
+	return &DeadlineConn{
+		Conn:          conn,
+		closed:        make(chan struct{}),
+		readDeadline:  utils.NewDeadline(),
+		writeDeadline: utils.NewDeadline(),
+	}
+}
+
+// Passthrough stops giving deadlines of its own, for when the one that needed them is done with the connection.
+// Reads that were left in background are still returned first.
+func (c *DeadlineConn) Passthrough() {
+	c.passthrough.Store(true)
+}
+
+func (c *DeadlineConn) Read(b []byte) (int, error) {
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
+	if len(c.leftover) > 0 {
+		n := copy(b, c.leftover)
+		c.leftover = c.leftover[n:]
+		return n, nil
+	}
+	if c.readErr != nil {
+		err := c.readErr
+		c.readErr = nil
+		return 0, err
+	}
+	if c.pendingRead == nil && c.passthrough.Load() {
+		return c.Conn.Read(b)
+	}
+	if c.pendingRead == nil {
+		pending := make(chan ioResult, 1)
+		buffer := make([]byte, len(b))
+		go func() {
+			n, err := c.Conn.Read(buffer)
+			pending <- ioResult{data: buffer[:n], err: err}
+		}()
+		c.pendingRead = pending
+	}
+	select {
+	case result := <-c.pendingRead:
+		c.pendingRead = nil
+		n := copy(b, result.data)
+		c.leftover = result.data[n:]
+		if len(c.leftover) > 0 {
+			// error comes after the rest of data.
+			c.readErr = result.err
+			return n, nil
+		}
+		return n, result.err
+	case <-c.readDeadline.Done():
+		return 0, os.ErrDeadlineExceeded
+	case <-c.closed:
+		return 0, net.ErrClosed
+	}
+}
+
+func (c *DeadlineConn) Write(b []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if c.writeErr != nil {
+		return 0, c.writeErr
+	}
+	if c.passthrough.Load() {
+		return c.Conn.Write(b)
+	}
+	pending := make(chan ioResult, 1)
+	// b may be reused by caller once Write times out.
+	data := append([]byte(nil), b...)
+	go func() {
+		n, err := c.Conn.Write(data)
+		pending <- ioResult{n: n, err: err}
+	}()
+	select {
+	case result := <-pending:
+		return result.n, result.err
+	case <-c.writeDeadline.Done():
+		c.writeErr = os.ErrDeadlineExceeded
+		return 0, c.writeErr
+	case <-c.closed:
+		return 0, net.ErrClosed
+	}
+}
+
+func (c *DeadlineConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		err = c.Conn.Close()
+	})
+	return err
+}
+
+func (c *DeadlineConn) SetDeadline(t time.Time) error {
+	c.readDeadline.Set(t)
+	c.writeDeadline.Set(t)
+	if c.passthrough.Load() {
+		return c.Conn.SetDeadline(t)
+	}
+	return nil
+}
+
+// SetReadDeadline sets deadline of reads. After Passthrough, it is also set on the connection, as a read left in
+// background may still be waited for.
+func (c *DeadlineConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Set(t)
+	if c.passthrough.Load() {
+		return c.Conn.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (c *DeadlineConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.Set(t)
+	if c.passthrough.Load() {
+		return c.Conn.SetWriteDeadline(t)
+	}
+	return nil
+}
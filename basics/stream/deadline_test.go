@@ -0,0 +1,89 @@
+package stream
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDeadlineConnRead(t *testing.T) {
+	local, remote := net.Pipe()
+	conn := WrapDeadlineConn(local)
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	buf := make([]byte, 8)
+	if _, err := conn.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatal(err)
+	}
+
+	// data of the read that timed out is not lost.
+	go func() {
+		_, _ = remote.Write([]byte("data"))
+	}()
+	_ = conn.SetReadDeadline(time.Time{})
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "data" {
+		t.Fatal(string(buf[:n]), err)
+	}
+}
+
+func TestDeadlineConnWrite(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+	conn := WrapDeadlineConn(local)
+	defer conn.Close()
+
+	// nothing reads from remote.
+	_ = conn.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := conn.Write([]byte("data")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatal(err)
+	}
+	_ = conn.SetWriteDeadline(time.Time{})
+	if _, err := conn.Write([]byte("data")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatal("write succeeded after one timed out:", err)
+	}
+}
+
+func TestDeadlineConnPassthrough(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+	conn := WrapDeadlineConn(local)
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	buf := make([]byte, 8)
+	if _, err := conn.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	conn.Passthrough()
+
+	// the read left in background comes first, then reads go to local.
+	go func() {
+		_, _ = remote.Write([]byte("data"))
+		_, _ = remote.Write([]byte("more"))
+	}()
+	for _, expected := range []string{"data", "more"} {
+		n, err := conn.Read(buf)
+		if err != nil || string(buf[:n]) != expected {
+			t.Fatal(string(buf[:n]), err)
+		}
+	}
+	if conn.pendingRead != nil {
+		t.Fatal("read went to background after passthrough")
+	}
+
+	go func() {
+		_, _ = remote.Read(buf)
+	}()
+	if _, err := conn.Write([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := conn.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,99 @@
+package stream
+
+import (
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// FromConn wraps an existing connection into a dial function. Connection is given out only once, as it can't be
+// redialed; later calls fail with muxedsocket.ErrConnAlreadyUsed.
+func FromConn(conn net.Conn) types.StreamDialFunc {
+	var used atomic.Bool
+	return func() (types.StreamConn, error) {
+		if used.Swap(true) {
+			return nil, muxedsocket.ErrConnAlreadyUsed
+		}
+		return WrapConn(conn, nil, nil), nil
+	}
+}
+
+// FromListener wraps an existing listener into a listen function. Like FromConn, it may only be used once.
+func FromListener(listener net.Listener) types.StreamListenFunc {
+	var used atomic.Bool
+	return func() (types.StreamListener, error) {
+		if used.Swap(true) {
+			return nil, muxedsocket.ErrConnAlreadyUsed
+		}
+		return WrapListener(listener, nil), nil
+	}
+}
+
+// FromAcceptedConn wraps an already accepted connection into a listen function, so server side of layers may run
+// over it. The listener gives out the connection once, then blocks until it is closed.
+func FromAcceptedConn(conn net.Conn) types.StreamListenFunc {
+	return FromListener(newSingleConnListener(conn))
+}
+
+type singleConnListener struct {
+	conns     chan net.Conn
+	addr      net.Addr
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newSingleConnListener(conn net.Conn) *singleConnListener {
+	conns := make(chan net.Conn, 1)
+	conns <- conn
+	return &singleConnListener{conns: conns, addr: conn.LocalAddr(), closed: make(chan struct{})}
+}
+
+func (l *singleConnListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *singleConnListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *singleConnListener) Addr() net.Addr {
+	return l.addr
+}
+
+// InjectedImplementation is a transport that ignores address and gives out the functions it was created with.
+type InjectedImplementation struct {
+	dialFunc   types.StreamDialFunc
+	listenFunc types.StreamListenFunc
+}
+
+func (i *InjectedImplementation) Server(addr string, parameters utils.Parameters) (types.StreamListenFunc, error) {
+	if i.listenFunc == nil {
+		return nil, muxedsocket.ErrOpNotSupported
+	}
+	return i.listenFunc, nil
+}
+
+func (i *InjectedImplementation) Client(addr string, parameters utils.Parameters) (types.StreamDialFunc, error) {
+	if i.dialFunc == nil {
+		return nil, muxedsocket.ErrOpNotSupported
+	}
+	return i.dialFunc, nil
+}
+
+var _ types.StreamConnImplementation = &InjectedImplementation{}
+
+// WrapInjected creates a transport out of given functions. Either of them may be nil if that side is not needed.
+func WrapInjected(dialFunc types.StreamDialFunc, listenFunc types.StreamListenFunc) *InjectedImplementation {
+	return &InjectedImplementation{dialFunc: dialFunc, listenFunc: listenFunc}
+}
@@ -1,12 +1,9 @@
 package stream
 
-import (
-	"github.com/hadi77ir/muxedsocket/types"
-	"net"
-)
+import "github.com/hadi77ir/muxedsocket/types"
 
 func NewTCPImplementation() types.StreamConnImplementation {
-	impl := WrapStandardImplementation("tcp", net.DialTimeout, net.Listen)
+	impl := WrapStandardContextImplementation("tcp", DialTimeoutContext, ListenContext)
 	AddKeepAliveHook(impl)
 	return impl
 }
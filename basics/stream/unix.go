@@ -1,10 +1,7 @@
 package stream
 
-import (
-	"github.com/hadi77ir/muxedsocket/types"
-	"net"
-)
+import "github.com/hadi77ir/muxedsocket/types"
 
 func NewUnixSocketImplementation() types.StreamConnImplementation {
-	return WrapStandardImplementation("unix", net.DialTimeout, net.Listen)
+	return WrapStandardContextImplementation("unix", DialTimeoutContext, ListenContext)
 }
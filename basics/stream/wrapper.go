@@ -1,50 +1,75 @@
 package stream
 
 import (
+	"context"
 	"github.com/hadi77ir/muxedsocket"
 	"github.com/hadi77ir/muxedsocket/types"
 	"github.com/hadi77ir/muxedsocket/utils"
 	"net"
+	"sync"
 	"time"
 )
 
 type StandardDialFunc func(network, addr string) (net.Conn, error)
 type StandardDialTimeoutFunc func(network, addr string, timeout time.Duration) (net.Conn, error)
+type StandardDialContextFunc func(ctx context.Context, network, addr string, timeout time.Duration) (net.Conn, error)
 type StandardListenFunc func(network, addr string) (net.Listener, error)
+type StandardListenContextFunc func(ctx context.Context, network, addr string) (net.Listener, error)
 type StandardPrimedDialFunc func() (net.Conn, error)
+type StandardPrimedDialContextFunc func(ctx context.Context) (net.Conn, error)
 type AfterConnectHookFunc func(conn net.Conn, parameters utils.Parameters)
 type WrappedHookFunc func(conn net.Conn)
 
 type NetConnImplementation struct {
-	dialFunc        StandardDialTimeoutFunc
-	listenFunc      StandardListenFunc
+	dialFunc        StandardDialContextFunc
+	listenFunc      StandardListenContextFunc
 	network         string
 	afterDialHook   *utils.Hook[AfterConnectHookFunc]
 	afterAcceptHook *utils.Hook[AfterConnectHookFunc]
 }
 
 var _ types.StreamConnImplementation = &NetConnImplementation{}
+var _ types.StreamConnContextImplementation = &NetConnImplementation{}
 
 func (n *NetConnImplementation) Server(addr string, parameters utils.Parameters) (types.StreamListenFunc, error) {
-	return func() (types.StreamListener, error) {
-		listener, err := n.listenFunc(n.network, addr)
+	listenFunc, err := n.ServerContext(addr, parameters)
+	if err != nil {
+		return nil, err
+	}
+	return listenFunc.WithoutContext(), nil
+}
+
+func (n *NetConnImplementation) ServerContext(addr string, parameters utils.Parameters) (types.StreamListenContextFunc, error) {
+	afterAccept := WrapAfterConnectHooksFunc(n.afterAcceptHook, parameters)
+	return func(ctx context.Context) (types.StreamListener, error) {
+		listener, err := n.listenFunc(ctx, n.network, addr)
 		if err != nil {
 			return nil, err
 		}
-		return WrapListener(listener, WrapAfterConnectHooksFunc(n.afterAcceptHook, parameters)), err
+		return WrapListener(listener, afterAccept), nil
 	}, nil
 }
 
 func (n *NetConnImplementation) Client(addr string, parameters utils.Parameters) (types.StreamDialFunc, error) {
-	dialer := WrapDialTimeoutFunc(n.dialFunc, n.network, addr, utils.DurationFromParameters(parameters, muxedsocket.ParamDialTimeout, muxedsocket.DefaultDialTimeout))
+	dialFunc, err := n.ClientContext(addr, parameters)
+	if err != nil {
+		return nil, err
+	}
+	return dialFunc.WithoutContext(), nil
+}
+
+func (n *NetConnImplementation) ClientContext(addr string, parameters utils.Parameters) (types.StreamDialContextFunc, error) {
+	timeout := utils.DurationFromParameters(parameters, muxedsocket.ParamDialTimeout, muxedsocket.DefaultDialTimeout)
+	// redialing happens later, outside the lifetime of dial context.
+	redialer := WrapDialContextFunc(n.dialFunc, n.network, addr, timeout)
 	afterDial := WrapAfterConnectHooksFunc(n.afterDialHook, parameters)
-	return func() (types.StreamConn, error) {
-		conn, err := dialer()
+	return func(ctx context.Context) (types.StreamConn, error) {
+		conn, err := n.dialFunc(ctx, n.network, addr, timeout)
 		if err != nil {
 			return nil, err
 		}
 		afterDial(conn)
-		return WrapConn(conn, dialer, afterDial), nil
+		return WrapConn(conn, redialer, afterDial), nil
 	}, nil
 }
 
@@ -81,13 +106,60 @@ func DialTimeoutAdapter(dialFunc StandardDialFunc) StandardDialTimeoutFunc {
 	}
 }
 
+// DialContextAdapter makes a dial function without context support usable where a context is expected. Deadline of
+// the context shortens the timeout, and cancelling the context stops waiting for the dial to complete.
+func DialContextAdapter(dialFunc StandardDialTimeoutFunc) StandardDialContextFunc {
+	return func(ctx context.Context, network, addr string, timeout time.Duration) (net.Conn, error) {
+		if deadline, ok := ctx.Deadline(); ok {
+			if remaining := time.Until(deadline); timeout <= 0 || remaining < timeout {
+				timeout = remaining
+			}
+		}
+		return types.AwaitWithContext[net.Conn](ctx, func() (net.Conn, error) {
+			return dialFunc(network, addr, timeout)
+		})
+	}
+}
+
+// ListenContextAdapter makes a listen function without context support usable where a context is expected.
+func ListenContextAdapter(listenFunc StandardListenFunc) StandardListenContextFunc {
+	return func(ctx context.Context, network, addr string) (net.Listener, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return listenFunc(network, addr)
+	}
+}
+
+// DialTimeoutContext dials using a net.Dialer, so the dial is aborted as soon as ctx is done.
+func DialTimeoutContext(ctx context.Context, network, addr string, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+// ListenContext listens using a net.ListenConfig.
+func ListenContext(ctx context.Context, network, addr string) (net.Listener, error) {
+	listenConfig := &net.ListenConfig{}
+	return listenConfig.Listen(ctx, network, addr)
+}
+
 func WrapDialTimeoutFunc(dialFunc StandardDialTimeoutFunc, network string, addr string, timeout time.Duration) StandardPrimedDialFunc {
 	return func() (net.Conn, error) {
 		return dialFunc(network, addr, timeout)
 	}
 }
 
+func WrapDialContextFunc(dialFunc StandardDialContextFunc, network string, addr string, timeout time.Duration) StandardPrimedDialFunc {
+	return func() (net.Conn, error) {
+		return dialFunc(context.Background(), network, addr, timeout)
+	}
+}
+
 func WrapStandardImplementation(network string, dialFunc StandardDialTimeoutFunc, listenFunc StandardListenFunc) *NetConnImplementation {
+	return WrapStandardContextImplementation(network, DialContextAdapter(dialFunc), ListenContextAdapter(listenFunc))
+}
+
+func WrapStandardContextImplementation(network string, dialFunc StandardDialContextFunc, listenFunc StandardListenContextFunc) *NetConnImplementation {
 	return &NetConnImplementation{
 		dialFunc:        dialFunc,
 		listenFunc:      listenFunc,
@@ -100,6 +172,7 @@ func WrapStandardImplementation(network string, dialFunc StandardDialTimeoutFunc
 type WrappedListener struct {
 	listener    net.Listener
 	closed      chan struct{}
+	closeOnce   sync.Once
 	afterAccept func(conn net.Conn)
 }
 
@@ -108,13 +181,10 @@ func (w *WrappedListener) CloseChan() <-chan struct{} {
 }
 
 func (w *WrappedListener) Close() error {
-	select {
-	case <-w.closed:
-		break
-	default:
+	w.closeOnce.Do(func() {
 		close(w.closed)
-	}
-	return w.Close()
+	})
+	return w.listener.Close()
 }
 
 func (w *WrappedListener) Accept() (socket types.Socket, err error) {
@@ -145,6 +215,7 @@ type WrappedConn struct {
 	net.Conn
 	dialFunc    StandardPrimedDialFunc
 	closed      chan struct{}
+	closeOnce   sync.Once
 	afterRedial WrappedHookFunc
 }
 
@@ -171,25 +242,22 @@ func (w *WrappedConn) Redial() (types.Socket, error) {
 }
 
 func (w *WrappedConn) Read(b []byte) (n int, err error) {
-	n, err = w.Read(b)
+	n, err = w.Conn.Read(b)
 	w.handleError(err)
 	return
 }
 
 func (w *WrappedConn) Write(b []byte) (n int, err error) {
-	n, err = w.Write(b)
+	n, err = w.Conn.Write(b)
 	w.handleError(err)
 	return
 }
 
 func (w *WrappedConn) Close() error {
-	select {
-	case <-w.closed:
-		break
-	default:
+	w.closeOnce.Do(func() {
 		close(w.closed)
-	}
-	return w.Close()
+	})
+	return w.Conn.Close()
 }
 
 func (w *WrappedConn) handleError(err error) {
@@ -11,19 +11,33 @@ func GetPacketDialFunc(input any, defaults *muxedsocket.DefaultLayers, commonPar
 	if packetConn, ok := input.(types.PacketConnFunc); ok {
 		return packetConn, nil
 	}
-	if streamConn, ok := input.(types.StreamDialFunc); ok {
+	packetConn, err := GetPacketDialContextFunc(input, defaults, commonParameters)
+	if err != nil {
+		return nil, err
+	}
+	return packetConn.WithoutContext(), nil
+}
+
+func GetPacketDialContextFunc(input any, defaults *muxedsocket.DefaultLayers, commonParameters utils.Parameters) (types.PacketConnContextFunc, error) {
+	input = withContext(input)
+	if packetConn, ok := input.(types.PacketConnContextFunc); ok {
+		return packetConn, nil
+	}
+	if streamConn, ok := input.(types.StreamDialContextFunc); ok {
 		// it is a streaming conn. add packets-over-streams implementation.
 		// todo: check if stream supports packet transmission. (useful for eNet)
-		return defaults.PacketAdapter.Client(streamConn, commonParameters)
+		return clientPacketAdapter(defaults.PacketAdapter, streamConn, commonParameters)
 	}
-	if muxDialer, ok := input.(types.MuxDialFunc); ok {
-		// it is a mux dialer. first demux, then packet adapter.
-		// todo: check if mux supports packet transmission. (useful for quic)
-		return defaults.PacketAdapter.Client(demuxer.DemuxDialer(muxDialer, commonParameters), commonParameters)
+	if muxDialer, ok := input.(types.MuxDialContextFunc); ok {
+		// it is a mux dialer. use its datagrams if it supports them, otherwise demux and add packet adapter.
+		fallback := func(streams types.StreamDialContextFunc) (types.PacketConnContextFunc, error) {
+			return clientPacketAdapter(defaults.PacketAdapter, streams, commonParameters)
+		}
+		return demuxer.DatagramDialContext(muxDialer, fallback, commonParameters), nil
 	}
 	if addr, ok := input.(string); ok {
 		// call default stream transport
-		return defaults.PacketConn.Client(addr, commonParameters)
+		return clientPacketConn(defaults.PacketConn, addr, commonParameters)
 	}
 	return nil, muxedsocket.ErrInvalidChainingResult
 }
@@ -32,32 +46,55 @@ func GetStreamDialFunc(input any, defaults *muxedsocket.DefaultLayers, commonPar
 	if streamDialer, ok := input.(types.StreamDialFunc); ok {
 		return streamDialer, nil
 	}
-	if muxDialer, ok := input.(types.MuxDialFunc); ok {
+	streamDialer, err := GetStreamDialContextFunc(input, defaults, commonParameters)
+	if err != nil {
+		return nil, err
+	}
+	return streamDialer.WithoutContext(), nil
+}
+
+func GetStreamDialContextFunc(input any, defaults *muxedsocket.DefaultLayers, commonParameters utils.Parameters) (types.StreamDialContextFunc, error) {
+	input = withContext(input)
+	if streamDialer, ok := input.(types.StreamDialContextFunc); ok {
+		return streamDialer, nil
+	}
+	if muxDialer, ok := input.(types.MuxDialContextFunc); ok {
 		// it is a mux dialer. so demux.
-		return demuxer.DemuxDialer(muxDialer, commonParameters), nil
+		return demuxer.DemuxDialContext(muxDialer, commonParameters), nil
 	}
-	if packetConn, ok := input.(types.PacketConnFunc); ok {
+	if packetConn, ok := input.(types.PacketConnContextFunc); ok {
 		// it is a packetConn. add stream-over-packets implementation.
-		return defaults.StreamAdapter.Client(packetConn, commonParameters)
+		return clientStreamAdapter(defaults.StreamAdapter, packetConn, commonParameters)
 	}
 	if addr, ok := input.(string); ok {
 		// call default stream transport
-		return defaults.StreamConn.Client(addr, commonParameters)
+		return clientStreamConn(defaults.StreamConn, addr, commonParameters)
 	}
 	return nil, muxedsocket.ErrInvalidChainingResult
 }
 
 func GetMuxDialFunc(input any, defaults *muxedsocket.DefaultLayers, commonParameters utils.Parameters) (types.MuxDialFunc, error) {
 	if muxDialer, ok := input.(types.MuxDialFunc); ok {
-		// it is a mux dialer. so demux.
 		return muxDialer, nil
 	}
-	if streamDialer, ok := input.(types.StreamDialFunc); ok {
-		return defaults.StreamSolution.Client(streamDialer, commonParameters)
+	muxDialer, err := GetMuxDialContextFunc(input, defaults, commonParameters)
+	if err != nil {
+		return nil, err
 	}
-	if packetConn, ok := input.(types.PacketConnFunc); ok {
+	return muxDialer.WithoutContext(), nil
+}
+
+func GetMuxDialContextFunc(input any, defaults *muxedsocket.DefaultLayers, commonParameters utils.Parameters) (types.MuxDialContextFunc, error) {
+	input = withContext(input)
+	if muxDialer, ok := input.(types.MuxDialContextFunc); ok {
+		return muxDialer, nil
+	}
+	if streamDialer, ok := input.(types.StreamDialContextFunc); ok {
+		return clientStreamSolution(defaults.StreamSolution, streamDialer, commonParameters)
+	}
+	if packetConn, ok := input.(types.PacketConnContextFunc); ok {
 		// it is a packetConn. add stream-over-packets implementation.
-		return defaults.PacketSolution.Client(packetConn, commonParameters)
+		return clientPacketSolution(defaults.PacketSolution, packetConn, commonParameters)
 	}
 	return nil, muxedsocket.ErrInvalidChainingResult
 }
@@ -66,11 +103,23 @@ func GetMuxListenFunc(input any, defaults *muxedsocket.DefaultLayers, commonPara
 	if muxListen, ok := input.(types.MuxListenFunc); ok {
 		return muxListen, nil
 	}
-	if streamListen, ok := input.(types.StreamListenFunc); ok {
-		return defaults.StreamSolution.Server(streamListen, commonParameters)
+	muxListen, err := GetMuxListenContextFunc(input, defaults, commonParameters)
+	if err != nil {
+		return nil, err
 	}
-	if packetConn, ok := input.(types.PacketConnFunc); ok {
-		return defaults.PacketSolution.Server(packetConn, commonParameters)
+	return muxListen.WithoutContext(), nil
+}
+
+func GetMuxListenContextFunc(input any, defaults *muxedsocket.DefaultLayers, commonParameters utils.Parameters) (types.MuxListenContextFunc, error) {
+	input = withContext(input)
+	if muxListen, ok := input.(types.MuxListenContextFunc); ok {
+		return muxListen, nil
+	}
+	if streamListen, ok := input.(types.StreamListenContextFunc); ok {
+		return serverStreamSolution(defaults.StreamSolution, streamListen, commonParameters)
+	}
+	if packetConn, ok := input.(types.PacketConnContextFunc); ok {
+		return serverPacketSolution(defaults.PacketSolution, packetConn, commonParameters)
 	}
 	return nil, muxedsocket.ErrInvalidChainingResult
 }
@@ -79,11 +128,27 @@ func GetStreamListenFunc(input any, defaults *muxedsocket.DefaultLayers, commonP
 	if streamListen, ok := input.(types.StreamListenFunc); ok {
 		return streamListen, nil
 	}
-	if muxListen, ok := input.(types.MuxListenFunc); ok {
-		return demuxer.DemuxListener(muxListen, commonParameters), nil
+	streamListen, err := GetStreamListenContextFunc(input, defaults, commonParameters)
+	if err != nil {
+		return nil, err
 	}
-	if packetConn, ok := input.(types.PacketConnFunc); ok {
-		return defaults.StreamAdapter.Server(packetConn, commonParameters)
+	return streamListen.WithoutContext(), nil
+}
+
+func GetStreamListenContextFunc(input any, defaults *muxedsocket.DefaultLayers, commonParameters utils.Parameters) (types.StreamListenContextFunc, error) {
+	input = withContext(input)
+	if streamListen, ok := input.(types.StreamListenContextFunc); ok {
+		return streamListen, nil
+	}
+	if muxListen, ok := input.(types.MuxListenContextFunc); ok {
+		return demuxer.DemuxListenContext(muxListen, commonParameters), nil
+	}
+	if packetConn, ok := input.(types.PacketConnContextFunc); ok {
+		return serverStreamAdapter(defaults.StreamAdapter, packetConn, commonParameters)
+	}
+	if addr, ok := input.(string); ok {
+		// call default stream transport
+		return serverStreamConn(defaults.StreamConn, addr, commonParameters)
 	}
 	return nil, muxedsocket.ErrInvalidChainingResult
 }
@@ -92,13 +157,32 @@ func GetPacketListenFunc(input any, defaults *muxedsocket.DefaultLayers, commonP
 	if packetConn, ok := input.(types.PacketConnFunc); ok {
 		return packetConn, nil
 	}
-	if muxListen, ok := input.(types.MuxListenFunc); ok {
-		// todo: check if stream supports packet transmission. (useful for eNet)
-		return defaults.PacketAdapter.Server(demuxer.DemuxListener(muxListen, commonParameters), commonParameters)
+	packetConn, err := GetPacketListenContextFunc(input, defaults, commonParameters)
+	if err != nil {
+		return nil, err
 	}
-	if streamListen, ok := input.(types.StreamListenFunc); ok {
+	return packetConn.WithoutContext(), nil
+}
+
+func GetPacketListenContextFunc(input any, defaults *muxedsocket.DefaultLayers, commonParameters utils.Parameters) (types.PacketConnContextFunc, error) {
+	input = withContext(input)
+	if packetConn, ok := input.(types.PacketConnContextFunc); ok {
+		return packetConn, nil
+	}
+	if muxListen, ok := input.(types.MuxListenContextFunc); ok {
+		// sessions supporting datagrams use them, streams of the rest go through packet adapter.
+		fallback := func(streams types.StreamListenContextFunc) (types.PacketConnContextFunc, error) {
+			return serverPacketAdapter(defaults.PacketAdapter, streams, commonParameters)
+		}
+		return demuxer.DatagramListenContext(muxListen, fallback, commonParameters), nil
+	}
+	if streamListen, ok := input.(types.StreamListenContextFunc); ok {
 		// todo: check if stream supports packet transmission. (useful for eNet)
-		return defaults.PacketAdapter.Server(streamListen, commonParameters)
+		return serverPacketAdapter(defaults.PacketAdapter, streamListen, commonParameters)
+	}
+	if addr, ok := input.(string); ok {
+		// call default packet transport
+		return serverPacketConn(defaults.PacketConn, addr, commonParameters)
 	}
 	return nil, muxedsocket.ErrInvalidChainingResult
 }
@@ -0,0 +1,257 @@
+// Package chain builds chains of layers in code, as an alternative to URIs. Layers are added bottom-up, and may be
+// live implementations configured with Go values instead of string parameters:
+//
+//	socket, err := chain.New().TCP("example.com:443", nil).TLS(config).Muxer("smux").Dial()
+package chain
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/basics/packet"
+	"github.com/hadi77ir/muxedsocket/basics/stream"
+	"github.com/hadi77ir/muxedsocket/chaining"
+	mstls "github.com/hadi77ir/muxedsocket/tls"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"net"
+	"time"
+)
+
+// TCPOptions configures the TCP transport. Zero value uses the defaults that the "tcp" scheme uses.
+type TCPOptions struct {
+	// Dialer is copied for each dial. Its Timeout is taken from "timeout" parameter if not set.
+	Dialer *net.Dialer
+	// ListenConfig is used for listening.
+	ListenConfig *net.ListenConfig
+	// DisableKeepAliveHook stops "keepalive" parameter from being applied to connections.
+	DisableKeepAliveHook bool
+}
+
+type Builder struct {
+	creators   *muxedsocket.Creators
+	defaults   *muxedsocket.DefaultLayers
+	addr       string
+	layers     []*chaining.Layer // bottom-up
+	parameters utils.Parameters
+	err        error
+}
+
+// New creates a builder that resolves names and defaults using global creators.
+func New() *Builder {
+	return NewWithRegistry(muxedsocket.GlobalCreators())
+}
+
+func NewWithRegistry(creators *muxedsocket.Creators) *Builder {
+	return &Builder{
+		creators:   creators,
+		defaults:   muxedsocket.GetDefaults(creators),
+		parameters: make(utils.Parameters),
+	}
+}
+
+// Defaults overrides the defaults used for filling gaps between layers.
+func (b *Builder) Defaults(defaults *muxedsocket.DefaultLayers) *Builder {
+	b.defaults = defaults
+	return b
+}
+
+// Param sets a common parameter, passed to every layer.
+func (b *Builder) Param(key, value string) *Builder {
+	b.parameters[key] = value
+	return b
+}
+
+// Addr sets the address passed to the transport. Transport methods like TCP set it as well.
+func (b *Builder) Addr(addr string) *Builder {
+	b.addr = addr
+	return b
+}
+
+// Implementation adds a live implementation of given layer type on top of the chain. Parameters are bound to this
+// layer only, and may be nil.
+func (b *Builder) Implementation(layerType chaining.LayerType, name string, impl any, parameters utils.Parameters) *Builder {
+	index := 0
+	for _, layer := range b.layers {
+		if layer.ImplementationName == name {
+			index++
+		}
+	}
+	b.layers = append(b.layers, &chaining.Layer{
+		LayerType:          layerType,
+		ImplementationName: name,
+		Implementation:     impl,
+		ParametersIndex:    index,
+		Parameters:         parameters,
+	})
+	return b
+}
+
+// Layer adds a registered implementation on top of the chain, looked up by name as in schemes.
+func (b *Builder) Layer(name string, parameters utils.Parameters) *Builder {
+	resolved := chaining.ResolveLayer(b.creators, name, 0, true)
+	if resolved == nil {
+		return b.fail(muxedsocket.ErrSchemeNotSupported)
+	}
+	return b.Implementation(resolved.LayerType, name, resolved.Implementation, parameters)
+}
+
+// Muxer adds a registered stream or packet solution on top of the chain.
+func (b *Builder) Muxer(name string) *Builder {
+	return b.MuxerWithParameters(name, nil)
+}
+
+func (b *Builder) MuxerWithParameters(name string, parameters utils.Parameters) *Builder {
+	resolved := chaining.ResolveLayer(b.creators, name, 0, true)
+	if resolved == nil || !chaining.IsMuxerLayer(resolved.LayerType) {
+		return b.fail(muxedsocket.ErrSchemeNotSupported)
+	}
+	return b.Implementation(resolved.LayerType, name, resolved.Implementation, parameters)
+}
+
+// TCP adds a TCP transport at the bottom of the chain. options may be nil.
+func (b *Builder) TCP(addr string, options *TCPOptions) *Builder {
+	if options == nil {
+		options = &TCPOptions{}
+	}
+	dialFunc := stream.DialTimeoutContext
+	if options.Dialer != nil {
+		dialFunc = func(ctx context.Context, network, addr string, timeout time.Duration) (net.Conn, error) {
+			dialer := *options.Dialer
+			if dialer.Timeout == 0 {
+				dialer.Timeout = timeout
+			}
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+	listenFunc := stream.ListenContext
+	if options.ListenConfig != nil {
+		listenFunc = func(ctx context.Context, network, addr string) (net.Listener, error) {
+			return options.ListenConfig.Listen(ctx, network, addr)
+		}
+	}
+	impl := stream.WrapStandardContextImplementation("tcp", dialFunc, listenFunc)
+	if !options.DisableKeepAliveHook {
+		stream.AddKeepAliveHook(impl)
+	}
+	return b.transport(addr, chaining.LayerStreamConn, "tcp", impl)
+}
+
+// UDP adds a UDP transport at the bottom of the chain.
+func (b *Builder) UDP(addr string) *Builder {
+	return b.transport(addr, chaining.LayerPacketConn, "udp", packet.NewUDPImplementation())
+}
+
+// Conn adds an existing connection as transport, for dialing. Address is ignored.
+func (b *Builder) Conn(conn net.Conn) *Builder {
+	return b.injected(injectedStream(stream.FromConn(conn), nil))
+}
+
+// AcceptedConn adds an already accepted connection as transport, for listening. Address is ignored.
+func (b *Builder) AcceptedConn(conn net.Conn) *Builder {
+	return b.injected(injectedStream(nil, stream.FromAcceptedConn(conn)))
+}
+
+// Listener adds an existing listener as transport, for listening. Address is ignored.
+func (b *Builder) Listener(listener net.Listener) *Builder {
+	return b.injected(injectedStream(nil, stream.FromListener(listener)))
+}
+
+// PacketConn adds an existing packet connection as transport. remoteAddr is only used for dialing.
+func (b *Builder) PacketConn(conn net.PacketConn, remoteAddr net.Addr) *Builder {
+	connFunc := packet.FromPacketConn(conn, remoteAddr)
+	return b.injected(injectedPacket(connFunc, connFunc))
+}
+
+func (b *Builder) injected(transport *chaining.Layer) *Builder {
+	return b.transport(b.addr, transport.LayerType, transport.ImplementationName, transport.Implementation)
+}
+
+// TLS adds a TLS layer using given config as is. Parameters such as "sni" have no effect on it.
+func (b *Builder) TLS(config *tls.Config) *Builder {
+	return b.Implementation(chaining.LayerStreamObfuscator, "tls", mstls.NewTLSImplementationWithConfig(config), nil)
+}
+
+func (b *Builder) transport(addr string, layerType chaining.LayerType, name string, impl any) *Builder {
+	if len(b.layers) > 0 {
+		// transport has to be the first layer added.
+		return b.fail(muxedsocket.ErrIncompatibleChainOfLayers{Above: name, Below: b.layers[len(b.layers)-1].ImplementationName})
+	}
+	b.addr = addr
+	return b.Implementation(layerType, name, impl, nil)
+}
+
+func (b *Builder) fail(err error) *Builder {
+	if b.err == nil {
+		b.err = err
+	}
+	return b
+}
+
+// Chainer validates the chain, fills the gaps with defaults and returns a chainer for it.
+func (b *Builder) Chainer() (chaining.MuxLayersChainer, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	layers := make([]*chaining.Layer, len(b.layers))
+	for i, layer := range b.layers {
+		layers[len(layers)-1-i] = layer
+	}
+	return chaining.CreateMuxLayersChainerFromLayersWithRegistry(b.creators, b.defaults, layers)
+}
+
+func (b *Builder) DialFunc() (types.MuxDialFunc, error) {
+	chainer, err := b.Chainer()
+	if err != nil {
+		return nil, err
+	}
+	return chainer.ConstructDialFunc(b.addr, b.parameters)
+}
+
+func (b *Builder) DialContextFunc() (types.MuxDialContextFunc, error) {
+	chainer, err := b.Chainer()
+	if err != nil {
+		return nil, err
+	}
+	return chainer.ConstructDialContextFunc(b.addr, b.parameters)
+}
+
+func (b *Builder) ListenFunc() (types.MuxListenFunc, error) {
+	chainer, err := b.Chainer()
+	if err != nil {
+		return nil, err
+	}
+	return chainer.ConstructListenFunc(b.addr, b.parameters)
+}
+
+func (b *Builder) ListenContextFunc() (types.MuxListenContextFunc, error) {
+	chainer, err := b.Chainer()
+	if err != nil {
+		return nil, err
+	}
+	return chainer.ConstructListenContextFunc(b.addr, b.parameters)
+}
+
+func (b *Builder) Dial() (types.MuxedSocket, error) {
+	return b.DialContext(context.Background())
+}
+
+func (b *Builder) DialContext(ctx context.Context) (types.MuxedSocket, error) {
+	dialFunc, err := b.DialContextFunc()
+	if err != nil {
+		return nil, err
+	}
+	return dialFunc(ctx)
+}
+
+func (b *Builder) Listen() (types.MuxedListener, error) {
+	return b.ListenContext(context.Background())
+}
+
+func (b *Builder) ListenContext(ctx context.Context) (types.MuxedListener, error) {
+	listenFunc, err := b.ListenContextFunc()
+	if err != nil {
+		return nil, err
+	}
+	return listenFunc(ctx)
+}
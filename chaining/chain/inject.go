@@ -0,0 +1,134 @@
+package chain
+
+import (
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/basics/packet"
+	"github.com/hadi77ir/muxedsocket/basics/stream"
+	"github.com/hadi77ir/muxedsocket/chaining"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"net"
+	"net/url"
+)
+
+// names given to injected transports, as seen in Explain and errors.
+const (
+	injectedStreamName = "conn"
+	injectedPacketName = "packetconn"
+)
+
+func chainerOver(creators *muxedsocket.Creators, parsed *url.URL, transport *chaining.Layer) (chaining.MuxLayersChainer, utils.Parameters, error) {
+	chainer, err := chaining.CreateMuxLayersChainerOver(creators, muxedsocket.GetDefaults(creators), muxedsocket.GetSchemeParts(parsed.Scheme), transport)
+	if err != nil {
+		return nil, nil, err
+	}
+	return chainer, utils.ParametersFromURL(parsed.Query()), nil
+}
+
+func dialOver(creators *muxedsocket.Creators, uri string, transport *chaining.Layer) (types.MuxedSocket, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	chainer, parameters, err := chainerOver(creators, parsed, transport)
+	if err != nil {
+		return nil, err
+	}
+	dialFunc, err := chainer.ConstructDialFunc(parsed.Host, parameters)
+	if err != nil {
+		return nil, err
+	}
+	return dialFunc()
+}
+
+func listenOver(creators *muxedsocket.Creators, uri string, transport *chaining.Layer) (types.MuxedListener, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	chainer, parameters, err := chainerOver(creators, parsed, transport)
+	if err != nil {
+		return nil, err
+	}
+	listenFunc, err := chainer.ConstructListenFunc(parsed.Host, parameters)
+	if err != nil {
+		return nil, err
+	}
+	return listenFunc()
+}
+
+func injectedStream(dialFunc types.StreamDialFunc, listenFunc types.StreamListenFunc) *chaining.Layer {
+	return &chaining.Layer{
+		LayerType:          chaining.LayerStreamConn,
+		ImplementationName: injectedStreamName,
+		Implementation:     stream.WrapInjected(dialFunc, listenFunc),
+	}
+}
+
+func injectedPacket(dialFunc types.PacketConnFunc, listenFunc types.PacketConnFunc) *chaining.Layer {
+	return &chaining.Layer{
+		LayerType:          chaining.LayerPacketConn,
+		ImplementationName: injectedPacketName,
+		Implementation:     packet.WrapInjected(dialFunc, listenFunc),
+	}
+}
+
+// DialURIOverConnWithRegistry applies layers of the URI's scheme on top of an existing connection, in place of the
+// transport. Host part of the URI is ignored.
+func DialURIOverConnWithRegistry(creators *muxedsocket.Creators, conn net.Conn, uri string) (types.MuxedSocket, error) {
+	return dialOver(creators, uri, injectedStream(stream.FromConn(conn), nil))
+}
+
+func DialURIOverConn(conn net.Conn, uri string) (types.MuxedSocket, error) {
+	return DialURIOverConnWithRegistry(muxedsocket.GlobalCreators(), conn, uri)
+}
+
+// DialURIOverPacketConnWithRegistry is like DialURIOverConnWithRegistry for packet connections. Packets are sent to
+// the remote address of conn if it is connected, otherwise to the host part of the URI.
+func DialURIOverPacketConnWithRegistry(creators *muxedsocket.Creators, conn net.PacketConn, uri string) (types.MuxedSocket, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	var remoteAddr net.Addr
+	if connected, ok := conn.(interface{ RemoteAddr() net.Addr }); ok && connected.RemoteAddr() != nil {
+		remoteAddr = connected.RemoteAddr()
+	} else {
+		remoteAddr, err = net.ResolveUDPAddr("udp", parsed.Host)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dialOver(creators, uri, injectedPacket(packet.FromPacketConn(conn, remoteAddr), nil))
+}
+
+func DialURIOverPacketConn(conn net.PacketConn, uri string) (types.MuxedSocket, error) {
+	return DialURIOverPacketConnWithRegistry(muxedsocket.GlobalCreators(), conn, uri)
+}
+
+// ListenURIOnListenerWithRegistry applies server side of the URI's layers on top of an existing listener.
+func ListenURIOnListenerWithRegistry(creators *muxedsocket.Creators, listener net.Listener, uri string) (types.MuxedListener, error) {
+	return listenOver(creators, uri, injectedStream(nil, stream.FromListener(listener)))
+}
+
+func ListenURIOnListener(listener net.Listener, uri string) (types.MuxedListener, error) {
+	return ListenURIOnListenerWithRegistry(muxedsocket.GlobalCreators(), listener, uri)
+}
+
+// ListenURIOnConnWithRegistry applies server side of the URI's layers on top of a single, already accepted connection.
+func ListenURIOnConnWithRegistry(creators *muxedsocket.Creators, conn net.Conn, uri string) (types.MuxedListener, error) {
+	return listenOver(creators, uri, injectedStream(nil, stream.FromAcceptedConn(conn)))
+}
+
+func ListenURIOnConn(conn net.Conn, uri string) (types.MuxedListener, error) {
+	return ListenURIOnConnWithRegistry(muxedsocket.GlobalCreators(), conn, uri)
+}
+
+// ListenURIOnPacketConnWithRegistry applies server side of the URI's layers on top of an existing packet connection.
+func ListenURIOnPacketConnWithRegistry(creators *muxedsocket.Creators, conn net.PacketConn, uri string) (types.MuxedListener, error) {
+	return listenOver(creators, uri, injectedPacket(nil, packet.FromPacketConn(conn, nil)))
+}
+
+func ListenURIOnPacketConn(conn net.PacketConn, uri string) (types.MuxedListener, error) {
+	return ListenURIOnPacketConnWithRegistry(muxedsocket.GlobalCreators(), conn, uri)
+}
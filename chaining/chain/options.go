@@ -0,0 +1,402 @@
+package chain
+
+import (
+	"crypto/tls"
+	"github.com/hadi77ir/muxedsocket/arq"
+	"github.com/hadi77ir/muxedsocket/chaining"
+	mshttp "github.com/hadi77ir/muxedsocket/http"
+	"github.com/hadi77ir/muxedsocket/kcp"
+	"github.com/hadi77ir/muxedsocket/pos"
+	"github.com/hadi77ir/muxedsocket/quic"
+	"github.com/hadi77ir/muxedsocket/smux"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"github.com/hadi77ir/muxedsocket/yamux"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Typed options of built-in layers. Each of them stands for the parameters that the layer takes in URIs; zero fields
+// are left out, so that defaults of the layer apply. Options may be nil.
+
+type SmuxOptions struct {
+	Version          int
+	MaxFrameSize     int
+	MaxReceiveBuffer int
+	MaxStreamBuffer  int
+	// Kcptun uses defaults of kcptun.
+	Kcptun bool
+}
+
+type YamuxOptions struct {
+	AcceptBacklog      int
+	MaxStreamWindow    int
+	WriteTimeout       time.Duration
+	StreamOpenTimeout  time.Duration
+	StreamCloseTimeout time.Duration
+}
+
+type QUICOptions struct {
+	// TLS is used as is, if set. Otherwise, TLS parameters apply as usual.
+	TLS             *tls.Config
+	MaxStreams      int
+	IdleTimeout     time.Duration
+	StreamWindow    int
+	MaxStreamWindow int
+	ConnWindow      int
+	MaxConnWindow   int
+	ZeroRTT         bool
+}
+
+type KCPOptions struct {
+	// Mode is one of the presets, such as "fast".
+	Mode          string
+	SendWindow    int
+	ReceiveWindow int
+	MTU           int
+	DataShards    int
+	// ParityShards of zero keeps the default; use NoFEC to disable forward error correction.
+	ParityShards int
+	NoFEC        bool
+	AckNoDelay   bool
+	Crypt        string
+	// Key is the passphrase that key of cipher is derived from.
+	Key      string
+	Salt     string
+	Compress bool
+	// Kcptun uses defaults and wire format of kcptun.
+	Kcptun bool
+}
+
+type ARQOptions struct {
+	// Congestion is the name of a congestion control, such as "newreno" or "ledbat".
+	Congestion        string
+	TargetDelay       time.Duration
+	Window            int
+	SendBuffer        int
+	MTU               int
+	MaxMTU            int
+	DisableMTUProbing bool
+	IdleTimeout       time.Duration
+	Backlog           int
+}
+
+// HTTPOptions are shared by "http" and "h2mux". Proto is one of "http", "https", "h2c" and "h2".
+type HTTPOptions struct {
+	Proto  string
+	Host   string
+	Path   string
+	Query  string
+	Method string
+	// Headers are sent along with requests. Values can't contain commas.
+	Headers            http.Header
+	Username           string
+	Password           string
+	DisableCompression bool
+	Backlog            int
+}
+
+type WebSocketOptions struct {
+	Host  string
+	Path  string
+	Query string
+	// Headers are sent along with upgrade requests. Values can't contain commas.
+	Headers         http.Header
+	Username        string
+	Password        string
+	Subprotocols    []string
+	Origin          string
+	MaxMessageSize  int
+	EarlyData       int
+	EarlyDataHeader string
+	Backlog         int
+}
+
+// GRPCOptions are shared by "grpc" and "grpcmux". Proto is "h2c" or "h2".
+type GRPCOptions struct {
+	Proto   string
+	Host    string
+	Service string
+	RPC     string
+	// Headers are sent as metadata of calls. Values can't contain commas.
+	Headers  http.Header
+	Username string
+	Password string
+	Backlog  int
+}
+
+// PoSOptions are shared by "pos", "spos" and "pspos", as far as they apply.
+type PoSOptions struct {
+	Streams        int
+	RedialDelay    time.Duration
+	SessionTimeout time.Duration
+}
+
+// Smux adds smux on top of the chain.
+func (b *Builder) Smux(options *SmuxOptions) *Builder {
+	return b.Implementation(chaining.LayerStreamSolution, "smux", &smux.Implementation{}, options.parameters())
+}
+
+// Yamux adds yamux on top of the chain.
+func (b *Builder) Yamux(options *YamuxOptions) *Builder {
+	return b.Implementation(chaining.LayerStreamSolution, "yamux", &yamux.Implementation{}, options.parameters())
+}
+
+// QUIC adds QUIC on top of the chain.
+func (b *Builder) QUIC(options *QUICOptions) *Builder {
+	impl := &quic.Implementation{}
+	if options != nil && options.TLS != nil {
+		impl = quic.NewImplementationWithTLSConfig(options.TLS)
+	}
+	return b.Implementation(chaining.LayerPacketSolution, "quic", impl, options.parameters())
+}
+
+// KCP adds KCP on top of the chain, which gives streams over packets.
+func (b *Builder) KCP(options *KCPOptions) *Builder {
+	return b.Implementation(chaining.LayerStreamAdapter, "kcp", &kcp.Implementation{}, options.parameters())
+}
+
+// ARQ adds the selective-repeat ARQ on top of the chain, which gives streams over packets.
+func (b *Builder) ARQ(options *ARQOptions) *Builder {
+	return b.Implementation(chaining.LayerStreamAdapter, "arq", &arq.Implementation{}, options.parameters())
+}
+
+// HTTP adds the HTTP tunnel on top of the chain.
+func (b *Builder) HTTP(options *HTTPOptions) *Builder {
+	return b.Implementation(chaining.LayerStreamObfuscator, "http", &mshttp.Implementation{}, options.parameters())
+}
+
+// H2Mux adds streams over a single HTTP/2 connection on top of the chain.
+func (b *Builder) H2Mux(options *HTTPOptions) *Builder {
+	return b.Implementation(chaining.LayerStreamSolution, "h2mux", &mshttp.H2MuxImplementation{}, options.parameters())
+}
+
+// WebSocket adds WebSocket on top of the chain. Put TLS underneath for "wss".
+func (b *Builder) WebSocket(options *WebSocketOptions) *Builder {
+	return b.Implementation(chaining.LayerStreamObfuscator, "ws", &mshttp.WebSocketImplementation{}, options.parameters())
+}
+
+// WebSocketPackets adds WebSocket on top of the chain, carrying a packet in each message.
+func (b *Builder) WebSocketPackets(options *WebSocketOptions) *Builder {
+	return b.Implementation(chaining.LayerPacketAdapter, "wsp", &mshttp.WebSocketPacketImplementation{}, options.parameters())
+}
+
+// GRPC adds gRPC calls on top of the chain, one per stream.
+func (b *Builder) GRPC(options *GRPCOptions) *Builder {
+	return b.Implementation(chaining.LayerStreamObfuscator, "grpc", &mshttp.GRPCImplementation{}, options.parameters())
+}
+
+// GRPCMux adds gRPC calls over a single HTTP/2 connection on top of the chain.
+func (b *Builder) GRPCMux(options *GRPCOptions) *Builder {
+	return b.Implementation(chaining.LayerStreamSolution, "grpcmux", &mshttp.GRPCMuxImplementation{}, options.parameters())
+}
+
+// PoS adds packets over a single stream on top of the chain.
+func (b *Builder) PoS(options *PoSOptions) *Builder {
+	return b.Implementation(chaining.LayerPacketAdapter, "pos", pos.NewPoSImplementation(), options.parameters())
+}
+
+// SPoS adds packets over a stream that is redialed when it breaks on top of the chain.
+func (b *Builder) SPoS(options *PoSOptions) *Builder {
+	return b.Implementation(chaining.LayerPacketAdapter, "spos", pos.NewSPoSImplementation(), options.parameters())
+}
+
+// PSPoS adds packets over several parallel streams on top of the chain.
+func (b *Builder) PSPoS(options *PoSOptions) *Builder {
+	return b.Implementation(chaining.LayerPacketAdapter, "pspos", pos.NewPSPoSImplementation(), options.parameters())
+}
+
+func (o *SmuxOptions) parameters() utils.Parameters {
+	p := make(utils.Parameters)
+	if o == nil {
+		return p
+	}
+	setInt(p, smux.ParamVersion, o.Version)
+	setInt(p, smux.ParamMaxFrameSize, o.MaxFrameSize)
+	setInt(p, smux.ParamMaxReceiveBuffer, o.MaxReceiveBuffer)
+	setInt(p, smux.ParamMaxStreamBuffer, o.MaxStreamBuffer)
+	if o.Kcptun {
+		p[smux.ParamCompat] = smux.CompatKcptun
+	}
+	return p
+}
+
+func (o *YamuxOptions) parameters() utils.Parameters {
+	p := make(utils.Parameters)
+	if o == nil {
+		return p
+	}
+	setInt(p, yamux.ParamAcceptBacklog, o.AcceptBacklog)
+	setInt(p, yamux.ParamMaxStreamWindow, o.MaxStreamWindow)
+	setDuration(p, yamux.ParamWriteTimeout, o.WriteTimeout)
+	setDuration(p, yamux.ParamStreamOpenTimeout, o.StreamOpenTimeout)
+	setDuration(p, yamux.ParamStreamCloseTimeout, o.StreamCloseTimeout)
+	return p
+}
+
+func (o *KCPOptions) parameters() utils.Parameters {
+	p := make(utils.Parameters)
+	if o == nil {
+		return p
+	}
+	setString(p, kcp.ParamMode, o.Mode)
+	setInt(p, kcp.ParamSendWindow, o.SendWindow)
+	setInt(p, kcp.ParamReceiveWindow, o.ReceiveWindow)
+	setInt(p, kcp.ParamMTU, o.MTU)
+	setInt(p, kcp.ParamDataShards, o.DataShards)
+	setInt(p, kcp.ParamParityShards, o.ParityShards)
+	if o.NoFEC {
+		p[kcp.ParamParityShards] = "0"
+	}
+	setBool(p, kcp.ParamAckNoDelay, o.AckNoDelay)
+	setString(p, kcp.ParamCrypt, o.Crypt)
+	setString(p, kcp.ParamKey, o.Key)
+	setString(p, kcp.ParamSalt, o.Salt)
+	setBool(p, kcp.ParamCompress, o.Compress)
+	if o.Kcptun {
+		p[kcp.ParamCompat] = kcp.CompatKcptun
+	}
+	return p
+}
+
+func (o *ARQOptions) parameters() utils.Parameters {
+	p := make(utils.Parameters)
+	if o == nil {
+		return p
+	}
+	setString(p, arq.ParamCongestion, o.Congestion)
+	setDuration(p, arq.ParamTargetDelay, o.TargetDelay)
+	setInt(p, arq.ParamWindow, o.Window)
+	setInt(p, arq.ParamSendBuffer, o.SendBuffer)
+	setInt(p, arq.ParamMTU, o.MTU)
+	setInt(p, arq.ParamMaxMTU, o.MaxMTU)
+	if o.DisableMTUProbing {
+		p[arq.ParamProbeMTU] = "false"
+	}
+	setDuration(p, arq.ParamIdleTimeout, o.IdleTimeout)
+	setInt(p, arq.ParamBacklog, o.Backlog)
+	return p
+}
+
+func (o *QUICOptions) parameters() utils.Parameters {
+	p := make(utils.Parameters)
+	if o == nil {
+		return p
+	}
+	setInt(p, quic.ParamMaxStreams, o.MaxStreams)
+	setDuration(p, quic.ParamIdleTimeout, o.IdleTimeout)
+	setInt(p, quic.ParamStreamWindow, o.StreamWindow)
+	setInt(p, quic.ParamMaxStreamWindow, o.MaxStreamWindow)
+	setInt(p, quic.ParamConnWindow, o.ConnWindow)
+	setInt(p, quic.ParamMaxConnWindow, o.MaxConnWindow)
+	setBool(p, quic.ParamZeroRTT, o.ZeroRTT)
+	return p
+}
+
+func (o *HTTPOptions) parameters() utils.Parameters {
+	p := make(utils.Parameters)
+	if o == nil {
+		return p
+	}
+	setString(p, mshttp.ParamProto, o.Proto)
+	setString(p, mshttp.ParamHost, o.Host)
+	setString(p, mshttp.ParamPath, o.Path)
+	setString(p, mshttp.ParamQuery, o.Query)
+	setString(p, mshttp.ParamMethod, o.Method)
+	setHeaders(p, o.Headers)
+	setString(p, mshttp.ParamUsername, o.Username)
+	setString(p, mshttp.ParamPassword, o.Password)
+	if o.DisableCompression {
+		p[mshttp.ParamCompression] = "false"
+	}
+	setInt(p, mshttp.ParamBacklog, o.Backlog)
+	return p
+}
+
+func (o *WebSocketOptions) parameters() utils.Parameters {
+	p := make(utils.Parameters)
+	if o == nil {
+		return p
+	}
+	setString(p, mshttp.ParamHost, o.Host)
+	setString(p, mshttp.ParamPath, o.Path)
+	setString(p, mshttp.ParamQuery, o.Query)
+	setHeaders(p, o.Headers)
+	setString(p, mshttp.ParamUsername, o.Username)
+	setString(p, mshttp.ParamPassword, o.Password)
+	setString(p, mshttp.ParamSubprotocols, strings.Join(o.Subprotocols, ","))
+	setString(p, mshttp.ParamOrigin, o.Origin)
+	setInt(p, mshttp.ParamMaxMessageSize, o.MaxMessageSize)
+	setInt(p, mshttp.ParamEarlyData, o.EarlyData)
+	setString(p, mshttp.ParamEarlyDataHeader, o.EarlyDataHeader)
+	setInt(p, mshttp.ParamBacklog, o.Backlog)
+	return p
+}
+
+func (o *GRPCOptions) parameters() utils.Parameters {
+	p := make(utils.Parameters)
+	if o == nil {
+		return p
+	}
+	setString(p, mshttp.ParamProto, o.Proto)
+	setString(p, mshttp.ParamHost, o.Host)
+	setString(p, mshttp.ParamService, o.Service)
+	setString(p, mshttp.ParamRPC, o.RPC)
+	setHeaders(p, o.Headers)
+	setString(p, mshttp.ParamUsername, o.Username)
+	setString(p, mshttp.ParamPassword, o.Password)
+	setInt(p, mshttp.ParamBacklog, o.Backlog)
+	return p
+}
+
+func (o *PoSOptions) parameters() utils.Parameters {
+	p := make(utils.Parameters)
+	if o == nil {
+		return p
+	}
+	setInt(p, pos.ParamStreams, o.Streams)
+	setDuration(p, pos.ParamRedialDelay, o.RedialDelay)
+	setDuration(p, pos.ParamSessionTimeout, o.SessionTimeout)
+	return p
+}
+
+func setString(p utils.Parameters, key string, value string) {
+	if value != "" {
+		p[key] = value
+	}
+}
+
+func setInt(p utils.Parameters, key string, value int) {
+	if value != 0 {
+		p[key] = strconv.Itoa(value)
+	}
+}
+
+func setDuration(p utils.Parameters, key string, value time.Duration) {
+	if value != 0 {
+		p[key] = value.String()
+	}
+}
+
+func setBool(p utils.Parameters, key string, value bool) {
+	if value {
+		p[key] = "true"
+	}
+}
+
+func setHeaders(p utils.Parameters, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var pairs []string
+	for _, name := range names {
+		for _, value := range header[name] {
+			pairs = append(pairs, name+":"+value)
+		}
+	}
+	setString(p, mshttp.ParamHeaders, strings.Join(pairs, ","))
+}
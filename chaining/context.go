@@ -0,0 +1,312 @@
+package chaining
+
+import (
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/datagram"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+)
+
+// The functions below call the context-aware constructors of an implementation if it provides them. Otherwise, the
+// plain constructors are used and their results are lifted so that they at least stop being waited on once the
+// context is done.
+
+// withContext converts plain chaining results into their context-aware counterparts and leaves anything else as is.
+func withContext(input any) any {
+	switch f := input.(type) {
+	case types.PacketConnFunc:
+		return f.WithContext()
+	case types.StreamDialFunc:
+		return f.WithContext()
+	case types.StreamListenFunc:
+		return f.WithContext()
+	case types.MuxDialFunc:
+		return f.WithContext()
+	case types.MuxListenFunc:
+		return f.WithContext()
+	}
+	return input
+}
+
+func clientPacketConn(impl any, addr string, parameters utils.Parameters) (types.PacketConnContextFunc, error) {
+	switch i := impl.(type) {
+	case types.PacketConnContextImplementation:
+		return i.ClientContext(addr, parameters)
+	case types.PacketConnImplementation:
+		dialFunc, err := i.Client(addr, parameters)
+		if err != nil {
+			return nil, err
+		}
+		return dialFunc.WithContext(), nil
+	}
+	return nil, muxedsocket.ErrInvalidChainingResult
+}
+
+func serverPacketConn(impl any, addr string, parameters utils.Parameters) (types.PacketConnContextFunc, error) {
+	switch i := impl.(type) {
+	case types.PacketConnContextImplementation:
+		return i.ServerContext(addr, parameters)
+	case types.PacketConnImplementation:
+		listenFunc, err := i.Server(addr, parameters)
+		if err != nil {
+			return nil, err
+		}
+		return listenFunc.WithContext(), nil
+	}
+	return nil, muxedsocket.ErrInvalidChainingResult
+}
+
+func clientStreamConn(impl any, addr string, parameters utils.Parameters) (types.StreamDialContextFunc, error) {
+	switch i := impl.(type) {
+	case types.StreamConnContextImplementation:
+		return i.ClientContext(addr, parameters)
+	case types.StreamConnImplementation:
+		dialFunc, err := i.Client(addr, parameters)
+		if err != nil {
+			return nil, err
+		}
+		return dialFunc.WithContext(), nil
+	}
+	return nil, muxedsocket.ErrInvalidChainingResult
+}
+
+func serverStreamConn(impl any, addr string, parameters utils.Parameters) (types.StreamListenContextFunc, error) {
+	switch i := impl.(type) {
+	case types.StreamConnContextImplementation:
+		return i.ServerContext(addr, parameters)
+	case types.StreamConnImplementation:
+		listenFunc, err := i.Server(addr, parameters)
+		if err != nil {
+			return nil, err
+		}
+		return listenFunc.WithContext(), nil
+	}
+	return nil, muxedsocket.ErrInvalidChainingResult
+}
+
+func clientAddrSolution(impl any, addr string, parameters utils.Parameters) (types.MuxDialContextFunc, error) {
+	switch i := impl.(type) {
+	case types.AddrSolutionContextImplementation:
+		return i.ClientContext(addr, parameters)
+	case types.AddrSolutionImplementation:
+		dialFunc, err := i.Client(addr, parameters)
+		if err != nil {
+			return nil, err
+		}
+		return dialFunc.WithContext(), nil
+	}
+	return nil, muxedsocket.ErrInvalidChainingResult
+}
+
+func serverAddrSolution(impl any, addr string, parameters utils.Parameters) (types.MuxListenContextFunc, error) {
+	switch i := impl.(type) {
+	case types.AddrSolutionContextImplementation:
+		return i.ServerContext(addr, parameters)
+	case types.AddrSolutionImplementation:
+		listenFunc, err := i.Server(addr, parameters)
+		if err != nil {
+			return nil, err
+		}
+		return listenFunc.WithContext(), nil
+	}
+	return nil, muxedsocket.ErrInvalidChainingResult
+}
+
+func clientStreamAdapter(impl any, conn types.PacketConnContextFunc, parameters utils.Parameters) (types.StreamDialContextFunc, error) {
+	switch i := impl.(type) {
+	case types.StreamAdapterContextImplementation:
+		return i.ClientContext(conn, parameters)
+	case types.StreamAdapterImplementation:
+		dialFunc, err := i.Client(conn.WithoutContext(), parameters)
+		if err != nil {
+			return nil, err
+		}
+		return dialFunc.WithContext(), nil
+	}
+	return nil, muxedsocket.ErrInvalidChainingResult
+}
+
+func serverStreamAdapter(impl any, conn types.PacketConnContextFunc, parameters utils.Parameters) (types.StreamListenContextFunc, error) {
+	switch i := impl.(type) {
+	case types.StreamAdapterContextImplementation:
+		return i.ServerContext(conn, parameters)
+	case types.StreamAdapterImplementation:
+		listenFunc, err := i.Server(conn.WithoutContext(), parameters)
+		if err != nil {
+			return nil, err
+		}
+		return listenFunc.WithContext(), nil
+	}
+	return nil, muxedsocket.ErrInvalidChainingResult
+}
+
+func clientPacketAdapter(impl any, conn types.StreamDialContextFunc, parameters utils.Parameters) (types.PacketConnContextFunc, error) {
+	switch i := impl.(type) {
+	case types.PacketAdapterContextImplementation:
+		return i.ClientContext(conn, parameters)
+	case types.PacketAdapterImplementation:
+		dialFunc, err := i.Client(conn.WithoutContext(), parameters)
+		if err != nil {
+			return nil, err
+		}
+		return dialFunc.WithContext(), nil
+	}
+	return nil, muxedsocket.ErrInvalidChainingResult
+}
+
+func serverPacketAdapter(impl any, listener types.StreamListenContextFunc, parameters utils.Parameters) (types.PacketConnContextFunc, error) {
+	switch i := impl.(type) {
+	case types.PacketAdapterContextImplementation:
+		return i.ServerContext(listener, parameters)
+	case types.PacketAdapterImplementation:
+		listenFunc, err := i.Server(listener.WithoutContext(), parameters)
+		if err != nil {
+			return nil, err
+		}
+		return listenFunc.WithContext(), nil
+	}
+	return nil, muxedsocket.ErrInvalidChainingResult
+}
+
+func clientStreamObfuscator(impl any, conn types.StreamDialContextFunc, parameters utils.Parameters) (types.StreamDialContextFunc, error) {
+	switch i := impl.(type) {
+	case types.StreamObfuscatorContextImplementation:
+		return i.ClientContext(conn, parameters)
+	case types.StreamObfuscatorImplementation:
+		dialFunc, err := i.Client(conn.WithoutContext(), parameters)
+		if err != nil {
+			return nil, err
+		}
+		return dialFunc.WithContext(), nil
+	}
+	return nil, muxedsocket.ErrInvalidChainingResult
+}
+
+func serverStreamObfuscator(impl any, listener types.StreamListenContextFunc, parameters utils.Parameters) (types.StreamListenContextFunc, error) {
+	switch i := impl.(type) {
+	case types.StreamObfuscatorContextImplementation:
+		return i.ServerContext(listener, parameters)
+	case types.StreamObfuscatorImplementation:
+		listenFunc, err := i.Server(listener.WithoutContext(), parameters)
+		if err != nil {
+			return nil, err
+		}
+		return listenFunc.WithContext(), nil
+	}
+	return nil, muxedsocket.ErrInvalidChainingResult
+}
+
+func clientPacketObfuscator(impl any, conn types.PacketConnContextFunc, parameters utils.Parameters) (types.PacketConnContextFunc, error) {
+	switch i := impl.(type) {
+	case types.PacketObfuscatorContextImplementation:
+		return i.ClientContext(conn, parameters)
+	case types.PacketObfuscatorImplementation:
+		dialFunc, err := i.Client(conn.WithoutContext(), parameters)
+		if err != nil {
+			return nil, err
+		}
+		return dialFunc.WithContext(), nil
+	}
+	return nil, muxedsocket.ErrInvalidChainingResult
+}
+
+func serverPacketObfuscator(impl any, conn types.PacketConnContextFunc, parameters utils.Parameters) (types.PacketConnContextFunc, error) {
+	switch i := impl.(type) {
+	case types.PacketObfuscatorContextImplementation:
+		return i.ServerContext(conn, parameters)
+	case types.PacketObfuscatorImplementation:
+		listenFunc, err := i.Server(conn.WithoutContext(), parameters)
+		if err != nil {
+			return nil, err
+		}
+		return listenFunc.WithContext(), nil
+	}
+	return nil, muxedsocket.ErrInvalidChainingResult
+}
+
+func clientPacketSolution(impl any, conn types.PacketConnContextFunc, parameters utils.Parameters) (types.MuxDialContextFunc, error) {
+	switch i := impl.(type) {
+	case types.PacketSolutionContextImplementation:
+		dialFunc, err := i.ClientContext(conn, parameters)
+		if err != nil {
+			return nil, err
+		}
+		return emulateDialedDatagrams(dialFunc, parameters), nil
+	case types.PacketSolutionImplementation:
+		dialFunc, err := i.Client(conn.WithoutContext(), parameters)
+		if err != nil {
+			return nil, err
+		}
+		return emulateDialedDatagrams(dialFunc.WithContext(), parameters), nil
+	}
+	return nil, muxedsocket.ErrInvalidChainingResult
+}
+
+func serverPacketSolution(impl any, conn types.PacketConnContextFunc, parameters utils.Parameters) (types.MuxListenContextFunc, error) {
+	switch i := impl.(type) {
+	case types.PacketSolutionContextImplementation:
+		listenFunc, err := i.ServerContext(conn, parameters)
+		if err != nil {
+			return nil, err
+		}
+		return emulateAcceptedDatagrams(listenFunc, parameters), nil
+	case types.PacketSolutionImplementation:
+		listenFunc, err := i.Server(conn.WithoutContext(), parameters)
+		if err != nil {
+			return nil, err
+		}
+		return emulateAcceptedDatagrams(listenFunc.WithContext(), parameters), nil
+	}
+	return nil, muxedsocket.ErrInvalidChainingResult
+}
+
+func clientStreamSolution(impl any, conn types.StreamDialContextFunc, parameters utils.Parameters) (types.MuxDialContextFunc, error) {
+	switch i := impl.(type) {
+	case types.StreamSolutionContextImplementation:
+		dialFunc, err := i.ClientContext(conn, parameters)
+		if err != nil {
+			return nil, err
+		}
+		return emulateDialedDatagrams(dialFunc, parameters), nil
+	case types.StreamSolutionImplementation:
+		dialFunc, err := i.Client(conn.WithoutContext(), parameters)
+		if err != nil {
+			return nil, err
+		}
+		return emulateDialedDatagrams(dialFunc.WithContext(), parameters), nil
+	}
+	return nil, muxedsocket.ErrInvalidChainingResult
+}
+
+func serverStreamSolution(impl any, listener types.StreamListenContextFunc, parameters utils.Parameters) (types.MuxListenContextFunc, error) {
+	switch i := impl.(type) {
+	case types.StreamSolutionContextImplementation:
+		listenFunc, err := i.ServerContext(listener, parameters)
+		if err != nil {
+			return nil, err
+		}
+		return emulateAcceptedDatagrams(listenFunc, parameters), nil
+	case types.StreamSolutionImplementation:
+		listenFunc, err := i.Server(listener.WithoutContext(), parameters)
+		if err != nil {
+			return nil, err
+		}
+		return emulateAcceptedDatagrams(listenFunc.WithContext(), parameters), nil
+	}
+	return nil, muxedsocket.ErrInvalidChainingResult
+}
+
+// emulateDialedDatagrams makes sockets of a muxer carry datagrams over a stream, if parameters ask for it.
+func emulateDialedDatagrams(dialFunc types.MuxDialContextFunc, parameters utils.Parameters) types.MuxDialContextFunc {
+	if !datagram.Enabled(parameters) {
+		return dialFunc
+	}
+	return datagram.DialContext(dialFunc, datagram.OptionsFromParameters(parameters))
+}
+
+func emulateAcceptedDatagrams(listenFunc types.MuxListenContextFunc, parameters utils.Parameters) types.MuxListenContextFunc {
+	if !datagram.Enabled(parameters) {
+		return listenFunc
+	}
+	return datagram.ListenContext(listenFunc, datagram.OptionsFromParameters(parameters))
+}
@@ -0,0 +1,116 @@
+package chaining
+
+import (
+	"fmt"
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"sort"
+	"strings"
+)
+
+// ExplainedLayer describes a single effective layer of a chain.
+type ExplainedLayer struct {
+	LayerType          LayerType
+	ImplementationName string
+	// Implicit is true if the layer was not in the scheme and was taken from defaults.
+	Implicit bool
+	// Parameters are what the layer receives when it is constructed, redacted.
+	Parameters utils.Parameters
+}
+
+// Explanation describes what a chainer would construct, top-down, including the implicit layer that is put on top
+// to make the result a muxed socket.
+type Explanation struct {
+	Addr             string
+	Layers           []ExplainedLayer
+	CommonParameters utils.Parameters
+}
+
+func (e *Explanation) String() string {
+	builder := &strings.Builder{}
+	for i, layer := range e.Layers {
+		builder.WriteString(fmt.Sprintf("%d: %s (%s", i, layer.ImplementationName, layer.LayerType))
+		if layer.Implicit {
+			builder.WriteString(", implicit")
+		}
+		builder.WriteString(")")
+		keys := make([]string, 0, len(layer.Parameters))
+		for key := range layer.Parameters {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			builder.WriteString(fmt.Sprintf(" %s=%s", key, layer.Parameters[key]))
+		}
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// ExplainMuxLayers resolves the scheme parts like CreateMuxLayersChainer and reports the effective layers, without
+// dialing or listening.
+func ExplainMuxLayers(creators *muxedsocket.Creators, defaults *muxedsocket.DefaultLayers, schemeParts []string, addr string, parameters utils.Parameters) (*Explanation, error) {
+	layers, defaultParameters, err := resolveMuxLayers(creators, defaults, schemeParts)
+	if err != nil {
+		return nil, err
+	}
+	parameters = utils.CombineParameters(defaultParameters, parameters)
+	layerParams := splitParameters(layers, parameters)
+	explained := make([]ExplainedLayer, len(layers))
+	for i, layer := range layers {
+		explained[i] = ExplainedLayer{
+			LayerType:          layer.LayerType,
+			ImplementationName: layer.ImplementationName,
+			Implicit:           layer.Implicit,
+			Parameters:         layerParams[i].Redacted(creators.Resolvers()),
+		}
+	}
+	return &Explanation{
+		Addr:             addr,
+		Layers:           explained,
+		CommonParameters: utils.CommonParametersFromMap(parameters).Redacted(creators.Resolvers()),
+	}, nil
+}
+
+// ExplainAddrSolution reports a scheme that names an addr solution as a whole. Such a solution is not chained with
+// anything and receives all parameters, like when dialing or listening.
+func ExplainAddrSolution(creators *muxedsocket.Creators, scheme string, addr string, parameters utils.Parameters) *Explanation {
+	return &Explanation{
+		Addr: addr,
+		Layers: []ExplainedLayer{{
+			LayerType:          LayerAddrSolution,
+			ImplementationName: scheme,
+			Parameters:         parameters.Redacted(creators.Resolvers()),
+		}},
+		CommonParameters: utils.CommonParametersFromMap(parameters).Redacted(creators.Resolvers()),
+	}
+}
+
+// resolveMuxLayers returns the layers that a mux chainer ends up with, including the implicit muxer on top, along with
+// default parameters of aliases.
+func resolveMuxLayers(creators *muxedsocket.Creators, defaults *muxedsocket.DefaultLayers, schemeParts []string) ([]*Layer, utils.Parameters, error) {
+	layers, parameters, err := resolveLayersWithDefaults(creators, defaults, schemeParts, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if top := topMuxerFor(layers, defaults); top != nil {
+		layers = append([]*Layer{top}, layers...)
+	}
+	return layers, parameters, nil
+}
+
+// topMuxerFor returns the default solution that GetMuxDialFunc and GetMuxListenFunc put on top of given layers, or
+// nil if the top layer is already a muxer.
+func topMuxerFor(layers []*Layer, defaults *muxedsocket.DefaultLayers) *Layer {
+	top := getLayerAt(layers, 0)
+	if top == nil || IsMuxerLayer(top.LayerType) {
+		return nil
+	}
+	if top.LayerType&layersGivingStream != 0 {
+		return defaultLayer(defaults, LayerStreamSolution)
+	}
+	return defaultLayer(defaults, LayerPacketSolution)
+}
+
+// which layers give a stream to the layer above them?
+const layersGivingStream = LayerStreamConn | LayerStreamObfuscator | LayerStreamAdapter
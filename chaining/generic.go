@@ -2,19 +2,25 @@ package chaining
 
 import (
 	"github.com/hadi77ir/muxedsocket"
-	"github.com/hadi77ir/muxedsocket/types"
 	"github.com/hadi77ir/muxedsocket/utils"
 )
 
 type genericChainer struct {
 	Defaults *muxedsocket.DefaultLayers
 	Layers   []*Layer
+	// Parameters are defaults (from aliases) that parameters given when constructing override.
+	Parameters utils.Parameters
+	// Resolvers resolve references in parameter values. Values are taken literally if nil.
+	Resolvers *utils.Registry[utils.ValueResolver]
 }
 
+// ConstructDialFunc chains client side of the layers together. Result is always one of the context-aware function
+// types, so that the context passed when dialing reaches every layer.
 func (m *genericChainer) ConstructDialFunc(addr string, parameters utils.Parameters) (any, utils.Parameters, error) {
 	return m.chainLayers(addr, parameters, m.applyClientLayerOn)
 }
 
+// ConstructListenFunc chains server side of the layers together. Like ConstructDialFunc, result is context-aware.
 func (m *genericChainer) ConstructListenFunc(addr string, parameters utils.Parameters) (any, utils.Parameters, error) {
 	return m.chainLayers(addr, parameters, m.applyServerLayerOn)
 }
@@ -24,39 +30,33 @@ type applierFn func(layer *Layer, input any, layerParams utils.Parameters, commo
 func (m *genericChainer) applyClientLayerOn(layer *Layer, input any, layerParams utils.Parameters, commonParameters utils.Parameters) (any, error) {
 	// if layer takes a stream
 	if layer.LayerType&LayersTakingStreamConn != 0 {
-		streamDialer, err := GetStreamDialFunc(input, m.Defaults, commonParameters)
+		streamDialer, err := GetStreamDialContextFunc(input, m.Defaults, commonParameters)
 		if err != nil {
 			return nil, err
 		}
 		switch layer.LayerType {
 		case LayerPacketAdapter:
-			layerImpl := layer.Implementation.(types.PacketAdapterImplementation)
-			return layerImpl.Client(streamDialer, layerParams)
+			return clientPacketAdapter(layer.Implementation, streamDialer, layerParams)
 		case LayerStreamObfuscator:
-			layerImpl := layer.Implementation.(types.StreamObfuscatorImplementation)
-			return layerImpl.Client(streamDialer, layerParams)
+			return clientStreamObfuscator(layer.Implementation, streamDialer, layerParams)
 		case LayerStreamSolution:
-			layerImpl := layer.Implementation.(types.StreamSolutionImplementation)
-			return layerImpl.Client(streamDialer, layerParams)
+			return clientStreamSolution(layer.Implementation, streamDialer, layerParams)
 		}
 	}
 
 	// if layer takes a packet
 	if layer.LayerType&LayersTakingPacketConn != 0 {
-		packetDialer, err := GetPacketDialFunc(input, m.Defaults, commonParameters)
+		packetDialer, err := GetPacketDialContextFunc(input, m.Defaults, commonParameters)
 		if err != nil {
 			return nil, err
 		}
 		switch layer.LayerType {
 		case LayerStreamAdapter:
-			layerImpl := layer.Implementation.(types.StreamAdapterImplementation)
-			return layerImpl.Client(packetDialer, layerParams)
+			return clientStreamAdapter(layer.Implementation, packetDialer, layerParams)
 		case LayerPacketObfuscator:
-			layerImpl := layer.Implementation.(types.PacketObfuscatorImplementation)
-			return layerImpl.Client(packetDialer, layerParams)
+			return clientPacketObfuscator(layer.Implementation, packetDialer, layerParams)
 		case LayerPacketSolution:
-			layerImpl := layer.Implementation.(types.PacketSolutionImplementation)
-			return layerImpl.Client(packetDialer, layerParams)
+			return clientPacketSolution(layer.Implementation, packetDialer, layerParams)
 		}
 	}
 
@@ -65,14 +65,11 @@ func (m *genericChainer) applyClientLayerOn(layer *Layer, input any, layerParams
 	if inputIsString && layer.LayerType&LayersTakingString != 0 {
 		switch layer.LayerType {
 		case LayerStreamConn:
-			layerImpl := layer.Implementation.(types.StreamConnImplementation)
-			return layerImpl.Client(addr, layerParams)
+			return clientStreamConn(layer.Implementation, addr, layerParams)
 		case LayerPacketConn:
-			layerImpl := layer.Implementation.(types.PacketConnImplementation)
-			return layerImpl.Client(addr, layerParams)
+			return clientPacketConn(layer.Implementation, addr, layerParams)
 		case LayerAddrSolution:
-			layerImpl := layer.Implementation.(types.AddrSolutionImplementation)
-			return layerImpl.Client(addr, layerParams)
+			return clientAddrSolution(layer.Implementation, addr, layerParams)
 		}
 	}
 	return nil, muxedsocket.ErrInvalidChainingResult
@@ -81,39 +78,33 @@ func (m *genericChainer) applyClientLayerOn(layer *Layer, input any, layerParams
 func (m *genericChainer) applyServerLayerOn(layer *Layer, input any, layerParams utils.Parameters, commonParameters utils.Parameters) (any, error) {
 	// if layer takes a stream
 	if layer.LayerType&LayersTakingStreamConn != 0 {
-		streamDialer, err := GetStreamListenFunc(input, m.Defaults, commonParameters)
+		streamListener, err := GetStreamListenContextFunc(input, m.Defaults, commonParameters)
 		if err != nil {
 			return nil, err
 		}
 		switch layer.LayerType {
 		case LayerPacketAdapter:
-			layerImpl := layer.Implementation.(types.PacketAdapterImplementation)
-			return layerImpl.Server(streamDialer, layerParams)
+			return serverPacketAdapter(layer.Implementation, streamListener, layerParams)
 		case LayerStreamObfuscator:
-			layerImpl := layer.Implementation.(types.StreamObfuscatorImplementation)
-			return layerImpl.Server(streamDialer, layerParams)
+			return serverStreamObfuscator(layer.Implementation, streamListener, layerParams)
 		case LayerStreamSolution:
-			layerImpl := layer.Implementation.(types.StreamSolutionImplementation)
-			return layerImpl.Server(streamDialer, layerParams)
+			return serverStreamSolution(layer.Implementation, streamListener, layerParams)
 		}
 	}
 
 	// if layer takes a packet
 	if layer.LayerType&LayersTakingPacketConn != 0 {
-		packetDialer, err := GetPacketListenFunc(input, m.Defaults, commonParameters)
+		packetListener, err := GetPacketListenContextFunc(input, m.Defaults, commonParameters)
 		if err != nil {
 			return nil, err
 		}
 		switch layer.LayerType {
 		case LayerStreamAdapter:
-			layerImpl := layer.Implementation.(types.StreamAdapterImplementation)
-			return layerImpl.Server(packetDialer, layerParams)
+			return serverStreamAdapter(layer.Implementation, packetListener, layerParams)
 		case LayerPacketObfuscator:
-			layerImpl := layer.Implementation.(types.PacketObfuscatorImplementation)
-			return layerImpl.Server(packetDialer, layerParams)
+			return serverPacketObfuscator(layer.Implementation, packetListener, layerParams)
 		case LayerPacketSolution:
-			layerImpl := layer.Implementation.(types.PacketSolutionImplementation)
-			return layerImpl.Server(packetDialer, layerParams)
+			return serverPacketSolution(layer.Implementation, packetListener, layerParams)
 		}
 	}
 
@@ -122,14 +113,11 @@ func (m *genericChainer) applyServerLayerOn(layer *Layer, input any, layerParams
 	if inputIsString && layer.LayerType&LayersTakingString != 0 {
 		switch layer.LayerType {
 		case LayerStreamConn:
-			layerImpl := layer.Implementation.(types.StreamConnImplementation)
-			return layerImpl.Server(addr, layerParams)
+			return serverStreamConn(layer.Implementation, addr, layerParams)
 		case LayerPacketConn:
-			layerImpl := layer.Implementation.(types.PacketConnImplementation)
-			return layerImpl.Server(addr, layerParams)
+			return serverPacketConn(layer.Implementation, addr, layerParams)
 		case LayerAddrSolution:
-			layerImpl := layer.Implementation.(types.AddrSolutionImplementation)
-			return layerImpl.Server(addr, layerParams)
+			return serverAddrSolution(layer.Implementation, addr, layerParams)
 		}
 	}
 	return nil, muxedsocket.ErrInvalidChainingResult
@@ -138,12 +126,20 @@ func (m *genericChainer) applyServerLayerOn(layer *Layer, input any, layerParams
 func (m *genericChainer) chainLayers(addr string, parameters utils.Parameters, applyLayerOnInputFn applierFn) (any, utils.Parameters, error) {
 	var result any
 	var err error
+	parameters = utils.CombineParameters(m.Parameters, parameters)
 	// dial the transport
 	layerParams := splitParameters(m.Layers, parameters)
-	commonParams := utils.CommonParametersFromMap(parameters)
+	commonParams, err := utils.CommonParametersFromMap(parameters).Resolve(m.Resolvers)
+	if err != nil {
+		return nil, nil, err
+	}
 	result = addr
-	for i := len(m.Layers) - 2; i >= 0; i-- {
-		result, err = applyLayerOnInputFn(m.Layers[i], result, layerParams[i], commonParams)
+	for i := len(m.Layers) - 1; i >= 0; i-- {
+		params, err := layerParams[i].Resolve(m.Resolvers)
+		if err != nil {
+			return nil, nil, err
+		}
+		result, err = applyLayerOnInputFn(m.Layers[i], result, params, commonParams)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -152,9 +148,9 @@ func (m *genericChainer) chainLayers(addr string, parameters utils.Parameters, a
 }
 
 func createGenericChainer(creators *muxedsocket.Creators, defaults *muxedsocket.DefaultLayers, schemeParts []string) (*genericChainer, error) {
-	layers, err := ResolveLayers(creators, schemeParts, false)
+	layers, parameters, err := resolveLayersWithDefaults(creators, defaults, schemeParts, true)
 	if err != nil {
 		return nil, err
 	}
-	return &genericChainer{Layers: layers, Defaults: defaults}, nil
+	return &genericChainer{Layers: layers, Defaults: defaults, Parameters: parameters, Resolvers: creators.Resolvers()}, nil
 }
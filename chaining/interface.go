@@ -10,6 +10,23 @@ type LayersChainer[TDialFunc any, TListenFunc any] interface {
 	ConstructListenFunc(addr string, parameters utils.Parameters) (TListenFunc, error)
 }
 
-type MuxLayersChainer LayersChainer[types.MuxDialFunc, types.MuxListenFunc]
-type StreamLayersChainer LayersChainer[types.StreamDialFunc, types.StreamListenFunc]
-type PacketLayersChainer LayersChainer[types.PacketConnFunc, types.PacketConnFunc]
+// ContextLayersChainer constructs functions that take a context.Context, which is passed down to every layer.
+type ContextLayersChainer[TDialFunc any, TListenFunc any] interface {
+	ConstructDialContextFunc(addr string, parameters utils.Parameters) (TDialFunc, error)
+	ConstructListenContextFunc(addr string, parameters utils.Parameters) (TListenFunc, error)
+}
+
+type MuxLayersChainer interface {
+	LayersChainer[types.MuxDialFunc, types.MuxListenFunc]
+	ContextLayersChainer[types.MuxDialContextFunc, types.MuxListenContextFunc]
+}
+
+type StreamLayersChainer interface {
+	LayersChainer[types.StreamDialFunc, types.StreamListenFunc]
+	ContextLayersChainer[types.StreamDialContextFunc, types.StreamListenContextFunc]
+}
+
+type PacketLayersChainer interface {
+	LayersChainer[types.PacketConnFunc, types.PacketConnFunc]
+	ContextLayersChainer[types.PacketConnContextFunc, types.PacketConnContextFunc]
+}
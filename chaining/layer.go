@@ -1,12 +1,33 @@
 package chaining
 
 import (
+	"fmt"
 	"github.com/hadi77ir/muxedsocket"
 	"github.com/hadi77ir/muxedsocket/utils"
 )
 
 type LayerType int
 
+var layerTypeNames = map[LayerType]string{
+	LayerNone:             "None",
+	LayerPacketConn:       "PacketConn",
+	LayerStreamConn:       "StreamConn",
+	LayerStreamAdapter:    "StreamAdapter",
+	LayerPacketAdapter:    "PacketAdapter",
+	LayerStreamObfuscator: "StreamObfuscator",
+	LayerPacketObfuscator: "PacketObfuscator",
+	LayerPacketSolution:   "PacketSolution",
+	LayerStreamSolution:   "StreamSolution",
+	LayerAddrSolution:     "AddrSolution",
+}
+
+func (t LayerType) String() string {
+	if name, found := layerTypeNames[t]; found {
+		return name
+	}
+	return fmt.Sprintf("LayerType(0x%x)", int(t))
+}
+
 const (
 	LayerNone       = LayerType(0)
 	LayerPacketConn = LayerType(0x01)
@@ -73,6 +94,10 @@ type Layer struct {
 	ImplementationName string
 	Implementation     any
 	ParametersIndex    int
+	// Implicit is true for layers that didn't appear in the scheme and were filled in from defaults.
+	Implicit bool
+	// Parameters, if set, are bound to the layer and take precedence over the ones given when constructing.
+	Parameters utils.Parameters
 }
 
 func IsLayerCompatible(above, below *Layer) bool {
@@ -152,34 +177,164 @@ func ResolveLayer(creators *muxedsocket.Creators, part string, paramsSectionInde
 func splitParameters(layers []*Layer, parameters utils.Parameters) []utils.Parameters {
 	layerParams := make([]utils.Parameters, len(layers))
 	for i := 0; i < len(layers); i++ {
+		if layers[i].Implicit {
+			// implicit layers have no section of their own, like defaults applied by casting.
+			layerParams[i] = utils.CommonParametersFromMap(parameters)
+			continue
+		}
 		layerParams[i] = parameters.SectionWithCommon(utils.GetIndexedParamsSection(layers[i].ImplementationName, layers[i].ParametersIndex))
+		if layers[i].Parameters != nil {
+			layerParams[i] = utils.CombineParameters(layerParams[i], layers[i].Parameters)
+		}
 	}
 	return layerParams
 }
 
+// ResolveLayers resolves scheme parts (top-down) into layers and checks every adjacent pair against compatibility
+// matrix. It doesn't fill any gaps, so the bottom layer is allowed not to be a transport. Aliases are expanded, but
+// their default parameters are dropped; use muxedsocket.ExpandSchemeParts to get them.
 func ResolveLayers(creators *muxedsocket.Creators, schemeParts []string, enableMux bool) ([]*Layer, error) {
+	return ResolveLayersWithDefaults(creators, nil, schemeParts, enableMux)
+}
+
+// ResolveLayersWithDefaults is like ResolveLayers, but fills the gaps using the given defaults: adapters are inserted
+// between incompatible layers where one can bridge them, and a transport is added at the bottom if it is missing.
+// Inserted layers are marked as Implicit.
+func ResolveLayersWithDefaults(creators *muxedsocket.Creators, defaults *muxedsocket.DefaultLayers, schemeParts []string, enableMux bool) ([]*Layer, error) {
+	layers, _, err := resolveLayersWithDefaults(creators, defaults, schemeParts, enableMux)
+	return layers, err
+}
+
+func resolveLayersWithDefaults(creators *muxedsocket.Creators, defaults *muxedsocket.DefaultLayers, schemeParts []string, enableMux bool) ([]*Layer, utils.Parameters, error) {
+	layers, parameters, err := resolveParts(creators, schemeParts, enableMux)
+	if err != nil {
+		return nil, nil, err
+	}
+	layers, err = fillGaps(layers, defaults)
+	if err != nil {
+		return nil, nil, err
+	}
+	return layers, parameters, nil
+}
+
+// resolveParts expands aliases and resolves every scheme part, without any validation. Returned parameters are the
+// defaults that came with aliases.
+func resolveParts(creators *muxedsocket.Creators, schemeParts []string, enableMux bool) ([]*Layer, utils.Parameters, error) {
+	schemeParts, parameters, err := muxedsocket.ExpandSchemeParts(creators, schemeParts)
+	if err != nil {
+		return nil, nil, err
+	}
 	layers := make([]*Layer, len(schemeParts))
 	occurrenceMap := make(map[string]int)
 	for i := len(schemeParts) - 1; i >= 0; i-- {
 		part := schemeParts[i]
 		resolved := ResolveLayer(creators, part, occurrenceMap[part], enableMux)
 		if resolved == nil {
-			return nil, muxedsocket.ErrSchemeNotSupported
+			return nil, nil, muxedsocket.ErrSchemeNotSupported
 		}
-		//bottom := getLayerAt(layers, i+1)
-		//if bottom != nil && !IsLayerCompatible(resolved, bottom) {
-		// todo: we may try to fill the gap with some defaults.
-		//	return nil, muxedsocket.ErrIncompatibleChainOfLayers
-		//}
 		occurrenceMap[part] += 1
 		layers[i] = resolved
 	}
-	return layers, nil
+	return layers, parameters, nil
+}
+
+func fillGaps(layers []*Layer, defaults *muxedsocket.DefaultLayers) ([]*Layer, error) {
+	if len(layers) == 0 {
+		return layers, nil
+	}
+	// built bottom-up, then reversed.
+	filled := make([]*Layer, 0, len(layers)+1)
+	bottom := layers[len(layers)-1]
+	if !IsLayerCompatible(bottom, nil) && defaults != nil {
+		transport := defaultTransportFor(bottom, defaults)
+		if transport == nil {
+			return nil, incompatibleLayersError(bottom, nil, len(layers)-1)
+		}
+		filled = append(filled, transport)
+	}
+	for i := len(layers) - 1; i >= 0; i-- {
+		above := layers[i]
+		below := getLayerAt(filled, -1)
+		if below != nil && !IsLayerCompatible(above, below) {
+			bridge := findBridge(above, below, defaults)
+			if bridge == nil {
+				return nil, incompatibleLayersError(above, below, i)
+			}
+			filled = append(filled, bridge)
+		}
+		filled = append(filled, above)
+	}
+	for i, j := 0, len(filled)-1; i < j; i, j = i+1, j-1 {
+		filled[i], filled[j] = filled[j], filled[i]
+	}
+	return filled, nil
+}
+
+// findBridge returns a default adapter that may be put between the two given layers, or nil if there is none.
+func findBridge(above, below *Layer, defaults *muxedsocket.DefaultLayers) *Layer {
+	for _, layerType := range []LayerType{LayerPacketAdapter, LayerStreamAdapter} {
+		candidate := defaultLayer(defaults, layerType)
+		if candidate != nil && IsLayerCompatible(above, candidate) && IsLayerCompatible(candidate, below) {
+			return candidate
+		}
+	}
+	return nil
+}
+
+func defaultTransportFor(layer *Layer, defaults *muxedsocket.DefaultLayers) *Layer {
+	if layer.LayerType&LayersTakingStreamConn != 0 {
+		return defaultLayer(defaults, LayerStreamConn)
+	}
+	if layer.LayerType&LayersTakingPacketConn != 0 {
+		return defaultLayer(defaults, LayerPacketConn)
+	}
+	return nil
+}
+
+// defaultLayer returns an implicit layer of given type taken from defaults, or nil if there is no such default.
+// Implicit layers are named after the corresponding Default* constant.
+func defaultLayer(defaults *muxedsocket.DefaultLayers, layerType LayerType) *Layer {
+	if defaults == nil {
+		return nil
+	}
+	var name string
+	var impl any
+	switch layerType {
+	case LayerPacketConn:
+		name, impl = muxedsocket.DefaultPacketConn, defaults.PacketConn
+	case LayerStreamConn:
+		name, impl = muxedsocket.DefaultStreamConn, defaults.StreamConn
+	case LayerPacketAdapter:
+		name, impl = muxedsocket.DefaultPacketAdapter, defaults.PacketAdapter
+	case LayerStreamAdapter:
+		name, impl = muxedsocket.DefaultStreamAdapter, defaults.StreamAdapter
+	case LayerPacketSolution:
+		name, impl = muxedsocket.DefaultPacketSolution, defaults.PacketSolution
+	case LayerStreamSolution:
+		name, impl = muxedsocket.DefaultStreamSolution, defaults.StreamSolution
+	}
+	if impl == nil {
+		return nil
+	}
+	return &Layer{
+		LayerType:          layerType,
+		ImplementationName: name,
+		Implementation:     impl,
+		Implicit:           true,
+	}
+}
+
+func incompatibleLayersError(above, below *Layer, position int) error {
+	err := muxedsocket.ErrIncompatibleChainOfLayers{Above: above.ImplementationName, Position: position}
+	if below != nil {
+		err.Below = below.ImplementationName
+	}
+	return err
 }
 
 func getLayerAt(layers []*Layer, at int) *Layer {
 	if at < 0 {
-		if len(layers)+at >= len(layers) {
+		if len(layers)+at < 0 {
 			return nil
 		}
 		return layers[len(layers)+at]
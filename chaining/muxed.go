@@ -26,6 +26,22 @@ func (m *muxLayersChainer) ConstructListenFunc(addr string, parameters utils.Par
 	return GetMuxListenFunc(result, m.backend.Defaults, commonParams)
 }
 
+func (m *muxLayersChainer) ConstructDialContextFunc(addr string, parameters utils.Parameters) (types.MuxDialContextFunc, error) {
+	result, commonParams, err := m.backend.ConstructDialFunc(addr, parameters)
+	if err != nil {
+		return nil, err
+	}
+	return GetMuxDialContextFunc(result, m.backend.Defaults, commonParams)
+}
+
+func (m *muxLayersChainer) ConstructListenContextFunc(addr string, parameters utils.Parameters) (types.MuxListenContextFunc, error) {
+	result, commonParams, err := m.backend.ConstructListenFunc(addr, parameters)
+	if err != nil {
+		return nil, err
+	}
+	return GetMuxListenContextFunc(result, m.backend.Defaults, commonParams)
+}
+
 var _ MuxLayersChainer = &muxLayersChainer{}
 
 func CreateMuxLayersChainer(creators *muxedsocket.Creators, defaults *muxedsocket.DefaultLayers, schemeParts []string) (MuxLayersChainer, error) {
@@ -35,3 +51,41 @@ func CreateMuxLayersChainer(creators *muxedsocket.Creators, defaults *muxedsocke
 	}
 	return &muxLayersChainer{backend: backend}, nil
 }
+
+// CreateMuxLayersChainerFromLayers creates a chainer from already resolved layers (top-down), like the ones built by
+// chain.Builder. Layers are validated and gaps are filled the same way as ResolveLayersWithDefaults does.
+func CreateMuxLayersChainerFromLayers(defaults *muxedsocket.DefaultLayers, layers []*Layer) (MuxLayersChainer, error) {
+	return CreateMuxLayersChainerFromLayersWithRegistry(muxedsocket.GlobalCreators(), defaults, layers)
+}
+
+// CreateMuxLayersChainerFromLayersWithRegistry is like CreateMuxLayersChainerFromLayers, but resolves references in
+// parameter values using resolvers of given creators.
+func CreateMuxLayersChainerFromLayersWithRegistry(creators *muxedsocket.Creators, defaults *muxedsocket.DefaultLayers, layers []*Layer) (MuxLayersChainer, error) {
+	return createMuxLayersChainerFromLayers(creators, defaults, layers, nil)
+}
+
+func createMuxLayersChainerFromLayers(creators *muxedsocket.Creators, defaults *muxedsocket.DefaultLayers, layers []*Layer, parameters utils.Parameters) (MuxLayersChainer, error) {
+	filled, err := fillGaps(layers, defaults)
+	if err != nil {
+		return nil, err
+	}
+	return &muxLayersChainer{backend: &genericChainer{
+		Layers:     filled,
+		Defaults:   defaults,
+		Parameters: parameters,
+		Resolvers:  creators.Resolvers(),
+	}}, nil
+}
+
+// CreateMuxLayersChainerOver is like CreateMuxLayersChainer, but chains the layers on top of given transport layer,
+// which is usually an injected connection. If scheme ends with a stream or packet transport, it is skipped.
+func CreateMuxLayersChainerOver(creators *muxedsocket.Creators, defaults *muxedsocket.DefaultLayers, schemeParts []string, transport *Layer) (MuxLayersChainer, error) {
+	layers, parameters, err := resolveParts(creators, schemeParts, true)
+	if err != nil {
+		return nil, err
+	}
+	if bottom := getLayerAt(layers, -1); bottom != nil && bottom.LayerType&(LayerStreamConn|LayerPacketConn) != 0 {
+		layers = layers[:len(layers)-1]
+	}
+	return createMuxLayersChainerFromLayers(creators, defaults, append(layers, transport), parameters)
+}
@@ -26,6 +26,22 @@ func (m *packetLayersChainer) ConstructListenFunc(addr string, parameters utils.
 	return GetPacketListenFunc(result, m.backend.Defaults, commonParams)
 }
 
+func (m *packetLayersChainer) ConstructDialContextFunc(addr string, parameters utils.Parameters) (types.PacketConnContextFunc, error) {
+	result, commonParams, err := m.backend.ConstructDialFunc(addr, parameters)
+	if err != nil {
+		return nil, err
+	}
+	return GetPacketDialContextFunc(result, m.backend.Defaults, commonParams)
+}
+
+func (m *packetLayersChainer) ConstructListenContextFunc(addr string, parameters utils.Parameters) (types.PacketConnContextFunc, error) {
+	result, commonParams, err := m.backend.ConstructListenFunc(addr, parameters)
+	if err != nil {
+		return nil, err
+	}
+	return GetPacketListenContextFunc(result, m.backend.Defaults, commonParams)
+}
+
 var _ PacketLayersChainer = &packetLayersChainer{}
 
 func CreatePacketLayersChainer(creators *muxedsocket.Creators, defaults *muxedsocket.DefaultLayers, schemeParts []string) (PacketLayersChainer, error) {
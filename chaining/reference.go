@@ -0,0 +1,137 @@
+package chaining
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"io"
+	"sort"
+)
+
+// ImplementationReference lists parameters of a single implementation. Hinted is false for implementations that don't
+// implement types.HasParametersHint, in which case parameters are unknown.
+type ImplementationReference struct {
+	Name             string                `json:"name"`
+	LayerType        LayerType             `json:"layerType"`
+	Implicit         bool                  `json:"implicit,omitempty"`
+	Hinted           bool                  `json:"hinted"`
+	ClientParameters []utils.ParameterHint `json:"clientParameters,omitempty"`
+	ServerParameters []utils.ParameterHint `json:"serverParameters,omitempty"`
+}
+
+func (t LayerType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func referenceOf(layer *Layer) ImplementationReference {
+	ref := ImplementationReference{
+		Name:      layer.ImplementationName,
+		LayerType: layer.LayerType,
+		Implicit:  layer.Implicit,
+	}
+	ref.ClientParameters, ref.Hinted = layerHints(layer, false)
+	ref.ServerParameters, _ = layerHints(layer, true)
+	return ref
+}
+
+func appendReferences[T any](refs []ImplementationReference, registry *utils.Registry[T], layerType LayerType) []ImplementationReference {
+	names := registry.Keys()
+	sort.Strings(names)
+	for _, name := range names {
+		impl, found := registry.Get(name)
+		if !found {
+			// an alias of something unregistered.
+			continue
+		}
+		refs = append(refs, referenceOf(&Layer{LayerType: layerType, ImplementationName: name, Implementation: impl}))
+	}
+	return refs
+}
+
+// ParametersReference lists parameters of every registered implementation, grouped by layer type.
+func ParametersReference(creators *muxedsocket.Creators) []ImplementationReference {
+	var refs []ImplementationReference
+	refs = appendReferences(refs, creators.PacketConns(), LayerPacketConn)
+	refs = appendReferences(refs, creators.StreamConns(), LayerStreamConn)
+	refs = appendReferences(refs, creators.StreamAdapters(), LayerStreamAdapter)
+	refs = appendReferences(refs, creators.PacketAdapters(), LayerPacketAdapter)
+	refs = appendReferences(refs, creators.StreamObfuscators(), LayerStreamObfuscator)
+	refs = appendReferences(refs, creators.PacketObfuscators(), LayerPacketObfuscator)
+	refs = appendReferences(refs, creators.PacketSolutions(), LayerPacketSolution)
+	refs = appendReferences(refs, creators.StreamSolutions(), LayerStreamSolution)
+	refs = appendReferences(refs, creators.AddrSolutions(), LayerAddrSolution)
+	return refs
+}
+
+// SchemeParametersReference lists parameters of the layers a mux chainer would construct for given scheme parts,
+// top-down.
+func SchemeParametersReference(creators *muxedsocket.Creators, defaults *muxedsocket.DefaultLayers, schemeParts []string) ([]ImplementationReference, error) {
+	layers, _, err := resolveMuxLayers(creators, defaults, schemeParts)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]ImplementationReference, len(layers))
+	for i, layer := range layers {
+		refs[i] = referenceOf(layer)
+	}
+	return refs, nil
+}
+
+// WriteReferenceText renders references as plain text, suitable for a help screen. Common parameters come first.
+func WriteReferenceText(w io.Writer, refs []ImplementationReference) error {
+	if _, err := fmt.Fprintln(w, "common:"); err != nil {
+		return err
+	}
+	if err := writeHintsText(w, "", muxedsocket.CommonParametersHint); err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		title := fmt.Sprintf("%s (%s", ref.Name, ref.LayerType)
+		if ref.Implicit {
+			title += ", implicit"
+		}
+		if _, err := fmt.Fprintf(w, "\n%s):\n", title); err != nil {
+			return err
+		}
+		if !ref.Hinted {
+			if _, err := fmt.Fprintln(w, "  (parameters not documented)"); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := writeHintsText(w, "client ", ref.ClientParameters); err != nil {
+			return err
+		}
+		if err := writeHintsText(w, "server ", ref.ServerParameters); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeHintsText(w io.Writer, side string, hints []utils.ParameterHint) error {
+	for _, hint := range hints {
+		line := fmt.Sprintf("  %s%s <%s>", side, hint.Key, hint.Type)
+		if hint.DefaultValue != "" {
+			line += " (default: " + hint.DefaultValue + ")"
+		}
+		if hint.Description != "" {
+			line += ": " + hint.Description
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteReferenceJSON renders common parameters and references as a JSON document.
+func WriteReferenceJSON(w io.Writer, refs []ImplementationReference) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Common          []utils.ParameterHint     `json:"common"`
+		Implementations []ImplementationReference `json:"implementations"`
+	}{muxedsocket.CommonParametersHint, refs})
+}
@@ -26,6 +26,22 @@ func (m *streamLayersChainer) ConstructListenFunc(addr string, parameters utils.
 	return GetStreamListenFunc(result, m.backend.Defaults, commonParams)
 }
 
+func (m *streamLayersChainer) ConstructDialContextFunc(addr string, parameters utils.Parameters) (types.StreamDialContextFunc, error) {
+	result, commonParams, err := m.backend.ConstructDialFunc(addr, parameters)
+	if err != nil {
+		return nil, err
+	}
+	return GetStreamDialContextFunc(result, m.backend.Defaults, commonParams)
+}
+
+func (m *streamLayersChainer) ConstructListenContextFunc(addr string, parameters utils.Parameters) (types.StreamListenContextFunc, error) {
+	result, commonParams, err := m.backend.ConstructListenFunc(addr, parameters)
+	if err != nil {
+		return nil, err
+	}
+	return GetStreamListenContextFunc(result, m.backend.Defaults, commonParams)
+}
+
 var _ StreamLayersChainer = &streamLayersChainer{}
 
 func CreateStreamLayersChainer(creators *muxedsocket.Creators, defaults *muxedsocket.DefaultLayers, schemeParts []string) (StreamLayersChainer, error) {
@@ -0,0 +1,133 @@
+package chaining
+
+import (
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValidateMuxLayersParameters checks parameters against hints of the layers a mux chainer would construct for given
+// scheme parts. Client hints are used when server is false. Layers that don't implement types.HasParametersHint
+// accept anything in their section. Values that are references, like "env:NAME", are only resolved when chaining,
+// so their keys are checked but not their values. All problems are returned together in a
+// muxedsocket.ErrInvalidParameters.
+func ValidateMuxLayersParameters(creators *muxedsocket.Creators, defaults *muxedsocket.DefaultLayers, schemeParts []string, parameters utils.Parameters, server bool) error {
+	layers, defaultParameters, err := resolveMuxLayers(creators, defaults, schemeParts)
+	if err != nil {
+		return err
+	}
+	parameters = utils.CombineParameters(defaultParameters, parameters)
+	keys := make([]string, 0, len(parameters))
+	for key := range parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var problems []muxedsocket.ParameterProblem
+	for _, key := range keys {
+		var reason string
+		value := parameters[key]
+		if utils.IsReference(creators.Resolvers(), value) {
+			value = ""
+		}
+		// values quoted in reasons are redacted, as they may be secrets.
+		checked := checkedValue{value: value, shown: utils.RedactValue(creators.Resolvers(), key, value)}
+		if dot := strings.Index(key, "."); dot != -1 {
+			reason = checkSectionParameter(layers, key[:dot], key[dot+1:], checked, server)
+		} else {
+			reason = checkCommonParameter(layers, key, checked, server)
+		}
+		if reason != "" {
+			problems = append(problems, muxedsocket.ParameterProblem{Key: key, Reason: reason})
+		}
+	}
+	if len(problems) > 0 {
+		return muxedsocket.ErrInvalidParameters{Problems: problems}
+	}
+	return nil
+}
+
+// checkedValue is a value under validation, along with how it may be shown.
+type checkedValue struct {
+	value string
+	shown string
+}
+
+func checkSectionParameter(layers []*Layer, section string, key string, value checkedValue, server bool) string {
+	name, index, indexed := utils.TryGetParamsSectionIndex(section)
+	if !indexed {
+		return "section has to be indexed, like " + utils.GetIndexedParamsSection(name, 0)
+	}
+	for _, layer := range layers {
+		if layer.Implicit || layer.ImplementationName != name || layer.ParametersIndex != index {
+			continue
+		}
+		hints, ok := layerHints(layer, server)
+		if !ok {
+			return ""
+		}
+		if hint := findHint(hints, key); hint != nil {
+			return checkValue(hint, value)
+		}
+		return "unknown parameter for " + name
+	}
+	return "no such layer in scheme"
+}
+
+func checkCommonParameter(layers []*Layer, key string, value checkedValue, server bool) string {
+	if hint := findHint(muxedsocket.CommonParametersHint, key); hint != nil {
+		return checkValue(hint, value)
+	}
+	known := false
+	for _, layer := range layers {
+		hints, ok := layerHints(layer, server)
+		if !ok {
+			// this layer may understand any key.
+			known = true
+			continue
+		}
+		if hint := findHint(hints, key); hint != nil {
+			if reason := checkValue(hint, value); reason != "" {
+				return reason
+			}
+			known = true
+		}
+	}
+	if !known {
+		return "unknown parameter"
+	}
+	return ""
+}
+
+func layerHints(layer *Layer, server bool) ([]utils.ParameterHint, bool) {
+	hinted, ok := layer.Implementation.(types.HasParametersHint)
+	if !ok {
+		return nil, false
+	}
+	if server {
+		return hinted.ServerParametersHint(), true
+	}
+	return hinted.ClientParametersHint(), true
+}
+
+func findHint(hints []utils.ParameterHint, key string) *utils.ParameterHint {
+	for i := range hints {
+		if hints[i].Key == key {
+			return &hints[i]
+		}
+	}
+	return nil
+}
+
+func checkValue(hint *utils.ParameterHint, value checkedValue) string {
+	if value.value == "" {
+		return ""
+	}
+	if err := hint.Type.CheckValue(value.value); err != nil {
+		return err.Error() + ", got " + strconv.Quote(value.shown)
+	}
+	return ""
+}
@@ -1,6 +1,7 @@
 package muxedsocket
 
 import (
+	"github.com/hadi77ir/muxedsocket/utils"
 	"strings"
 	"time"
 )
@@ -17,12 +18,47 @@ const (
 	// ParamDPD means time that has to pass after a keep-alive has been sent and no response was received to assume the
 	// connection is dead. (dead peer detection)
 	ParamDPD = "dpd"
+	// ParamStrict enables strict mode. In strict mode, every parameter is checked against hints of the layers and
+	// dialing or listening fails if a parameter is unknown or has a bad value.
+	ParamStrict = "strict"
 )
 
+// CommonParametersHint describes the parameters that are understood regardless of layers.
+var CommonParametersHint = []utils.ParameterHint{
+	{Key: ParamDialTimeout, Description: "dial timeout", Type: utils.ParameterTypeDuration, DefaultValue: DefaultDialTimeout.String()},
+	{Key: ParamKeepAlive, Description: "keep-alive interval, or false to disable", Type: utils.ParameterTypeDurationFalse, DefaultValue: DefaultKeepAlive.String()},
+	{Key: ParamDPD, Description: "dead peer detection timeout", Type: utils.ParameterTypeDuration},
+	{Key: ParamStrict, Description: "fail on unknown parameters and bad values", Type: utils.ParameterTypeBool, DefaultValue: "false"},
+	// used by demuxer, when a muxer is turned into streams.
+	{Key: "streamsperconn", Description: "streams opened on a muxed connection before dialing another", Type: utils.ParameterTypeInt, DefaultValue: "1"},
+	{Key: "backlog", Description: "accepted streams queued before being taken", Type: utils.ParameterTypeInt, DefaultValue: "1000"},
+	// used by muxers without datagrams, to emulate them.
+	{Key: "datagrams", Description: "emulate datagrams over a dedicated stream on muxers without them", Type: utils.ParameterTypeBool, DefaultValue: "false"},
+	{Key: "maxdatagram", Description: "largest emulated datagram", Type: utils.ParameterTypeInt, DefaultValue: "1200"},
+	{Key: "datagramqueue", Description: "emulated datagrams queued before dropping new ones", Type: utils.ParameterTypeInt, DefaultValue: "64"},
+}
+
 const (
 	DefaultDialTimeout = time.Duration(5) * time.Second
 	DefaultKeepAlive   = time.Duration(15) * time.Second
 )
 
+// KeepAliveFromParameters reads keep-alive interval and dead peer detection timeout from parameters. Interval is zero
+// when keep-alive is disabled. Timeout defaults to three intervals, and is never shorter than one.
+func KeepAliveFromParameters(parameters utils.Parameters) (interval time.Duration, timeout time.Duration) {
+	if keepAlive, _ := parameters.Get(ParamKeepAlive); utils.StrIsFalse(keepAlive) {
+		return 0, 0
+	}
+	interval = utils.DurationFromParameters(parameters, ParamKeepAlive, DefaultKeepAlive)
+	if interval <= 0 {
+		return 0, 0
+	}
+	timeout = utils.DurationFromParameters(parameters, ParamDPD, 3*interval)
+	if timeout < interval {
+		timeout = interval
+	}
+	return interval, timeout
+}
+
 // MultipleValuesSeparator is used to split a parameter value into multiple values.
 const MultipleValuesSeparator = ","
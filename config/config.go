@@ -0,0 +1,125 @@
+// Package config loads named endpoints from JSON or YAML documents, as a readable alternative to long URIs:
+//
+//	endpoints:
+//	  upstream:
+//	    scheme: smux+tls+tcp
+//	    address: example.com:443
+//	    parameters:
+//	      timeout: 10s
+//	    sections:
+//	      tls:
+//	        sni: example.com
+//	        insecure: false
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/types"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrEndpointNotFound = errors.New("endpoint not found")
+	ErrUnknownFormat    = errors.New("unknown config format")
+)
+
+type Config struct {
+	Endpoints map[string]*Endpoint `json:"endpoints" yaml:"endpoints"`
+	creators  *muxedsocket.Creators
+}
+
+// ParseJSON parses a JSON document.
+func ParseJSON(data []byte) (*Config, error) {
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ParseYAML parses a YAML document.
+func ParseYAML(data []byte) (*Config, error) {
+	config := &Config{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// LoadFile loads a document, picking the format by extension: ".json", ".yaml" or ".yml".
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return ParseJSON(data)
+	case ".yaml", ".yml":
+		return ParseYAML(data)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// WithRegistry makes the config dial and listen using given creators instead of global ones.
+func (c *Config) WithRegistry(creators *muxedsocket.Creators) *Config {
+	c.creators = creators
+	return c
+}
+
+func (c *Config) registry() *muxedsocket.Creators {
+	if c.creators == nil {
+		return muxedsocket.GlobalCreators()
+	}
+	return c.creators
+}
+
+// Endpoint returns the endpoint with given name.
+func (c *Config) Endpoint(name string) (*Endpoint, error) {
+	endpoint, found := c.Endpoints[name]
+	if !found || endpoint == nil {
+		return nil, ErrEndpointNotFound
+	}
+	return endpoint, nil
+}
+
+// URI returns the endpoint with given name in URI form.
+func (c *Config) URI(name string) (string, error) {
+	endpoint, err := c.Endpoint(name)
+	if err != nil {
+		return "", err
+	}
+	return endpoint.URI()
+}
+
+// DialConfig dials the endpoint with given name, the same way DialURI does with its URI.
+func (c *Config) DialConfig(name string) (types.MuxedSocket, error) {
+	return c.DialConfigContext(context.Background(), name)
+}
+
+func (c *Config) DialConfigContext(ctx context.Context, name string) (types.MuxedSocket, error) {
+	uri, err := c.URI(name)
+	if err != nil {
+		return nil, err
+	}
+	return muxedsocket.DialURIWithRegistryContext(ctx, c.registry(), uri)
+}
+
+// ListenConfig listens on the endpoint with given name, the same way ListenURI does with its URI.
+func (c *Config) ListenConfig(name string) (types.MuxedListener, error) {
+	return c.ListenConfigContext(context.Background(), name)
+}
+
+func (c *Config) ListenConfigContext(ctx context.Context, name string) (types.MuxedListener, error) {
+	uri, err := c.URI(name)
+	if err != nil {
+		return nil, err
+	}
+	return muxedsocket.ListenURIWithRegistryContext(ctx, c.registry(), uri)
+}
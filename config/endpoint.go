@@ -0,0 +1,133 @@
+package config
+
+import (
+	"errors"
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrNoScheme          = errors.New("endpoint has no scheme")
+	ErrConflictingScheme = errors.New("endpoint has both scheme and layers, and they differ")
+	ErrDuplicateSection  = errors.New("endpoint has the same section both with and without index, like \"tls\" and \"tls[0]\"")
+)
+
+// Endpoint describes a chain and where it dials or listens. Layers is an alternative to Scheme, listing the same parts
+// top-down. Sections hold parameters of a single layer, keyed like "tls[0]"; a key without index, like "tls", means
+// index 0, so the two forms of the same section can't be used together.
+type Endpoint struct {
+	Scheme     string            `json:"scheme,omitempty" yaml:"scheme,omitempty"`
+	Layers     []string          `json:"layers,omitempty" yaml:"layers,omitempty"`
+	Address    string            `json:"address,omitempty" yaml:"address,omitempty"`
+	Parameters Values            `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	Sections   map[string]Values `json:"sections,omitempty" yaml:"sections,omitempty"`
+}
+
+// SchemeParts returns parts of the scheme, top-down.
+func (e *Endpoint) SchemeParts() ([]string, error) {
+	if e.Scheme == "" && len(e.Layers) == 0 {
+		return nil, ErrNoScheme
+	}
+	if e.Scheme == "" {
+		return e.Layers, nil
+	}
+	parts := muxedsocket.GetSchemeParts(e.Scheme)
+	if len(e.Layers) > 0 && strings.Join(e.Layers, "+") != e.Scheme {
+		return nil, ErrConflictingScheme
+	}
+	return parts, nil
+}
+
+// FullScheme returns the scheme, joined from Layers if Scheme is not set.
+func (e *Endpoint) FullScheme() (string, error) {
+	parts, err := e.SchemeParts()
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(parts, "+"), nil
+}
+
+// AllParameters flattens common parameters and sections into the form used in URIs, like "tls[0].sni". Values are
+// kept as they are, empty ones included, so that URI and EndpointFromURI round-trip. It fails with
+// ErrDuplicateSection if a section is given both with and without index.
+func (e *Endpoint) AllParameters() (utils.Parameters, error) {
+	parameters := make(utils.Parameters, len(e.Parameters))
+	for key, value := range e.Parameters {
+		parameters[key] = value
+	}
+	seen := make(map[string]bool, len(e.Sections))
+	for section, values := range e.Sections {
+		normalized := normalizeSection(section)
+		if seen[normalized] {
+			return nil, ErrDuplicateSection
+		}
+		seen[normalized] = true
+		for key, value := range values {
+			parameters[section+"."+key] = value
+		}
+	}
+	return parameters, nil
+}
+
+func normalizeSection(section string) string {
+	name, index, _ := utils.TryGetParamsSectionIndex(section)
+	return utils.GetIndexedParamsSection(name, index)
+}
+
+// URI returns the endpoint in URI form, which DialURI and ListenURI take.
+func (e *Endpoint) URI() (string, error) {
+	scheme, err := e.FullScheme()
+	if err != nil {
+		return "", err
+	}
+	parameters, err := e.AllParameters()
+	if err != nil {
+		return "", err
+	}
+	keys := make([]string, 0, len(parameters))
+	for key := range parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	query := make(url.Values, len(parameters))
+	for _, key := range keys {
+		query.Set(key, parameters[key])
+	}
+	uri := &url.URL{Scheme: scheme, Host: e.Address, RawQuery: query.Encode()}
+	return uri.String(), nil
+}
+
+// EndpointFromURI parses a URI into an endpoint. It is the inverse of Endpoint.URI.
+func EndpointFromURI(uri string) (*Endpoint, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme == "" {
+		return nil, ErrNoScheme
+	}
+	endpoint := &Endpoint{Scheme: parsed.Scheme, Address: parsed.Host}
+	for key, values := range parsed.Query() {
+		value := values[0]
+		dot := strings.Index(key, ".")
+		if dot == -1 {
+			if endpoint.Parameters == nil {
+				endpoint.Parameters = make(Values)
+			}
+			endpoint.Parameters[key] = value
+			continue
+		}
+		if endpoint.Sections == nil {
+			endpoint.Sections = make(map[string]Values)
+		}
+		section := key[:dot]
+		if endpoint.Sections[section] == nil {
+			endpoint.Sections[section] = make(Values)
+		}
+		endpoint.Sections[section][key[dot+1:]] = value
+	}
+	return endpoint, nil
+}
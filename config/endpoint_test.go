@@ -0,0 +1,57 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEndpointURIRoundTrip(t *testing.T) {
+	uris := []string{
+		"smux+tls+tcp://example.com:443?insecure=&sni=a.com&tls%5B0%5D.alpn=h2&tls%5B0%5D.cert=",
+		"smux+tls+tcp://example.com:443?tls.sni=b.com",
+		"tcp://127.0.0.1:80",
+	}
+	for _, uri := range uris {
+		endpoint, err := EndpointFromURI(uri)
+		if err != nil {
+			t.Fatal(uri, err)
+		}
+		got, err := endpoint.URI()
+		if err != nil {
+			t.Fatal(uri, err)
+		}
+		if got != uri {
+			t.Errorf("got %s, want %s", got, uri)
+		}
+	}
+}
+
+func TestEndpointRoundTrip(t *testing.T) {
+	endpoint := &Endpoint{
+		Scheme:     "smux+tls+tcp",
+		Address:    "example.com:443",
+		Parameters: Values{"sni": "a.com", "insecure": ""},
+		Sections:   map[string]Values{"tls[0]": {"alpn": "h2", "cert": ""}, "smux": {"version": "2"}},
+	}
+	uri, err := endpoint.URI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := EndpointFromURI(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, endpoint) {
+		t.Fatalf("got %+v, want %+v", parsed, endpoint)
+	}
+}
+
+func TestEndpointDuplicateSection(t *testing.T) {
+	endpoint := &Endpoint{
+		Scheme:   "tls+tcp",
+		Sections: map[string]Values{"tls": {"sni": "a"}, "tls[0]": {"sni": "b"}},
+	}
+	if _, err := endpoint.URI(); err != ErrDuplicateSection {
+		t.Fatal(err)
+	}
+}
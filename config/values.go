@@ -0,0 +1,50 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+)
+
+// Values is a set of parameters. When decoding, numbers and booleans are accepted as well as strings, so that
+// "insecure: true" doesn't have to be quoted.
+type Values map[string]string
+
+func (v *Values) UnmarshalJSON(data []byte) error {
+	var raw map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return err
+	}
+	values := make(Values, len(raw))
+	for key, value := range raw {
+		switch value.(type) {
+		case string, json.Number, bool:
+			values[key] = fmt.Sprint(value)
+		case nil:
+			values[key] = ""
+		default:
+			return fmt.Errorf("parameter %q: expected a scalar value", key)
+		}
+	}
+	*v = values
+	return nil
+}
+
+func (v *Values) UnmarshalYAML(node *yaml.Node) error {
+	var raw map[string]yaml.Node
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	values := make(Values, len(raw))
+	for key, value := range raw {
+		if value.Kind != yaml.ScalarNode {
+			return fmt.Errorf("parameter %q: expected a scalar value", key)
+		}
+		values[key] = value.Value
+	}
+	*v = values
+	return nil
+}
@@ -16,6 +16,8 @@ type Creators struct {
 	packetSolutions   *utils.Registry[types.PacketSolutionImplementation]
 	streamSolutions   *utils.Registry[types.StreamSolutionImplementation]
 	addrSolutions     *utils.Registry[types.AddrSolutionImplementation]
+	aliases           *utils.Registry[Alias]
+	resolvers         *utils.Registry[utils.ValueResolver]
 }
 
 func (c *Creators) PacketConns() *utils.Registry[types.PacketConnImplementation] {
@@ -54,6 +56,16 @@ func (c *Creators) AddrSolutions() *utils.Registry[types.AddrSolutionImplementat
 	return c.addrSolutions
 }
 
+// Aliases are consulted before implementations when resolving scheme parts.
+func (c *Creators) Aliases() *utils.Registry[Alias] {
+	return c.aliases
+}
+
+// Resolvers resolve references in parameter values, like "env:NAME", right before layers receive them.
+func (c *Creators) Resolvers() *utils.Registry[utils.ValueResolver] {
+	return c.resolvers
+}
+
 var creators = NewCreators()
 
 func GlobalCreators() *Creators {
@@ -61,6 +73,8 @@ func GlobalCreators() *Creators {
 }
 
 func NewCreators() *Creators {
+	resolvers := &utils.Registry[utils.ValueResolver]{}
+	utils.RegisterDefaultResolvers(resolvers)
 	return &Creators{
 		packetConns:       &utils.Registry[types.PacketConnImplementation]{},
 		streamConns:       &utils.Registry[types.StreamConnImplementation]{},
@@ -71,5 +85,37 @@ func NewCreators() *Creators {
 		packetSolutions:   &utils.Registry[types.PacketSolutionImplementation]{},
 		streamSolutions:   &utils.Registry[types.StreamSolutionImplementation]{},
 		addrSolutions:     &utils.Registry[types.AddrSolutionImplementation]{},
+		aliases:           &utils.Registry[Alias]{},
+		resolvers:         resolvers,
+	}
+}
+
+// Clone returns creators with copies of all registries, so that registering on the clone leaves c untouched.
+func (c *Creators) Clone() *Creators {
+	return &Creators{
+		packetConns:       c.packetConns.Clone(),
+		streamConns:       c.streamConns.Clone(),
+		streamAdapters:    c.streamAdapters.Clone(),
+		packetAdapters:    c.packetAdapters.Clone(),
+		streamObfuscators: c.streamObfuscators.Clone(),
+		packetObfuscators: c.packetObfuscators.Clone(),
+		packetSolutions:   c.packetSolutions.Clone(),
+		streamSolutions:   c.streamSolutions.Clone(),
+		addrSolutions:     c.addrSolutions.Clone(),
+		aliases:           c.aliases.Clone(),
+		resolvers:         c.resolvers.Clone(),
+	}
+}
+
+// WithOverrides clones c and applies given overrides to the clone, for example:
+//
+//	creators := muxedsocket.GlobalCreators().WithOverrides(func(c *muxedsocket.Creators) {
+//		c.StreamConns().Register("tcp", fakeTCP)
+//	})
+func (c *Creators) WithOverrides(overrides ...func(creators *Creators)) *Creators {
+	clone := c.Clone()
+	for _, override := range overrides {
+		override(clone)
 	}
+	return clone
 }
@@ -0,0 +1,72 @@
+// Package datagram emulates a datagram channel on muxers that have none, such as smux, yamux and nomux. The dialing
+// side opens a dedicated stream right after the session is established and sends a hello on it; the accepting side
+// takes the first stream of the session, answers with a hello of its own and keeps the stream for datagrams. Each
+// datagram is then framed with its length, and both ends use the smaller of their maximum sizes.
+//
+// Datagrams stay unreliable like on a real datagram channel: when a queue is full, the datagram is dropped instead of
+// blocking the sender. If the first stream of an accepted session doesn't start with a hello, the peer doesn't
+// emulate datagrams; the stream is handed out by AcceptStream untouched and SupportsDatagrams reports false. So is a
+// first stream that stays silent until negotiation times out, as some protocols wait for the accepting side to speak
+// first.
+package datagram
+
+import (
+	"errors"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"time"
+)
+
+const (
+	ParamEmulate    = "datagrams"
+	ParamMaxSize    = "maxdatagram"
+	ParamQueueSize  = "datagramqueue"
+	DefaultMaxSize  = 1200
+	DefaultQueue    = 64
+	MaxDatagramSize = 0xffff
+
+	negotiationTimeout = 10 * time.Second
+)
+
+var (
+	ErrNotNegotiated    = errors.New("datagrams not negotiated with peer")
+	ErrDatagramTooLarge = errors.New("datagram too large")
+	ErrBadHello         = errors.New("bad datagram hello")
+
+	errNegotiationTimeout = errors.New("datagram negotiation timed out")
+)
+
+type Options struct {
+	// MaxSize is the largest datagram that is sent or accepted. Peers settle on the smaller of theirs.
+	MaxSize int
+	// QueueSize is how many datagrams are queued in each direction before new ones are dropped.
+	QueueSize int
+	// NegotiationTimeout bounds waiting for the hello of the peer.
+	NegotiationTimeout time.Duration
+}
+
+// OptionsFromParameters reads options from parameters, using defaults for the missing ones.
+func OptionsFromParameters(parameters utils.Parameters) Options {
+	return Options{
+		MaxSize:            utils.IntegerFromParameters(parameters, ParamMaxSize, DefaultMaxSize),
+		QueueSize:          utils.IntegerFromParameters(parameters, ParamQueueSize, DefaultQueue),
+		NegotiationTimeout: negotiationTimeout,
+	}
+}
+
+// Enabled tells whether parameters ask for emulating datagrams.
+func Enabled(parameters utils.Parameters) bool {
+	return utils.BoolFromParameters(parameters, ParamEmulate, false)
+}
+
+func (o Options) normalize() Options {
+	if o.MaxSize <= 0 || o.MaxSize > MaxDatagramSize {
+		o.MaxSize = MaxDatagramSize
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = DefaultQueue
+	}
+	if o.NegotiationTimeout <= 0 {
+		o.NegotiationTimeout = negotiationTimeout
+	}
+	return o
+}
@@ -0,0 +1,398 @@
+package datagram
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/hadi77ir/muxedsocket/types"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+var helloMagic = []byte("MSDG")
+
+const (
+	helloVersion = 1
+	helloSize    = 7
+)
+
+// Socket is a muxed socket with an emulated datagram channel.
+type Socket struct {
+	types.MuxedSocket
+	options Options
+
+	// negotiated is closed once the hello of the peer is received or given up on.
+	negotiated chan struct{}
+	supported  bool
+	maxSize    int
+	stream     types.MuxStream
+	// pending is the first stream of an accepted session, when it turned out not to be the datagram stream.
+	pending      types.MuxStream
+	pendingMutex sync.Mutex
+
+	outgoing chan []byte
+	incoming chan []byte
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+var _ types.DatagramCapableMuxedSocket = &Socket{}
+
+func newSocket(socket types.MuxedSocket, options Options) *Socket {
+	options = options.normalize()
+	return &Socket{
+		MuxedSocket: socket,
+		options:     options,
+		negotiated:  make(chan struct{}),
+		outgoing:    make(chan []byte, options.QueueSize),
+		incoming:    make(chan []byte, options.QueueSize),
+		done:        make(chan struct{}),
+	}
+}
+
+// Client opens the datagram stream on a dialed socket and sends the hello. Reply of the peer is waited for in the
+// background.
+func Client(socket types.MuxedSocket, options Options) (*Socket, error) {
+	s := newSocket(socket, options)
+	stream, err := socket.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = stream.Write(s.hello()); err != nil {
+		_ = stream.Close()
+		return nil, err
+	}
+	go func() {
+		header, err, timedOut := s.readHelloInTime(stream)
+		if err != nil || timedOut {
+			_ = stream.Close()
+			s.finishNegotiation(nil, 0)
+			return
+		}
+		s.finishNegotiation(stream, helloMaxSize(header))
+	}()
+	return s, nil
+}
+
+// Server takes the first stream of an accepted socket, in the background, and answers its hello.
+func Server(socket types.MuxedSocket, options Options) *Socket {
+	s := newSocket(socket, options)
+	go func() {
+		stream, err := socket.AcceptStream()
+		if err != nil {
+			s.finishNegotiation(nil, 0)
+			return
+		}
+		sniffed := newSniffedStream(stream)
+		header, err := s.sniffHelloInTime(sniffed)
+		if err != nil {
+			// not a hello, or not in time. give the stream back to whoever accepts, with what was read of it.
+			s.pendingMutex.Lock()
+			s.pending = sniffed
+			s.pendingMutex.Unlock()
+			s.finishNegotiation(nil, 0)
+			return
+		}
+		if _, err = stream.Write(s.hello()); err != nil {
+			_ = stream.Close()
+			s.finishNegotiation(nil, 0)
+			return
+		}
+		s.finishNegotiation(stream, helloMaxSize(header))
+	}()
+	return s
+}
+
+func (s *Socket) hello() []byte {
+	hello := make([]byte, helloSize)
+	copy(hello, helloMagic)
+	hello[len(helloMagic)] = helloVersion
+	binary.BigEndian.PutUint16(hello[len(helloMagic)+1:], uint16(s.options.MaxSize))
+	return hello
+}
+
+// readHelloInTime reads a hello of the datagram stream, closing it if the hello doesn't arrive within negotiation
+// timeout. Not every muxer supports deadlines on its streams.
+func (s *Socket) readHelloInTime(stream types.MuxStream) (header []byte, err error, timedOut bool) {
+	timer := time.AfterFunc(s.options.NegotiationTimeout, func() {
+		_ = stream.Close()
+	})
+	header, err = readHello(stream)
+	return header, err, !timer.Stop()
+}
+
+// sniffHelloInTime reads a hello from the first stream of peer in background, and stops reading once negotiation times
+// out, leaving the stream as it was.
+func (s *Socket) sniffHelloInTime(stream *sniffedStream) ([]byte, error) {
+	type helloResult struct {
+		header []byte
+		err    error
+	}
+	result := make(chan helloResult, 1)
+	go func() {
+		header, err := readHello(readerFunc(stream.sniff))
+		result <- helloResult{header: header, err: err}
+	}()
+	timer := time.NewTimer(s.options.NegotiationTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-result:
+		return r.header, r.err
+	case <-timer.C:
+		stream.stopSniffing()
+		return nil, errNegotiationTimeout
+	}
+}
+
+// readHello reads a hello. On error, what was read until then is returned.
+func readHello(stream io.Reader) ([]byte, error) {
+	header := make([]byte, helloSize)
+	n, err := io.ReadFull(stream, header[:len(helloMagic)])
+	if err != nil {
+		return header[:n], err
+	}
+	if !bytes.Equal(header[:len(helloMagic)], helloMagic) {
+		return header[:n], ErrBadHello
+	}
+	if _, err = io.ReadFull(stream, header[len(helloMagic):]); err != nil {
+		return header, err
+	}
+	return header, nil
+}
+
+func helloMaxSize(header []byte) int {
+	return int(binary.BigEndian.Uint16(header[len(helloMagic)+1:]))
+}
+
+func (s *Socket) finishNegotiation(stream types.MuxStream, peerMaxSize int) {
+	if stream != nil && peerMaxSize > 0 {
+		s.stream = stream
+		s.supported = true
+		s.maxSize = s.options.MaxSize
+		if peerMaxSize < s.maxSize {
+			s.maxSize = peerMaxSize
+		}
+		go s.sendLoop()
+		go s.receiveLoop()
+	} else if stream != nil {
+		_ = stream.Close()
+	}
+	close(s.negotiated)
+}
+
+func (s *Socket) sendLoop() {
+	defer s.shutdown()
+	frame := make([]byte, 2+s.maxSize)
+	for {
+		select {
+		case <-s.done:
+			return
+		case datagram := <-s.outgoing:
+			binary.BigEndian.PutUint16(frame, uint16(len(datagram)))
+			n := copy(frame[2:], datagram)
+			if _, err := s.stream.Write(frame[:2+n]); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Socket) receiveLoop() {
+	defer s.shutdown()
+	header := make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(s.stream, header); err != nil {
+			return
+		}
+		size := int(binary.BigEndian.Uint16(header))
+		if size > s.maxSize {
+			// peer doesn't respect the size agreed on.
+			return
+		}
+		datagram := make([]byte, size)
+		if _, err := io.ReadFull(s.stream, datagram); err != nil {
+			return
+		}
+		select {
+		case s.incoming <- datagram:
+		default:
+			// queue is full; drop, like a congested network would.
+		}
+	}
+}
+
+// shutdown stops the datagram channel, leaving streams alone.
+func (s *Socket) shutdown() {
+	s.doneOnce.Do(func() {
+		close(s.done)
+		select {
+		case <-s.negotiated:
+			if s.stream != nil {
+				_ = s.stream.Close()
+			}
+		default:
+			// stream is closed along with the socket.
+		}
+	})
+}
+
+func (s *Socket) waitNegotiation() bool {
+	select {
+	case <-s.negotiated:
+		return s.supported
+	case <-s.MuxedSocket.CloseChan():
+		return false
+	}
+}
+
+// SupportsDatagrams waits for negotiation to finish, and reports whether peer emulates datagrams too.
+func (s *Socket) SupportsDatagrams() (bool, error) {
+	if s.waitNegotiation() {
+		return true, nil
+	}
+	select {
+	case <-s.negotiated:
+		return false, nil
+	default:
+		return false, net.ErrClosed
+	}
+}
+
+// SendDatagram queues b to be sent. If queue is full, b is dropped silently.
+func (s *Socket) SendDatagram(b []byte) error {
+	if !s.waitNegotiation() {
+		return ErrNotNegotiated
+	}
+	if len(b) > s.maxSize {
+		return ErrDatagramTooLarge
+	}
+	select {
+	case <-s.done:
+		return net.ErrClosed
+	default:
+	}
+	select {
+	case s.outgoing <- append([]byte{}, b...):
+	default:
+	}
+	return nil
+}
+
+func (s *Socket) ReceiveDatagram() ([]byte, error) {
+	if !s.waitNegotiation() {
+		return nil, ErrNotNegotiated
+	}
+	select {
+	case datagram := <-s.incoming:
+		return datagram, nil
+	case <-s.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// AcceptStream accepts streams of the peer, never giving out the datagram stream.
+func (s *Socket) AcceptStream() (types.MuxStream, error) {
+	s.waitNegotiation()
+	s.pendingMutex.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.pendingMutex.Unlock()
+	if pending != nil {
+		return pending, nil
+	}
+	return s.MuxedSocket.AcceptStream()
+}
+
+func (s *Socket) Close() error {
+	s.shutdown()
+	return s.MuxedSocket.Close()
+}
+
+// Redial redials the underlying socket, and emulates datagrams on the new one as well.
+func (s *Socket) Redial() (types.Socket, error) {
+	socket, err := s.MuxedSocket.Redial()
+	if err != nil {
+		return nil, err
+	}
+	muxed, ok := socket.(types.MuxedSocket)
+	if !ok {
+		return socket, nil
+	}
+	emulated, err := Client(muxed, s.options)
+	if err != nil {
+		_ = muxed.Close()
+		return nil, err
+	}
+	return emulated, nil
+}
+
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(b []byte) (int, error) {
+	return f(b)
+}
+
+// sniffedStream keeps what is read of a stream while looking for a hello, and replays it before reading more. A read
+// that is still blocked when sniffing stops is waited for, as streams may not support deadlines to cut it short.
+type sniffedStream struct {
+	types.MuxStream
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	stopped  bool
+	inFlight bool
+	read     []byte
+	readErr  error
+}
+
+func newSniffedStream(stream types.MuxStream) *sniffedStream {
+	s := &sniffedStream{MuxStream: stream}
+	s.cond = sync.NewCond(&s.mutex)
+	return s
+}
+
+// sniff reads from stream, keeping what it reads for replay.
+func (s *sniffedStream) sniff(b []byte) (int, error) {
+	s.mutex.Lock()
+	if s.stopped {
+		s.mutex.Unlock()
+		return 0, errNegotiationTimeout
+	}
+	s.inFlight = true
+	s.mutex.Unlock()
+	n, err := s.MuxStream.Read(b)
+	s.mutex.Lock()
+	s.read = append(s.read, b[:n]...)
+	s.readErr = err
+	s.inFlight = false
+	s.cond.Broadcast()
+	s.mutex.Unlock()
+	return n, err
+}
+
+func (s *sniffedStream) stopSniffing() {
+	s.mutex.Lock()
+	s.stopped = true
+	s.mutex.Unlock()
+}
+
+func (s *sniffedStream) Read(b []byte) (int, error) {
+	s.mutex.Lock()
+	for s.inFlight {
+		s.cond.Wait()
+	}
+	if len(s.read) > 0 {
+		n := copy(b, s.read)
+		s.read = s.read[n:]
+		s.mutex.Unlock()
+		return n, nil
+	}
+	if s.readErr != nil {
+		err := s.readErr
+		s.readErr = nil
+		s.mutex.Unlock()
+		return 0, err
+	}
+	s.mutex.Unlock()
+	return s.MuxStream.Read(b)
+}
@@ -0,0 +1,257 @@
+package datagram
+
+import (
+	"bytes"
+	"errors"
+	"github.com/hadi77ir/muxedsocket/types"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errNoDeadlines = errors.New("deadlines not supported")
+
+// pipeStream is a stream of pipeMux. Like streams of some muxers, it doesn't support deadlines.
+type pipeStream struct {
+	net.Conn
+}
+
+func (s pipeStream) CloseChan() <-chan struct{} {
+	return nil
+}
+
+func (s pipeStream) CanRedial() bool {
+	return false
+}
+
+func (s pipeStream) Redial() (types.Socket, error) {
+	return nil, net.ErrClosed
+}
+
+func (s pipeStream) StreamID() int {
+	return 0
+}
+
+func (s pipeStream) SetDeadline(time.Time) error {
+	return errNoDeadlines
+}
+
+func (s pipeStream) SetReadDeadline(time.Time) error {
+	return errNoDeadlines
+}
+
+func (s pipeStream) SetWriteDeadline(time.Time) error {
+	return errNoDeadlines
+}
+
+// pipeMux is one end of a muxed session whose streams are net.Pipe connections.
+type pipeMux struct {
+	peer      *pipeMux
+	accepted  chan types.MuxStream
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func pipeMuxPair() (*pipeMux, *pipeMux) {
+	a := &pipeMux{accepted: make(chan types.MuxStream, 8), closed: make(chan struct{})}
+	b := &pipeMux{accepted: make(chan types.MuxStream, 8), closed: make(chan struct{})}
+	a.peer, b.peer = b, a
+	return a, b
+}
+
+func (m *pipeMux) OpenStream() (types.MuxStream, error) {
+	local, remote := net.Pipe()
+	m.peer.accepted <- pipeStream{remote}
+	return pipeStream{local}, nil
+}
+
+func (m *pipeMux) AcceptStream() (types.MuxStream, error) {
+	select {
+	case stream := <-m.accepted:
+		return stream, nil
+	case <-m.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (m *pipeMux) CloseChan() <-chan struct{} {
+	return m.closed
+}
+
+func (m *pipeMux) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.closed)
+	})
+	return nil
+}
+
+func (m *pipeMux) LocalAddr() net.Addr {
+	return nil
+}
+
+func (m *pipeMux) RemoteAddr() net.Addr {
+	return nil
+}
+
+func (m *pipeMux) CanRedial() bool {
+	return false
+}
+
+func (m *pipeMux) Redial() (types.Socket, error) {
+	return nil, net.ErrClosed
+}
+
+func TestNegotiation(t *testing.T) {
+	a, b := pipeMuxPair()
+	server := Server(b, Options{MaxSize: 500})
+	defer server.Close()
+	client, err := Client(a, Options{MaxSize: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	go func() {
+		stream, _ := client.OpenStream()
+		_, _ = stream.Write([]byte("stream"))
+	}()
+	if supported, err := client.SupportsDatagrams(); !supported || err != nil {
+		t.Fatal(supported, err)
+	}
+	if supported, err := server.SupportsDatagrams(); !supported || err != nil {
+		t.Fatal(supported, err)
+	}
+	// peers settle on the smaller maximum size.
+	if err := client.SendDatagram(make([]byte, 600)); err != ErrDatagramTooLarge {
+		t.Fatal(err)
+	}
+
+	if err := client.SendDatagram([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	datagram, err := server.ReceiveDatagram()
+	if err != nil || string(datagram) != "ping" {
+		t.Fatal(string(datagram), err)
+	}
+	if err := server.SendDatagram([]byte("pong")); err != nil {
+		t.Fatal(err)
+	}
+	datagram, err = client.ReceiveDatagram()
+	if err != nil || string(datagram) != "pong" {
+		t.Fatal(string(datagram), err)
+	}
+
+	// the datagram stream is never handed out.
+	stream, err := server.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 6)
+	if _, err := stream.Read(buf); err != nil || string(buf) != "stream" {
+		t.Fatal(string(buf), err)
+	}
+}
+
+func TestNegotiationWithPlainPeer(t *testing.T) {
+	a, b := pipeMuxPair()
+	server := Server(b, Options{NegotiationTimeout: time.Second})
+	defer server.Close()
+	go func() {
+		stream, _ := a.OpenStream()
+		_, _ = stream.Write([]byte("plain data"))
+	}()
+	if supported, err := server.SupportsDatagrams(); supported || err != nil {
+		t.Fatal(supported, err)
+	}
+	stream, err := server.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 10)
+	n := 0
+	for n < len(buf) {
+		read, err := stream.Read(buf[n:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		n += read
+	}
+	if !bytes.Equal(buf, []byte("plain data")) {
+		t.Fatal(string(buf))
+	}
+}
+
+func TestSilentFirstStreamIsHandedOut(t *testing.T) {
+	a, b := pipeMuxPair()
+	server := Server(b, Options{NegotiationTimeout: 200 * time.Millisecond})
+	defer server.Close()
+	peer, _ := a.OpenStream()
+	// a part of magic, then nothing until negotiation times out.
+	go func() {
+		_, _ = peer.Write(helloMagic[:2])
+	}()
+	if supported, err := server.SupportsDatagrams(); supported || err != nil {
+		t.Fatal(supported, err)
+	}
+
+	stream, err := server.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_, _ = peer.Write([]byte("Xdata"))
+	}()
+	expected := append(append([]byte{}, helloMagic[:2]...), "Xdata"...)
+	buf := make([]byte, len(expected))
+	n := 0
+	for n < len(buf) {
+		read, err := stream.Read(buf[n:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		n += read
+	}
+	if !bytes.Equal(buf, expected) {
+		t.Fatal(string(buf))
+	}
+
+	// stream is left open for the accepting side to speak.
+	go func() {
+		_, _ = stream.Write([]byte("reply"))
+	}()
+	reply := make([]byte, 5)
+	if _, err := peer.Read(reply); err != nil || string(reply) != "reply" {
+		t.Fatal(string(reply), err)
+	}
+}
+
+func TestNegotiationTimeout(t *testing.T) {
+	a, b := pipeMuxPair()
+	// nothing answers on b, and streams don't support deadlines.
+	defer b.Close()
+	go func() {
+		stream, _ := b.AcceptStream()
+		hello := make([]byte, helloSize)
+		_, _ = stream.Read(hello)
+	}()
+	client, err := Client(a, Options{NegotiationTimeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	result := make(chan bool, 1)
+	go func() {
+		supported, _ := client.SupportsDatagrams()
+		result <- supported
+	}()
+	select {
+	case supported := <-result:
+		if supported {
+			t.Fatal("negotiated with a silent peer")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("negotiation didn't time out")
+	}
+}
@@ -0,0 +1,73 @@
+package datagram
+
+import (
+	"context"
+	"github.com/hadi77ir/muxedsocket/types"
+	"net"
+)
+
+// DialContext makes sockets dialed by dialFunc emulate datagrams. Sockets that have a datagram channel of their own
+// are left as they are.
+func DialContext(dialFunc types.MuxDialContextFunc, options Options) types.MuxDialContextFunc {
+	return func(ctx context.Context) (types.MuxedSocket, error) {
+		socket, err := dialFunc(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if _, capable := socket.(types.DatagramCapableMuxedSocket); capable {
+			return socket, nil
+		}
+		emulated, err := Client(socket, options)
+		if err != nil {
+			_ = socket.Close()
+			return nil, err
+		}
+		return emulated, nil
+	}
+}
+
+// ListenContext makes sockets accepted by listeners of listenFunc emulate datagrams, except for the ones having a
+// datagram channel of their own.
+func ListenContext(listenFunc types.MuxListenContextFunc, options Options) types.MuxListenContextFunc {
+	return func(ctx context.Context) (types.MuxedListener, error) {
+		listener, err := listenFunc(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &Listener{listener: listener, options: options}, nil
+	}
+}
+
+type Listener struct {
+	listener types.MuxedListener
+	options  Options
+}
+
+func (l *Listener) AcceptMuxed() (types.MuxedSocket, error) {
+	socket, err := l.listener.AcceptMuxed()
+	if err != nil {
+		return nil, err
+	}
+	if _, capable := socket.(types.DatagramCapableMuxedSocket); capable {
+		return socket, nil
+	}
+	return Server(socket, l.options), nil
+}
+
+func (l *Listener) Accept() (types.Socket, error) {
+	return l.AcceptMuxed()
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+func (l *Listener) CloseChan() <-chan struct{} {
+	return l.listener.CloseChan()
+}
+
+func (l *Listener) Close() error {
+	return l.listener.Close()
+}
+
+var _ types.MuxedListener = &Listener{}
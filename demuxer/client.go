@@ -1,6 +1,7 @@
 package demuxer
 
 import (
+	"context"
 	"github.com/hadi77ir/muxedsocket/types"
 	"github.com/hadi77ir/muxedsocket/utils"
 	"sync"
@@ -11,7 +12,16 @@ func DemuxDialer(dialFunc types.MuxDialFunc, parameters utils.Parameters) types.
 	return demuxer.Dial
 }
 
+func DemuxDialContext(dialFunc types.MuxDialContextFunc, parameters utils.Parameters) types.StreamDialContextFunc {
+	demuxer := CreateClientContextDemuxer(dialFunc, parameters)
+	return demuxer.DialContext
+}
+
 func CreateClientDemuxer(dialFunc types.MuxDialFunc, parameters utils.Parameters) *ClientDemuxer {
+	return CreateClientContextDemuxer(dialFunc.WithContext(), parameters)
+}
+
+func CreateClientContextDemuxer(dialFunc types.MuxDialContextFunc, parameters utils.Parameters) *ClientDemuxer {
 	return &ClientDemuxer{
 		dialFunc:             dialFunc,
 		streamsPerConnection: utils.IntegerFromParameters(parameters, "streamsperconn", 1),
@@ -20,26 +30,30 @@ func CreateClientDemuxer(dialFunc types.MuxDialFunc, parameters utils.Parameters
 
 type ClientDemuxer struct {
 	streamsPerConnection int
-	dialFunc             types.MuxDialFunc
+	dialFunc             types.MuxDialContextFunc
 	connection           types.MuxedSocket
-	connectionMutex      *sync.Mutex
+	connectionMutex      sync.Mutex
 	currentIteration     int
 }
 
 func (d *ClientDemuxer) Dial() (types.StreamConn, error) {
+	return d.DialContext(context.Background())
+}
+
+func (d *ClientDemuxer) DialContext(ctx context.Context) (types.StreamConn, error) {
 	d.connectionMutex.Lock()
 	defer func() {
 		d.currentIteration++
 		d.connectionMutex.Unlock()
 	}()
 	d.currentIteration = d.currentIteration % d.streamsPerConnection
-	err := d.reconnectIfNeeded()
+	err := d.reconnectIfNeeded(ctx)
 	if err != nil {
 		return nil, err
 	}
 	return d.connection.OpenStream()
 }
-func (d *ClientDemuxer) reconnectIfNeeded() error {
+func (d *ClientDemuxer) reconnectIfNeeded(ctx context.Context) error {
 	reconnect := false
 	if d.currentIteration == 0 {
 		reconnect = true
@@ -52,7 +66,7 @@ func (d *ClientDemuxer) reconnectIfNeeded() error {
 		}
 	}
 	if reconnect {
-		conn, err := d.dialFunc()
+		conn, err := d.dialFunc(ctx)
 		if err != nil {
 			return err
 		}
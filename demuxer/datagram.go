@@ -0,0 +1,352 @@
+package demuxer
+
+import (
+	"context"
+	"errors"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"net"
+	"sync"
+)
+
+const datagramQueueSize = 64
+
+// same as muxedsocket.ErrRedialNotSupported, which can't be imported here.
+var errRedialNotSupported = errors.New("redial not supported")
+
+// PacketAdapterFunc puts packets on top of streams, when datagrams are not available.
+type PacketAdapterFunc[TStreamFunc any] func(streams TStreamFunc) (types.PacketConnContextFunc, error)
+
+// SupportsDatagrams reports whether packets can be sent over socket as datagrams.
+func SupportsDatagrams(socket types.MuxedSocket) bool {
+	capable, ok := socket.(types.DatagramCapableMuxedSocket)
+	if !ok {
+		return false
+	}
+	supported, err := capable.SupportsDatagrams()
+	return err == nil && supported
+}
+
+// DatagramDialContext turns a mux dialer into a packet dialer. If the dialed socket supports datagrams, packets are
+// sent as datagrams; otherwise the socket is demuxed into streams and handed to fallback.
+func DatagramDialContext(dialFunc types.MuxDialContextFunc, fallback PacketAdapterFunc[types.StreamDialContextFunc], parameters utils.Parameters) types.PacketConnContextFunc {
+	var connFunc types.PacketConnContextFunc
+	connFunc = func(ctx context.Context) (types.PacketConn, error) {
+		socket, err := dialFunc(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if SupportsDatagrams(socket) {
+			return newDatagramClient(socket.(types.DatagramCapableMuxedSocket), connFunc), nil
+		}
+		packetFunc, err := fallback(DemuxDialContext(reuseFirst(socket, dialFunc), parameters))
+		if err != nil {
+			_ = socket.Close()
+			return nil, err
+		}
+		conn, err := packetFunc(ctx)
+		if err != nil {
+			// nothing holds on to socket once packet adapter fails.
+			_ = socket.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+	return connFunc
+}
+
+// reuseFirst gives out socket on first call, and dials afterwards.
+func reuseFirst(socket types.MuxedSocket, dialFunc types.MuxDialContextFunc) types.MuxDialContextFunc {
+	var mutex sync.Mutex
+	return func(ctx context.Context) (types.MuxedSocket, error) {
+		mutex.Lock()
+		first := socket
+		socket = nil
+		mutex.Unlock()
+		if first != nil {
+			return first, nil
+		}
+		return dialFunc(ctx)
+	}
+}
+
+// datagramClient is a packet connection over datagrams of a single muxed socket.
+type datagramClient struct {
+	*utils.PacketQueue
+	socket types.DatagramCapableMuxedSocket
+	redial types.PacketConnContextFunc
+}
+
+func newDatagramClient(socket types.DatagramCapableMuxedSocket, redial types.PacketConnContextFunc) *datagramClient {
+	c := &datagramClient{
+		PacketQueue: utils.NewPacketQueue(datagramQueueSize),
+		socket:      socket,
+		redial:      redial,
+	}
+	go c.receive()
+	return c
+}
+
+func (c *datagramClient) receive() {
+	defer c.Close()
+	for {
+		datagram, err := c.socket.ReceiveDatagram()
+		if err != nil {
+			return
+		}
+		// datagrams are unreliable anyway; one that finds the queue full is dropped.
+		if !c.TryDeliver(datagram, c.socket.RemoteAddr()) {
+			return
+		}
+	}
+}
+
+// WriteTo sends p as a datagram to the peer, whatever addr is.
+func (c *datagramClient) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if c.IsClosed() {
+		return 0, net.ErrClosed
+	}
+	if err := c.socket.SendDatagram(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *datagramClient) Close() error {
+	if !c.Shutdown() {
+		return nil
+	}
+	return c.socket.Close()
+}
+
+func (c *datagramClient) LocalAddr() net.Addr {
+	return c.socket.LocalAddr()
+}
+
+func (c *datagramClient) RemoteAddr() net.Addr {
+	return c.socket.RemoteAddr()
+}
+
+func (c *datagramClient) CanRedial() bool {
+	return true
+}
+
+// Redial dials a new socket. It may end up using fallback, if the new one doesn't support datagrams.
+func (c *datagramClient) Redial() (types.Socket, error) {
+	return c.redial(context.Background())
+}
+
+var _ types.PacketConn = &datagramClient{}
+
+// DatagramListenContext turns a mux listener into a packet listener. Each accepted socket is a peer of its own, at its
+// remote address. Sockets that support datagrams exchange packets as datagrams; streams of the rest are handed to
+// fallback, whose packets are merged in.
+func DatagramListenContext(listenFunc types.MuxListenContextFunc, fallback PacketAdapterFunc[types.StreamListenContextFunc], parameters utils.Parameters) types.PacketConnContextFunc {
+	backlog := utils.IntegerFromParameters(parameters, "backlog", 1000)
+	return func(ctx context.Context) (types.PacketConn, error) {
+		listener, err := listenFunc(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s := &datagramServer{
+			PacketQueue: utils.NewPacketQueue(datagramQueueSize),
+			listener:    listener,
+			sessions:    make(map[string]types.DatagramCapableMuxedSocket),
+			streams:     newStreamFeed(listener, backlog),
+		}
+		fallbackFunc, err := fallback(func(ctx context.Context) (types.StreamListener, error) {
+			return s.streams, nil
+		})
+		if err == nil {
+			s.fallback, err = fallbackFunc(ctx)
+		}
+		if err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+		go s.acceptLoop()
+		go s.receiveFallback()
+		return s, nil
+	}
+}
+
+type datagramServer struct {
+	*utils.PacketQueue
+	listener types.MuxedListener
+	streams  *streamFeed
+	fallback types.PacketConn
+
+	mutex    sync.Mutex
+	sessions map[string]types.DatagramCapableMuxedSocket
+}
+
+func (s *datagramServer) acceptLoop() {
+	defer s.Close()
+	for {
+		socket, err := s.listener.AcceptMuxed()
+		if err != nil {
+			return
+		}
+		if SupportsDatagrams(socket) {
+			go s.receive(socket.(types.DatagramCapableMuxedSocket))
+		} else {
+			go s.streams.feedFrom(socket)
+		}
+	}
+}
+
+func (s *datagramServer) receive(socket types.DatagramCapableMuxedSocket) {
+	key := socket.RemoteAddr().String()
+	s.mutex.Lock()
+	s.sessions[key] = socket
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		if s.sessions[key] == socket {
+			delete(s.sessions, key)
+		}
+		s.mutex.Unlock()
+		_ = socket.Close()
+	}()
+	for {
+		datagram, err := socket.ReceiveDatagram()
+		if err != nil {
+			return
+		}
+		// datagrams are unreliable anyway; one that finds the queue full is dropped.
+		if !s.TryDeliver(datagram, socket.RemoteAddr()) {
+			return
+		}
+	}
+}
+
+func (s *datagramServer) receiveFallback() {
+	buffer := make([]byte, 0xffff)
+	for {
+		n, addr, err := s.fallback.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		// blocking here would stall fallback packets of every peer.
+		if !s.TryDeliver(append([]byte{}, buffer[:n]...), addr) {
+			return
+		}
+	}
+}
+
+// WriteTo sends p to the session at addr, as a datagram if it supports them, or through fallback if it doesn't.
+func (s *datagramServer) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if s.IsClosed() {
+		return 0, net.ErrClosed
+	}
+	var socket types.DatagramCapableMuxedSocket
+	found := false
+	if addr != nil {
+		s.mutex.Lock()
+		socket, found = s.sessions[addr.String()]
+		s.mutex.Unlock()
+	}
+	if !found {
+		return s.fallback.WriteTo(p, addr)
+	}
+	if err := socket.SendDatagram(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *datagramServer) Close() error {
+	s.mutex.Lock()
+	if !s.Shutdown() {
+		s.mutex.Unlock()
+		return nil
+	}
+	sessions := make([]types.DatagramCapableMuxedSocket, 0, len(s.sessions))
+	for _, socket := range s.sessions {
+		sessions = append(sessions, socket)
+	}
+	s.mutex.Unlock()
+	err := s.listener.Close()
+	_ = s.fallback.Close()
+	for _, socket := range sessions {
+		_ = socket.Close()
+	}
+	return err
+}
+
+func (s *datagramServer) LocalAddr() net.Addr {
+	return s.listener.Addr()
+}
+
+func (s *datagramServer) RemoteAddr() net.Addr {
+	return nil
+}
+
+func (s *datagramServer) CanRedial() bool {
+	return false
+}
+
+func (s *datagramServer) Redial() (types.Socket, error) {
+	return nil, errRedialNotSupported
+}
+
+var _ types.PacketConn = &datagramServer{}
+
+// streamFeed is a stream listener giving out streams of the sockets fed to it.
+type streamFeed struct {
+	listener types.MuxedListener
+	backlog  chan types.StreamConn
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func newStreamFeed(listener types.MuxedListener, backlog int) *streamFeed {
+	return &streamFeed{listener: listener, backlog: make(chan types.StreamConn, backlog), closed: make(chan struct{})}
+}
+
+func (f *streamFeed) feedFrom(socket types.MuxedSocket) {
+	for {
+		stream, err := socket.AcceptStream()
+		if err != nil {
+			_ = socket.Close()
+			return
+		}
+		select {
+		case f.backlog <- stream:
+		case <-f.closed:
+			_ = stream.Close()
+			_ = socket.Close()
+			return
+		}
+	}
+}
+
+func (f *streamFeed) AcceptConn() (types.StreamConn, error) {
+	select {
+	case stream := <-f.backlog:
+		return stream, nil
+	case <-f.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (f *streamFeed) Accept() (types.Socket, error) {
+	return f.AcceptConn()
+}
+
+func (f *streamFeed) Addr() net.Addr {
+	return f.listener.Addr()
+}
+
+func (f *streamFeed) CloseChan() <-chan struct{} {
+	return f.closed
+}
+
+func (f *streamFeed) Close() error {
+	f.once.Do(func() {
+		close(f.closed)
+	})
+	return nil
+}
+
+var _ types.StreamListener = &streamFeed{}
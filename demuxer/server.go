@@ -1,6 +1,7 @@
 package demuxer
 
 import (
+	"context"
 	"github.com/hadi77ir/muxedsocket/types"
 	"github.com/hadi77ir/muxedsocket/utils"
 	"net"
@@ -13,7 +14,16 @@ func DemuxListener(listenFunc types.MuxListenFunc, parameters utils.Parameters)
 	return demuxer.Listen
 }
 
+func DemuxListenContext(listenFunc types.MuxListenContextFunc, parameters utils.Parameters) types.StreamListenContextFunc {
+	demuxer := CreateServerContextDemuxer(listenFunc, parameters)
+	return demuxer.ListenContext
+}
+
 func CreateServerDemuxer(listenFunc types.MuxListenFunc, parameters utils.Parameters) *ServerDemuxer {
+	return CreateServerContextDemuxer(listenFunc.WithContext(), parameters)
+}
+
+func CreateServerContextDemuxer(listenFunc types.MuxListenContextFunc, parameters utils.Parameters) *ServerDemuxer {
 	return &ServerDemuxer{
 		listenFunc:          listenFunc,
 		streamAcceptBacklog: utils.IntegerFromParameters(parameters, "backlog", 1000),
@@ -21,12 +31,16 @@ func CreateServerDemuxer(listenFunc types.MuxListenFunc, parameters utils.Parame
 }
 
 type ServerDemuxer struct {
-	listenFunc          types.MuxListenFunc
+	listenFunc          types.MuxListenContextFunc
 	streamAcceptBacklog int
 }
 
 func (d *ServerDemuxer) Listen() (types.StreamListener, error) {
-	listener, err := d.listenFunc()
+	return d.ListenContext(context.Background())
+}
+
+func (d *ServerDemuxer) ListenContext(ctx context.Context) (types.StreamListener, error) {
+	listener, err := d.listenFunc(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,7 @@
 package muxedsocket
 
 import (
+	"context"
 	"github.com/hadi77ir/muxedsocket/chaining"
 	"github.com/hadi77ir/muxedsocket/types"
 	"github.com/hadi77ir/muxedsocket/utils"
@@ -10,9 +11,10 @@ import (
 
 type DialFuncCreator[TFunc any] func(addr string, parameters utils.Parameters) (TFunc, error)
 type MuxDialFuncCreator DialFuncCreator[types.MuxDialFunc]
+type MuxDialContextFuncCreator DialFuncCreator[types.MuxDialContextFunc]
 
 func ConstructDialFuncCreatorWithRegistry(creators *Creators, scheme string) (MuxDialFuncCreator, error) {
-	if solution, found := creators.AddrSolutions().Get(scheme); found && solution != nil {
+	if solution, found := getAddrSolution(creators, scheme); found {
 		return solution.Client, nil
 	}
 	schemeParts := GetSchemeParts(scheme)
@@ -26,10 +28,38 @@ func ConstructDialFuncCreator(scheme string) (MuxDialFuncCreator, error) {
 	return ConstructDialFuncCreatorWithRegistry(creators, scheme)
 }
 
+func ConstructContextDialFuncCreatorWithRegistry(creators *Creators, scheme string) (MuxDialContextFuncCreator, error) {
+	if solution, found := getAddrSolution(creators, scheme); found {
+		if contextSolution, ok := solution.(types.AddrSolutionContextImplementation); ok {
+			return contextSolution.ClientContext, nil
+		}
+		return func(addr string, parameters utils.Parameters) (types.MuxDialContextFunc, error) {
+			dialFunc, err := solution.Client(addr, parameters)
+			if err != nil {
+				return nil, err
+			}
+			return dialFunc.WithContext(), nil
+		}, nil
+	}
+	schemeParts := GetSchemeParts(scheme)
+	chainer, err := chaining.CreateMuxLayersChainer(creators, GetDefaults(creators), schemeParts)
+	if err != nil {
+		return nil, err
+	}
+	return chainer.ConstructDialContextFunc, nil
+}
+
+func ConstructContextDialFuncCreator(scheme string) (MuxDialContextFuncCreator, error) {
+	return ConstructContextDialFuncCreatorWithRegistry(creators, scheme)
+}
+
 func CreateDialerWithRegistry(creators *Creators, addr *url.URL) (types.MuxDialFunc, error) {
 	if addr == nil {
 		return nil, net.InvalidAddrError("address was nil")
 	}
+	if err := validateIfStrict(creators, addr, false); err != nil {
+		return nil, err
+	}
 	creatorFunc, err := ConstructDialFuncCreatorWithRegistry(creators, addr.Scheme)
 	if err != nil {
 		return nil, err
@@ -41,6 +71,26 @@ func CreateDialer(addr *url.URL) (types.MuxDialFunc, error) {
 	return CreateDialerWithRegistry(creators, addr)
 }
 
+// CreateContextDialerWithRegistry is like CreateDialerWithRegistry, but the returned function takes a context that
+// bounds establishing the whole chain of layers.
+func CreateContextDialerWithRegistry(creators *Creators, addr *url.URL) (types.MuxDialContextFunc, error) {
+	if addr == nil {
+		return nil, net.InvalidAddrError("address was nil")
+	}
+	if err := validateIfStrict(creators, addr, false); err != nil {
+		return nil, err
+	}
+	creatorFunc, err := ConstructContextDialFuncCreatorWithRegistry(creators, addr.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	return creatorFunc(addr.Host, utils.ParametersFromURL(addr.Query()))
+}
+
+func CreateContextDialer(addr *url.URL) (types.MuxDialContextFunc, error) {
+	return CreateContextDialerWithRegistry(creators, addr)
+}
+
 func DialURIWithRegistry(creators *Creators, uri string) (types.MuxedSocket, error) {
 	parsed, err := url.Parse(uri)
 	if err != nil {
@@ -56,3 +106,21 @@ func DialURIWithRegistry(creators *Creators, uri string) (types.MuxedSocket, err
 func DialURI(uri string) (types.MuxedSocket, error) {
 	return DialURIWithRegistry(creators, uri)
 }
+
+// DialURIWithRegistryContext dials the given URI. Cancelling ctx or reaching its deadline aborts any layer that is
+// still being established. Once the socket is returned, ctx has no effect on it.
+func DialURIWithRegistryContext(ctx context.Context, creators *Creators, uri string) (types.MuxedSocket, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	dialer, err := CreateContextDialerWithRegistry(creators, parsed)
+	if err != nil {
+		return nil, err
+	}
+	return dialer(ctx)
+}
+
+func DialURIContext(ctx context.Context, uri string) (types.MuxedSocket, error) {
+	return DialURIWithRegistryContext(ctx, creators, uri)
+}
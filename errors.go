@@ -1,13 +1,20 @@
 package muxedsocket
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 var (
 	ErrSchemeNotSupported    = errors.New("scheme not supported")
 	ErrRedialNotSupported    = errors.New("redial not supported")
 	ErrInvalidChainingResult = errors.New("invalid chaining result")
 	ErrOpNotSupported        = errors.New("not supported")
-	// ErrIncompatibleChainOfLayers = errors.New("incompatible mix of layers")
+	ErrConnAlreadyUsed       = errors.New("injected connection has already been used")
+	ErrPacketTooLarge        = errors.New("packet too large")
+	ErrUnknownPeer           = errors.New("unknown peer")
+	ErrNoRemoteAddr          = errors.New("packet connection has no remote address to dial")
 )
 
 type ErrMissingPart string
@@ -17,3 +24,50 @@ func (e ErrMissingPart) Error() string {
 }
 
 var _ error = ErrMissingPart("")
+
+// ErrIncompatibleChainOfLayers is returned when a layer can't be put on top of the one below it, even with a default
+// adapter filling the gap. Position is the index of the upper layer in scheme parts.
+type ErrIncompatibleChainOfLayers struct {
+	Above    string
+	Below    string
+	Position int
+}
+
+func (e ErrIncompatibleChainOfLayers) Error() string {
+	if e.Below == "" {
+		return fmt.Sprintf("incompatible mix of layers: nothing to put %q on, at position %d", e.Above, e.Position)
+	}
+	return fmt.Sprintf("incompatible mix of layers: %q can't be put on %q, at position %d", e.Above, e.Below, e.Position)
+}
+
+var _ error = ErrIncompatibleChainOfLayers{}
+
+// ParameterProblem describes a single parameter that failed validation.
+type ParameterProblem struct {
+	Key    string
+	Reason string
+}
+
+// ErrInvalidParameters is returned by validation, listing every problem that was found at once.
+type ErrInvalidParameters struct {
+	Problems []ParameterProblem
+}
+
+func (e ErrInvalidParameters) Error() string {
+	messages := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		messages[i] = fmt.Sprintf("%q: %s", problem.Key, problem.Reason)
+	}
+	return "invalid parameters: " + strings.Join(messages, "; ")
+}
+
+var _ error = ErrInvalidParameters{}
+
+// ErrAliasCycle is returned when an alias expands to itself. It holds the aliases that form the cycle, in order.
+type ErrAliasCycle []string
+
+func (e ErrAliasCycle) Error() string {
+	return "alias cycle: " + strings.Join(e, " -> ")
+}
+
+var _ error = ErrAliasCycle{}
@@ -0,0 +1,25 @@
+package muxedsocket
+
+import (
+	"github.com/hadi77ir/muxedsocket/chaining"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"net/url"
+)
+
+// ExplainWithRegistry reports the layers that DialURIWithRegistry and ListenURIWithRegistry would chain for given
+// URI, along with parameters each of them receives. Nothing is dialed or listened on.
+func ExplainWithRegistry(creators *Creators, uri string) (*chaining.Explanation, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	parameters := utils.ParametersFromURL(parsed.Query())
+	if _, found := getAddrSolution(creators, parsed.Scheme); found {
+		return chaining.ExplainAddrSolution(creators, parsed.Scheme, parsed.Host, parameters), nil
+	}
+	return chaining.ExplainMuxLayers(creators, GetDefaults(creators), GetSchemeParts(parsed.Scheme), parsed.Host, parameters)
+}
+
+func Explain(uri string) (*chaining.Explanation, error) {
+	return ExplainWithRegistry(creators, uri)
+}
@@ -0,0 +1,85 @@
+package http
+
+import (
+	"bufio"
+	"github.com/hadi77ir/muxedsocket/basics/stream"
+	"net"
+	"net/http"
+)
+
+// bufferedConn is a connection whose beginning was already read into a buffer, while parsing HTTP headers.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func newBufferedConn(conn net.Conn, reader *bufio.Reader) net.Conn {
+	if reader.Buffered() == 0 {
+		return conn
+	}
+	return &bufferedConn{Conn: conn, reader: reader}
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	if c.reader.Buffered() == 0 {
+		return c.Conn.Read(b)
+	}
+	return c.reader.Read(b)
+}
+
+// tunnelConn is a connection carried by bodies of a request and its response, given deadlines.
+type tunnelConn struct {
+	*stream.DeadlineConn
+	fifo *stream.DoubleFifoConn
+}
+
+func newTunnelConn(fifo *stream.DoubleFifoConn) *tunnelConn {
+	return &tunnelConn{DeadlineConn: stream.WrapDeadlineConn(fifo), fifo: fifo}
+}
+
+func (c *tunnelConn) CloseChan() <-chan struct{} {
+	return c.fifo.CloseChan()
+}
+
+// requestConn is the tunnelConn of an accepted request. It reports addresses of the connection request came on.
+type requestConn struct {
+	*tunnelConn
+	local  net.Addr
+	remote net.Addr
+}
+
+func newRequestConn(fifo *stream.DoubleFifoConn, request *http.Request) *requestConn {
+	c := &requestConn{tunnelConn: newTunnelConn(fifo)}
+	c.local, _ = request.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	network := "tcp"
+	if c.local != nil {
+		network = c.local.Network()
+	}
+	c.remote = requestAddr{network: network, address: request.RemoteAddr}
+	return c
+}
+
+func (c *requestConn) LocalAddr() net.Addr {
+	if c.local == nil {
+		return c.tunnelConn.LocalAddr()
+	}
+	return c.local
+}
+
+func (c *requestConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// requestAddr is the address of the peer of a request, as http.Server tells it.
+type requestAddr struct {
+	network string
+	address string
+}
+
+func (a requestAddr) Network() string {
+	return a.network
+}
+
+func (a requestAddr) String() string {
+	return a.address
+}
@@ -0,0 +1,226 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"github.com/hadi77ir/muxedsocket/types"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrEarlyDataTooLarge = errors.New("early data is larger than allowed")
+
+// earlyDataReadWait is how long a read waits for a write to carry early data, before upgrading without it.
+const earlyDataReadWait = 200 * time.Millisecond
+
+// earlyDataConn holds the upgrade request back until the first write, so that up to earlyData bytes of it go along
+// with the request and the stream saves a round trip. Reads wait for the upgrade, and run it themselves if no write
+// comes shortly.
+type earlyDataConn struct {
+	underlying net.Conn
+	options    *webSocketOptions
+
+	mutex         sync.Mutex
+	upgrading     bool
+	conn          *webSocketConn
+	err           error
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	upgraded  chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+var _ net.Conn = &earlyDataConn{}
+
+func dialEarlyData(ctx context.Context, dialFunc types.StreamDialContextFunc, options *webSocketOptions) (*earlyDataConn, error) {
+	underlying, err := dialFunc(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &earlyDataConn{
+		underlying: underlying,
+		options:    options,
+		upgraded:   make(chan struct{}),
+		closed:     make(chan struct{}),
+	}, nil
+}
+
+// upgrade runs the upgrade once, with the head of b as early data. It returns how much of b was sent. If the upgrade
+// is already run by another call, nothing is sent and it waits for that one, as long as write deadline allows.
+func (c *earlyDataConn) upgrade(b []byte) (int, error) {
+	c.mutex.Lock()
+	if c.upgrading {
+		c.mutex.Unlock()
+		return 0, c.waitUpgrade(false)
+	}
+	c.upgrading = true
+	writeDeadline := c.writeDeadline
+	c.mutex.Unlock()
+
+	sent := len(b)
+	if sent > c.options.earlyData {
+		sent = c.options.earlyData
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if !writeDeadline.IsZero() {
+		ctx, cancel = context.WithDeadline(ctx, writeDeadline)
+		defer cancel()
+	}
+	go func() {
+		select {
+		case <-c.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	conn, err := handshakeWebSocket(ctx, c.underlying, c.options, b[:sent])
+	if err == context.DeadlineExceeded {
+		err = os.ErrDeadlineExceeded
+	}
+	if err = c.finishUpgrade(conn, err); err != nil {
+		return 0, err
+	}
+	return sent, nil
+}
+
+// finishUpgrade records the result of the upgrade and applies deadlines that were set meanwhile.
+func (c *earlyDataConn) finishUpgrade(conn *webSocketConn, err error) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err == nil {
+		select {
+		case <-c.closed:
+			_ = conn.Close()
+			err = net.ErrClosed
+		default:
+		}
+	}
+	if err != nil {
+		c.err = err
+		_ = c.underlying.Close()
+	} else {
+		c.conn = conn
+		_ = conn.SetReadDeadline(c.readDeadline)
+		_ = conn.SetWriteDeadline(c.writeDeadline)
+	}
+	close(c.upgraded)
+	return err
+}
+
+func (c *earlyDataConn) Write(b []byte) (int, error) {
+	sent, err := c.upgrade(b)
+	if err != nil {
+		return 0, err
+	}
+	if sent == len(b) {
+		return sent, nil
+	}
+	n, err := c.conn.Write(b[sent:])
+	return sent + n, err
+}
+
+func (c *earlyDataConn) Read(b []byte) (int, error) {
+	if err := c.waitUpgrade(true); err != nil {
+		return 0, err
+	}
+	return c.conn.Read(b)
+}
+
+// waitUpgrade waits for the connection to be upgraded, as long as read or write deadline allows. A read that waits
+// longer than earlyDataReadWait upgrades it without early data, as peer may be waiting to speak first.
+func (c *earlyDataConn) waitUpgrade(read bool) error {
+	select {
+	case <-c.upgraded:
+		return c.err
+	default:
+	}
+	c.mutex.Lock()
+	deadline := c.writeDeadline
+	if read {
+		deadline = c.readDeadline
+	}
+	c.mutex.Unlock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var idle <-chan time.Time
+	if read {
+		timer := time.NewTimer(earlyDataReadWait)
+		defer timer.Stop()
+		idle = timer.C
+	}
+	for {
+		select {
+		case <-c.upgraded:
+			return c.err
+		case <-c.closed:
+			return net.ErrClosed
+		case <-timeout:
+			return os.ErrDeadlineExceeded
+		case <-idle:
+			idle = nil
+			go func() {
+				_, _ = c.upgrade(nil)
+			}()
+		}
+	}
+}
+
+// Close closes the connection, without upgrading it if nothing has been written yet.
+func (c *earlyDataConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if c.conn != nil {
+			err = c.conn.Close()
+		} else {
+			err = c.underlying.Close()
+		}
+	})
+	return err
+}
+
+func (c *earlyDataConn) LocalAddr() net.Addr {
+	return c.underlying.LocalAddr()
+}
+
+func (c *earlyDataConn) RemoteAddr() net.Addr {
+	return c.underlying.RemoteAddr()
+}
+
+func (c *earlyDataConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+func (c *earlyDataConn) SetReadDeadline(t time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.readDeadline = t
+	if c.conn != nil {
+		return c.conn.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (c *earlyDataConn) SetWriteDeadline(t time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.writeDeadline = t
+	if c.conn != nil {
+		return c.conn.SetWriteDeadline(t)
+	}
+	return nil
+}
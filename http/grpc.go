@@ -0,0 +1,416 @@
+package http
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/basics/stream"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	ParamService = "service"
+	ParamRPC     = "rpc"
+
+	DefaultService = "Tunnel"
+	DefaultRPC     = "Stream"
+
+	grpcContentType = "application/grpc"
+	// grpcMessageHeaderSize is the size of compressed flag and message length, which precede every message.
+	grpcMessageHeaderSize = 5
+	// grpcMaxWriteSize is the most data a message carries, well below the 4MiB gRPC implementations accept by default.
+	grpcMaxWriteSize   = 32 * 1024
+	grpcMaxMessageSize = 4 * 1024 * 1024
+	// grpcDataTag is the tag of field 1 of protobuf messages, as bytes.
+	grpcDataTag = 0x0a
+
+	grpcStatusOK          = "0"
+	grpcStatusUnavailable = "14"
+)
+
+var (
+	ErrGRPCCompressed = errors.New("grpc: compressed messages are not supported")
+	ErrGRPCMalformed  = errors.New("grpc: malformed message")
+)
+
+// ErrGRPCStatus is returned when a call ends with a status other than OK. It holds the status and its message.
+type ErrGRPCStatus string
+
+func (e ErrGRPCStatus) Error() string {
+	return "grpc call failed with status " + string(e)
+}
+
+var grpcCommonParametersHint = []utils.ParameterHint{
+	{Key: ParamProto, Description: "h2c, or h2 over TLS below", Type: utils.ParameterTypeString, DefaultValue: ProtoH2C},
+	{Key: ParamHost, Description: "host of calls", Type: utils.ParameterTypeString},
+	{Key: ParamService, Description: "full name of the service called", Type: utils.ParameterTypeString, DefaultValue: DefaultService},
+	{Key: ParamRPC, Description: "method of the service called", Type: utils.ParameterTypeString, DefaultValue: DefaultRPC},
+	{Key: ParamUsername, Description: "username for basic authorization", Type: utils.ParameterTypeString},
+	{Key: ParamPassword, Description: "password for basic authorization", Type: utils.ParameterTypeString},
+}
+
+var grpcClientParametersHint = append([]utils.ParameterHint{
+	{Key: ParamHeaders, Description: "extra metadata of calls, as comma-separated Name:Value pairs", Type: utils.ParameterTypeMultiString},
+}, grpcCommonParametersHint...)
+
+var grpcServerParametersHint = append([]utils.ParameterHint{
+	{Key: ParamBacklog, Description: "calls waiting to be accepted", Type: utils.ParameterTypeInt, DefaultValue: "1000"},
+}, grpcCommonParametersHint...)
+
+// grpcParameters turns service and rpc into parameters of "http". gRPC calls are POST requests to /service/rpc.
+func grpcParameters(parameters utils.Parameters) (utils.Parameters, string, error) {
+	service := utils.StringFromParameters(parameters, ParamService, DefaultService)
+	rpc := utils.StringFromParameters(parameters, ParamRPC, DefaultRPC)
+	var problems []muxedsocket.ParameterProblem
+	if service == "" || strings.Contains(service, "/") {
+		problems = append(problems, muxedsocket.ParameterProblem{Key: ParamService, Reason: "must be a non-empty name without slashes"})
+	}
+	if rpc == "" || strings.Contains(rpc, "/") {
+		problems = append(problems, muxedsocket.ParameterProblem{Key: ParamRPC, Reason: "must be a non-empty name without slashes"})
+	}
+	if len(problems) > 0 {
+		return nil, "", muxedsocket.ErrInvalidParameters{Problems: problems}
+	}
+	parameters = utils.CombineParameters(utils.Parameters{ParamProto: ProtoH2C}, parameters, utils.Parameters{
+		ParamMethod: http.MethodPost,
+		ParamPath:   "/" + service + "/" + rpc,
+		ParamQuery:  "",
+	})
+	forceH2, scheme := GetProtocolFromParameters(parameters)
+	if !forceH2 {
+		return nil, "", muxedsocket.ErrInvalidParameters{Problems: []muxedsocket.ParameterProblem{{Key: ParamProto, Reason: "must be h2c or h2"}}}
+	}
+	return parameters, scheme, nil
+}
+
+// grpcRequestConstructor makes calls: requests with the headers of gRPC and extra metadata of parameters.
+func grpcRequestConstructor(parameters utils.Parameters, scheme string) (RequestConstructorFunc, error) {
+	requestConstructor, err := CreateRequestConstructor(parameters, scheme)
+	if err != nil {
+		return nil, err
+	}
+	header, problems := headersFromParameters(parameters)
+	if len(problems) > 0 {
+		return nil, muxedsocket.ErrInvalidParameters{Problems: problems}
+	}
+	header.Set("Content-Type", grpcContentType)
+	header.Set("Te", "trailers")
+	return withHeaders(requestConstructor, header), nil
+}
+
+// newGRPCConn makes a connection of the response to a call, once it looks like the answer of a gRPC server.
+func newGRPCConn(response *http.Response, bodyWriter io.WriteCloser) (*stream.DoubleFifoConn, error) {
+	// trailers-only responses carry status in headers.
+	if err := grpcStatus(response.Header); err != nil {
+		return nil, err
+	}
+	if !isGRPCContentType(response.Header.Get("Content-Type")) {
+		return nil, ErrRequestRejected("unexpected content type " + response.Header.Get("Content-Type"))
+	}
+	reader := &grpcReader{reader: response.Body, status: func() error {
+		return grpcStatus(response.Trailer)
+	}}
+	return stream.WrapFifoConn(reader, &grpcWriter{writer: bodyWriter}), nil
+}
+
+// wrapGRPCServerConn makes a connection of a call. Like other tunnels of streamResponse, it gets addresses of the
+// request and deadlines there.
+func wrapGRPCServerConn(reader io.ReadCloser, writer io.WriteCloser) *stream.DoubleFifoConn {
+	return stream.WrapFifoConn(&grpcReader{reader: reader}, &grpcWriter{writer: writer})
+}
+
+// grpcStatus returns the status in header, if it is there and is not OK.
+func grpcStatus(header http.Header) error {
+	status := header.Get("Grpc-Status")
+	if status == "" || status == grpcStatusOK {
+		return nil
+	}
+	if message := header.Get("Grpc-Message"); message != "" {
+		return ErrGRPCStatus(status + ": " + message)
+	}
+	return ErrGRPCStatus(status)
+}
+
+func isGRPCContentType(contentType string) bool {
+	return contentType == grpcContentType || strings.HasPrefix(contentType, grpcContentType+"+") ||
+		strings.HasPrefix(contentType, grpcContentType+";")
+}
+
+// grpcAdapter accepts calls as tunnels, ending them with OK status once they are closed. Calls that are never
+// accepted end with UNAVAILABLE, so that clients don't take them for finished ones.
+func grpcAdapter(writer http.ResponseWriter, request *http.Request, backlogChan chan<- net.Conn, closed <-chan struct{}) {
+	if request.ProtoMajor != 2 {
+		http.Error(writer, http.StatusText(http.StatusHTTPVersionNotSupported), http.StatusHTTPVersionNotSupported)
+		return
+	}
+	if !isGRPCContentType(request.Header.Get("Content-Type")) {
+		http.Error(writer, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+	writer.Header().Set("Content-Type", grpcContentType)
+	if !streamResponse(writer, request, backlogChan, closed, wrapGRPCServerConn) {
+		writer.Header().Set(http.TrailerPrefix+"Grpc-Status", grpcStatusUnavailable)
+		writer.Header().Set(http.TrailerPrefix+"Grpc-Message", "call not accepted")
+		return
+	}
+	writer.Header().Set(http.TrailerPrefix+"Grpc-Status", grpcStatusOK)
+}
+
+// grpcReader reads data out of messages. Each message is a protobuf message with the data in field 1, so that it is
+// valid for anything in between that decodes messages.
+type grpcReader struct {
+	reader io.ReadCloser
+	// status returns the error of call once its messages end, if any.
+	status func() error
+	// remaining is data left in current message.
+	remaining int
+}
+
+func (r *grpcReader) Read(b []byte) (int, error) {
+	for r.remaining == 0 {
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	if len(b) > r.remaining {
+		b = b[:r.remaining]
+	}
+	n, err := r.reader.Read(b)
+	r.remaining -= n
+	if err == io.EOF {
+		if r.remaining > 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+		if n > 0 {
+			err = nil
+		}
+	}
+	return n, err
+}
+
+// next reads header of the next message.
+func (r *grpcReader) next() error {
+	var header [grpcMessageHeaderSize]byte
+	if _, err := io.ReadFull(r.reader, header[:]); err != nil {
+		if err == io.EOF && r.status != nil {
+			if statusErr := r.status(); statusErr != nil {
+				return statusErr
+			}
+		}
+		return err
+	}
+	if header[0] != 0 {
+		return ErrGRPCCompressed
+	}
+	size := int(binary.BigEndian.Uint32(header[1:]))
+	if size > grpcMaxMessageSize {
+		return ErrGRPCMalformed
+	}
+	if size == 0 {
+		// a message with nothing set.
+		return nil
+	}
+	var field [1 + binary.MaxVarintLen32]byte
+	read := 0
+	for {
+		if read == len(field) || read == size {
+			return ErrGRPCMalformed
+		}
+		if _, err := io.ReadFull(r.reader, field[read:read+1]); err != nil {
+			return unexpectedEOF(err)
+		}
+		read++
+		if read > 1 && field[read-1] < 0x80 {
+			break
+		}
+	}
+	length, n := binary.Uvarint(field[1:read])
+	if field[0] != grpcDataTag || n <= 0 || uint64(size-read) != length {
+		return ErrGRPCMalformed
+	}
+	r.remaining = int(length)
+	return nil
+}
+
+func (r *grpcReader) Close() error {
+	return r.reader.Close()
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// grpcWriter writes data in messages, as grpcReader reads them.
+type grpcWriter struct {
+	writer io.WriteCloser
+}
+
+func (w *grpcWriter) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		size := len(b) - written
+		if size > grpcMaxWriteSize {
+			size = grpcMaxWriteSize
+		}
+		message := make([]byte, grpcMessageHeaderSize+1+binary.MaxVarintLen32+size)
+		n := grpcMessageHeaderSize
+		message[n] = grpcDataTag
+		n++
+		n += binary.PutUvarint(message[n:], uint64(size))
+		n += copy(message[n:], b[written:written+size])
+		binary.BigEndian.PutUint32(message[1:], uint32(n-grpcMessageHeaderSize))
+		if _, err := w.writer.Write(message[:n]); err != nil {
+			return written, err
+		}
+		written += size
+	}
+	return written, nil
+}
+
+func (w *grpcWriter) Close() error {
+	return w.writer.Close()
+}
+
+// GRPCImplementation tunnels each stream through a gRPC call with streams both ways, over HTTP/2 connections of its
+// own, as in "smux+grpc+tls+tcp". gRPC proxies forward the calls like any other.
+type GRPCImplementation struct {
+	// nothing.
+}
+
+var _ types.StreamObfuscatorImplementation = &GRPCImplementation{}
+var _ types.StreamObfuscatorContextImplementation = &GRPCImplementation{}
+var _ types.HasParametersHint = &GRPCImplementation{}
+
+func (i *GRPCImplementation) Server(conn types.StreamListenFunc, parameters utils.Parameters) (types.StreamListenFunc, error) {
+	listenFunc, err := i.ServerContext(conn.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return listenFunc.WithoutContext(), nil
+}
+
+func (i *GRPCImplementation) Client(conn types.StreamDialFunc, parameters utils.Parameters) (types.StreamDialFunc, error) {
+	dialFunc, err := i.ClientContext(conn.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return dialFunc.WithoutContext(), nil
+}
+
+func (i *GRPCImplementation) ServerContext(conn types.StreamListenContextFunc, parameters utils.Parameters) (types.StreamListenContextFunc, error) {
+	parameters, scheme, err := grpcParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+	// fail early on bad parameters, instead of when listening.
+	if _, _, err := newRequestHandler(parameters, scheme, http.MethodPost, grpcAdapter, nil); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) (types.StreamListener, error) {
+		listener, err := conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		grpcListener, err := serveListener(listener, parameters, scheme, http.MethodPost, grpcAdapter)
+		if err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+		return grpcListener, nil
+	}, nil
+}
+
+func (i *GRPCImplementation) ClientContext(conn types.StreamDialContextFunc, parameters utils.Parameters) (types.StreamDialContextFunc, error) {
+	parameters, scheme, err := grpcParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+	requestConstructor, err := grpcRequestConstructor(parameters, scheme)
+	if err != nil {
+		return nil, err
+	}
+	dialer := wrapH2Client(func(ctx context.Context) (net.Conn, error) {
+		return conn(ctx)
+	}, newH2Transport(parameters), requestConstructor, newGRPCConn)
+	// redialing happens later, outside the lifetime of dial context.
+	redialer := func() (net.Conn, error) {
+		return dialer(context.Background())
+	}
+	return func(ctx context.Context) (types.StreamConn, error) {
+		conn, err := dialer(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return stream.WrapConn(conn, redialer, nil), nil
+	}, nil
+}
+
+func (i *GRPCImplementation) ClientParametersHint() []utils.ParameterHint {
+	return grpcClientParametersHint
+}
+
+func (i *GRPCImplementation) ServerParametersHint() []utils.ParameterHint {
+	return grpcServerParametersHint
+}
+
+// GRPCMuxImplementation is like "h2mux", with each stream being a gRPC call, as in "grpcmux+tls+tcp".
+type GRPCMuxImplementation struct {
+	// nothing.
+}
+
+var _ types.StreamSolutionImplementation = &GRPCMuxImplementation{}
+var _ types.StreamSolutionContextImplementation = &GRPCMuxImplementation{}
+var _ types.HasParametersHint = &GRPCMuxImplementation{}
+
+func (i *GRPCMuxImplementation) Server(conn types.StreamListenFunc, parameters utils.Parameters) (types.MuxListenFunc, error) {
+	listenFunc, err := i.ServerContext(conn.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return listenFunc.WithoutContext(), nil
+}
+
+func (i *GRPCMuxImplementation) Client(conn types.StreamDialFunc, parameters utils.Parameters) (types.MuxDialFunc, error) {
+	dialFunc, err := i.ClientContext(conn.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return dialFunc.WithoutContext(), nil
+}
+
+func (i *GRPCMuxImplementation) ServerContext(conn types.StreamListenContextFunc, parameters utils.Parameters) (types.MuxListenContextFunc, error) {
+	parameters, scheme, err := grpcParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+	return listenH2Mux(conn, parameters, scheme, http.MethodPost, grpcAdapter)
+}
+
+func (i *GRPCMuxImplementation) ClientContext(conn types.StreamDialContextFunc, parameters utils.Parameters) (types.MuxDialContextFunc, error) {
+	parameters, scheme, err := grpcParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+	requestConstructor, err := grpcRequestConstructor(parameters, scheme)
+	if err != nil {
+		return nil, err
+	}
+	return dialH2Mux(conn, parameters, requestConstructor, newGRPCConn), nil
+}
+
+func (i *GRPCMuxImplementation) ClientParametersHint() []utils.ParameterHint {
+	return grpcClientParametersHint
+}
+
+func (i *GRPCMuxImplementation) ServerParametersHint() []utils.ParameterHint {
+	return grpcServerParametersHint
+}
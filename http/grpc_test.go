@@ -0,0 +1,102 @@
+package http
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"testing"
+)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (w nopWriteCloser) Close() error {
+	return nil
+}
+
+// grpcMessage frames payload the way grpcWriter does, with size overriding the length in message header if not -1.
+func grpcMessage(payload []byte, size int) []byte {
+	message := make([]byte, grpcMessageHeaderSize, grpcMessageHeaderSize+1+binary.MaxVarintLen32+len(payload))
+	message = append(message, grpcDataTag)
+	message = binary.AppendUvarint(message, uint64(len(payload)))
+	message = append(message, payload...)
+	if size == -1 {
+		size = len(message) - grpcMessageHeaderSize
+	}
+	binary.BigEndian.PutUint32(message[1:], uint32(size))
+	return message
+}
+
+func TestGRPCRoundTrip(t *testing.T) {
+	for _, size := range []int{1, 127, 128, 16383, 16384, grpcMaxWriteSize, grpcMaxWriteSize + 1, 3 * grpcMaxWriteSize} {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		var buffer bytes.Buffer
+		writer := &grpcWriter{writer: nopWriteCloser{&buffer}}
+		if n, err := writer.Write(data); err != nil || n != size {
+			t.Fatal(size, n, err)
+		}
+		reader := &grpcReader{reader: io.NopCloser(&buffer)}
+		got, err := io.ReadAll(reader)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("size %d: read %d bytes, %v", size, len(got), err)
+		}
+	}
+}
+
+func TestGRPCReaderMessages(t *testing.T) {
+	empty := make([]byte, grpcMessageHeaderSize)
+	compressed := grpcMessage([]byte("data"), -1)
+	compressed[0] = 1
+	wrongTag := grpcMessage([]byte("data"), -1)
+	wrongTag[grpcMessageHeaderSize] = 0x12
+	tooLarge := make([]byte, grpcMessageHeaderSize)
+	binary.BigEndian.PutUint32(tooLarge[1:], grpcMaxMessageSize+1)
+	// a length that doesn't end within the longest varint a message needs.
+	longVarint := append([]byte{0, 0, 0, 0, 20, grpcDataTag}, bytes.Repeat([]byte{0x80}, 19)...)
+	tagOnly := []byte{0, 0, 0, 0, 1, grpcDataTag}
+
+	cases := []struct {
+		name  string
+		input []byte
+		data  string
+		err   error
+	}{
+		{"empty messages are skipped", append(append(empty, grpcMessage([]byte("data"), -1)...), empty...), "data", nil},
+		{"two-byte length", grpcMessage(bytes.Repeat([]byte("x"), 200), -1), string(bytes.Repeat([]byte("x"), 200)), nil},
+		{"compressed", compressed, "", ErrGRPCCompressed},
+		{"wrong tag", wrongTag, "", ErrGRPCMalformed},
+		{"too large", tooLarge, "", ErrGRPCMalformed},
+		{"length beyond message", grpcMessage([]byte("data"), 3), "", ErrGRPCMalformed},
+		{"length short of message", grpcMessage([]byte("data"), 8), "", ErrGRPCMalformed},
+		{"long varint", longVarint, "", ErrGRPCMalformed},
+		{"tag only", tagOnly, "", ErrGRPCMalformed},
+		{"truncated header", []byte{0, 0, 0}, "", io.ErrUnexpectedEOF},
+		{"truncated length", []byte{0, 0, 0, 0, 3, grpcDataTag, 0x80}, "", io.ErrUnexpectedEOF},
+		{"truncated data", grpcMessage([]byte("data"), -1)[:grpcMessageHeaderSize+4], "da", io.ErrUnexpectedEOF},
+	}
+	for _, c := range cases {
+		reader := &grpcReader{reader: io.NopCloser(bytes.NewReader(c.input))}
+		got, err := io.ReadAll(reader)
+		if string(got) != c.data || err != c.err {
+			t.Errorf("%s: got %q, %v; want %q, %v", c.name, got, err, c.data, c.err)
+		}
+	}
+}
+
+func TestGRPCReaderStatus(t *testing.T) {
+	trailer := http.Header{}
+	reader := &grpcReader{reader: io.NopCloser(bytes.NewReader(grpcMessage([]byte("data"), -1))), status: func() error {
+		return grpcStatus(trailer)
+	}}
+	trailer.Set("Grpc-Status", grpcStatusUnavailable)
+	trailer.Set("Grpc-Message", "call not accepted")
+	got, err := io.ReadAll(reader)
+	if string(got) != "data" || err != ErrGRPCStatus("14: call not accepted") {
+		t.Fatal(string(got), err)
+	}
+}
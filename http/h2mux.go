@@ -0,0 +1,504 @@
+package http
+
+import (
+	"context"
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/basics/stream"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"golang.org/x/net/http2"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	ProtoH2  = "h2"
+	ProtoH2C = "h2c"
+)
+
+// h2muxDefaults differ from those of "http": a single HTTP/2 connection, and requests that look like uploads.
+var h2muxDefaults = utils.Parameters{
+	ParamProto:  ProtoH2C,
+	ParamMethod: http.MethodPost,
+}
+
+var h2muxCommonParametersHint = []utils.ParameterHint{
+	{Key: ParamProto, Description: "h2c, or h2 over TLS below", Type: utils.ParameterTypeString, DefaultValue: ProtoH2C},
+	{Key: ParamHost, Description: "host of requests", Type: utils.ParameterTypeString},
+	{Key: ParamPath, Description: "path of requests", Type: utils.ParameterTypeString, DefaultValue: "/"},
+	{Key: ParamQuery, Description: "query of requests; server requires the same values", Type: utils.ParameterTypeString},
+	{Key: ParamMethod, Description: "method of requests", Type: utils.ParameterTypeString, DefaultValue: "POST"},
+	{Key: ParamUsername, Description: "username for basic authorization", Type: utils.ParameterTypeString},
+	{Key: ParamPassword, Description: "password for basic authorization", Type: utils.ParameterTypeString},
+}
+
+var h2muxClientParametersHint = append([]utils.ParameterHint{
+	{Key: ParamHeaders, Description: "extra headers of requests, as comma-separated Name:Value pairs", Type: utils.ParameterTypeMultiString},
+	{Key: ParamCompression, Description: "ask for compressed responses", Type: utils.ParameterTypeBool, DefaultValue: "true"},
+}, h2muxCommonParametersHint...)
+
+var h2muxServerParametersHint = append([]utils.ParameterHint{
+	{Key: ParamBacklog, Description: "streams of a connection waiting to be accepted", Type: utils.ParameterTypeInt, DefaultValue: "1000"},
+}, h2muxCommonParametersHint...)
+
+// H2MuxImplementation multiplexes streams over a single HTTP/2 connection, one request per stream, as in
+// "h2mux+tcp". Clients open streams and servers accept them; HTTP/2 has no way for servers to open requests.
+type H2MuxImplementation struct {
+	// nothing.
+}
+
+var _ types.StreamSolutionImplementation = &H2MuxImplementation{}
+var _ types.StreamSolutionContextImplementation = &H2MuxImplementation{}
+var _ types.HasParametersHint = &H2MuxImplementation{}
+
+// h2muxParameters fills in defaults of h2mux, and checks that an HTTP/2 protocol is asked for.
+func h2muxParameters(parameters utils.Parameters) (utils.Parameters, string, error) {
+	parameters = utils.CombineParameters(h2muxDefaults, parameters)
+	forceH2, scheme := GetProtocolFromParameters(parameters)
+	if !forceH2 {
+		return nil, "", muxedsocket.ErrInvalidParameters{Problems: []muxedsocket.ParameterProblem{{Key: ParamProto, Reason: "must be h2c or h2"}}}
+	}
+	return parameters, scheme, nil
+}
+
+func (i *H2MuxImplementation) Server(conn types.StreamListenFunc, parameters utils.Parameters) (types.MuxListenFunc, error) {
+	listenFunc, err := i.ServerContext(conn.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return listenFunc.WithoutContext(), nil
+}
+
+func (i *H2MuxImplementation) Client(conn types.StreamDialFunc, parameters utils.Parameters) (types.MuxDialFunc, error) {
+	dialFunc, err := i.ClientContext(conn.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return dialFunc.WithoutContext(), nil
+}
+
+func (i *H2MuxImplementation) ServerContext(conn types.StreamListenContextFunc, parameters utils.Parameters) (types.MuxListenContextFunc, error) {
+	parameters, scheme, err := h2muxParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+	return listenH2Mux(conn, parameters, scheme, methodFromParameters(parameters), tunnelAdapter)
+}
+
+// listenH2Mux accepts requests of HTTP/2 connections as streams, as adapter makes them.
+func listenH2Mux(conn types.StreamListenContextFunc, parameters utils.Parameters, scheme string, method string, adapter requestAdapterFunc) (types.MuxListenContextFunc, error) {
+	// fail early on bad parameters, instead of when accepting.
+	if _, _, err := newRequestHandler(parameters, scheme, method, adapter, nil); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) (types.MuxedListener, error) {
+		listener, err := conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &h2muxListener{
+			listener:   listener,
+			server:     &http2.Server{},
+			parameters: parameters,
+			scheme:     scheme,
+			method:     method,
+			adapter:    adapter,
+		}, nil
+	}, nil
+}
+
+func (i *H2MuxImplementation) ClientContext(conn types.StreamDialContextFunc, parameters utils.Parameters) (types.MuxDialContextFunc, error) {
+	parameters, scheme, err := h2muxParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+	requestConstructor, err := CreateRequestConstructor(parameters, scheme)
+	if err != nil {
+		return nil, err
+	}
+	header, problems := headersFromParameters(parameters)
+	if len(problems) > 0 {
+		return nil, muxedsocket.ErrInvalidParameters{Problems: problems}
+	}
+	return dialH2Mux(conn, parameters, withHeaders(requestConstructor, header), newFifoConn), nil
+}
+
+// dialH2Mux opens streams as requests on an HTTP/2 connection, which newConn makes connections of.
+func dialH2Mux(conn types.StreamDialContextFunc, parameters utils.Parameters, requestConstructor RequestConstructorFunc, newConn responseConnFunc) types.MuxDialContextFunc {
+	transport := newH2Transport(parameters)
+	transport.ReadIdleTimeout, transport.PingTimeout = muxedsocket.KeepAliveFromParameters(parameters)
+	var dialFunc types.MuxDialContextFunc
+	dialFunc = func(ctx context.Context) (types.MuxedSocket, error) {
+		underlying, err := conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		clientConn, err := transport.NewClientConn(underlying)
+		if err != nil {
+			_ = underlying.Close()
+			return nil, err
+		}
+		return newH2MuxClientConn(underlying, clientConn, requestConstructor, newConn, dialFunc), nil
+	}
+	return dialFunc
+}
+
+func (i *H2MuxImplementation) ClientParametersHint() []utils.ParameterHint {
+	return h2muxClientParametersHint
+}
+
+func (i *H2MuxImplementation) ServerParametersHint() []utils.ParameterHint {
+	return h2muxServerParametersHint
+}
+
+// h2muxClientConn opens a request on its HTTP/2 connection for each stream.
+type h2muxClientConn struct {
+	underlying         types.StreamConn
+	clientConn         *http2.ClientConn
+	requestConstructor RequestConstructorFunc
+	newConn            responseConnFunc
+	dialFunc           types.MuxDialContextFunc
+
+	// openMutex keeps requests in the order their IDs are given out in.
+	openMutex sync.Mutex
+	nextID    int
+
+	// ctx is cancelled once connection is closed, ending requests of its streams.
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+var _ types.MuxedSocket = &h2muxClientConn{}
+
+func newH2MuxClientConn(underlying types.StreamConn, clientConn *http2.ClientConn, requestConstructor RequestConstructorFunc, newConn responseConnFunc, dialFunc types.MuxDialContextFunc) *h2muxClientConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &h2muxClientConn{
+		underlying:         underlying,
+		clientConn:         clientConn,
+		requestConstructor: requestConstructor,
+		newConn:            newConn,
+		dialFunc:           dialFunc,
+		nextID:             1,
+		ctx:                ctx,
+		cancel:             cancel,
+		closed:             make(chan struct{}),
+	}
+	go func() {
+		// transport closes the connection once it fails.
+		<-underlying.CloseChan()
+		_ = c.Close()
+	}()
+	return c
+}
+
+type roundTripResult struct {
+	response *http.Response
+	err      error
+}
+
+// OpenStream sends a new request, and returns once server answers it. Request headers go out one request at a time,
+// so that the stream ID HTTP/2 gives each request is known.
+func (c *h2muxClientConn) OpenStream() (types.MuxStream, error) {
+	select {
+	case <-c.closed:
+		return nil, net.ErrClosed
+	default:
+	}
+	bodyReader, bodyWriter := net.Pipe()
+	body := &startSignallingReader{ReadCloser: bodyReader, started: make(chan struct{})}
+	request, err := c.requestConstructor(body)
+	if err != nil {
+		_ = bodyWriter.Close()
+		return nil, err
+	}
+	requestCtx, cancelRequest := context.WithCancel(c.ctx)
+	request = request.WithContext(requestCtx)
+
+	results := make(chan roundTripResult, 1)
+	c.openMutex.Lock()
+	go func() {
+		response, err := c.clientConn.RoundTrip(request)
+		results <- roundTripResult{response: response, err: err}
+	}()
+	var result roundTripResult
+	answered := false
+	select {
+	case <-body.started:
+	case result = <-results:
+		answered = true
+	}
+	id := c.nextID
+	if !answered || result.err == nil {
+		// request went out, taking the ID.
+		c.nextID += 2
+	}
+	c.openMutex.Unlock()
+	if !answered {
+		result = <-results
+	}
+
+	err = result.err
+	if err == nil && result.response.StatusCode != http.StatusOK {
+		_ = result.response.Body.Close()
+		err = ErrRequestRejected(result.response.Status)
+	}
+	var conn *stream.DoubleFifoConn
+	if err == nil {
+		conn, err = c.newConn(result.response, bodyWriter)
+		if err != nil {
+			_ = result.response.Body.Close()
+		}
+	}
+	if err != nil {
+		cancelRequest()
+		_ = bodyWriter.Close()
+		return nil, err
+	}
+	go func() {
+		select {
+		case <-conn.CloseChan():
+			cancelRequest()
+		case <-requestCtx.Done():
+			_ = conn.Close()
+		}
+	}()
+	return newH2MuxStream(newTunnelConn(conn), id, c.LocalAddr(), c.RemoteAddr()), nil
+}
+
+// AcceptStream is not supported, as servers can't open requests.
+func (c *h2muxClientConn) AcceptStream() (types.MuxStream, error) {
+	return nil, muxedsocket.ErrOpNotSupported
+}
+
+func (c *h2muxClientConn) CloseChan() <-chan struct{} {
+	return c.closed
+}
+
+func (c *h2muxClientConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.cancel()
+		err = c.clientConn.Close()
+	})
+	return err
+}
+
+func (c *h2muxClientConn) LocalAddr() net.Addr {
+	return c.underlying.LocalAddr()
+}
+
+func (c *h2muxClientConn) RemoteAddr() net.Addr {
+	return c.underlying.RemoteAddr()
+}
+
+func (c *h2muxClientConn) CanRedial() bool {
+	return true
+}
+
+// Redial dials a new HTTP/2 connection.
+func (c *h2muxClientConn) Redial() (types.Socket, error) {
+	return c.dialFunc(context.Background())
+}
+
+// startSignallingReader closes started on first Read. Transport reads request body once request headers are out.
+type startSignallingReader struct {
+	io.ReadCloser
+	started   chan struct{}
+	startOnce sync.Once
+}
+
+func (r *startSignallingReader) Read(b []byte) (int, error) {
+	r.startOnce.Do(func() {
+		close(r.started)
+	})
+	return r.ReadCloser.Read(b)
+}
+
+type h2muxListener struct {
+	listener   types.StreamListener
+	server     *http2.Server
+	parameters utils.Parameters
+	scheme     string
+	method     string
+	adapter    requestAdapterFunc
+}
+
+var _ types.MuxedListener = &h2muxListener{}
+
+func (l *h2muxListener) Accept() (types.Socket, error) {
+	return l.AcceptMuxed()
+}
+
+func (l *h2muxListener) AcceptMuxed() (types.MuxedSocket, error) {
+	conn, err := l.listener.AcceptConn()
+	if err != nil {
+		return nil, err
+	}
+	c := &h2muxServerConn{conn: conn, nextID: 1, closed: make(chan struct{})}
+	handler, backlog, err := newRequestHandler(l.parameters, l.scheme, l.method, l.adapter, c.closed)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	c.backlog = backlog
+	go func() {
+		l.server.ServeConn(conn, &http2.ServeConnOpts{Handler: handler})
+		_ = c.Close()
+	}()
+	return c, nil
+}
+
+func (l *h2muxListener) CloseChan() <-chan struct{} {
+	return l.listener.CloseChan()
+}
+
+// Close stops accepting connections. Connections that were already accepted are left open.
+func (l *h2muxListener) Close() error {
+	return l.listener.Close()
+}
+
+func (l *h2muxListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// h2muxServerConn accepts the requests of an HTTP/2 connection as streams. HTTP/2 doesn't tell handlers the ID of
+// their stream, so accepted streams are numbered the way HTTP/2 numbers them, in the order they are accepted.
+type h2muxServerConn struct {
+	conn    types.StreamConn
+	backlog <-chan net.Conn
+
+	mutex  sync.Mutex
+	nextID int
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+var _ types.MuxedSocket = &h2muxServerConn{}
+
+func (c *h2muxServerConn) AcceptStream() (types.MuxStream, error) {
+	select {
+	case conn := <-c.backlog:
+		c.mutex.Lock()
+		id := c.nextID
+		c.nextID += 2
+		c.mutex.Unlock()
+		return newH2MuxStream(conn, id, c.LocalAddr(), c.RemoteAddr()), nil
+	case <-c.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// OpenStream is not supported, as servers can't open requests.
+func (c *h2muxServerConn) OpenStream() (types.MuxStream, error) {
+	return nil, muxedsocket.ErrOpNotSupported
+}
+
+func (c *h2muxServerConn) CloseChan() <-chan struct{} {
+	return c.closed
+}
+
+func (c *h2muxServerConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		err = c.conn.Close()
+	})
+	return err
+}
+
+func (c *h2muxServerConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *h2muxServerConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *h2muxServerConn) CanRedial() bool {
+	return false
+}
+
+func (c *h2muxServerConn) Redial() (types.Socket, error) {
+	return nil, muxedsocket.ErrRedialNotSupported
+}
+
+// closableConn is the connection of a request, on either side.
+type closableConn interface {
+	net.Conn
+	CloseChan() <-chan struct{}
+}
+
+// h2muxStream is a request as a stream.
+type h2muxStream struct {
+	conn       closableConn
+	id         int
+	localAddr  net.Addr
+	remoteAddr net.Addr
+}
+
+var _ types.MuxStream = &h2muxStream{}
+
+func newH2MuxStream(conn net.Conn, id int, localAddr net.Addr, remoteAddr net.Addr) *h2muxStream {
+	return &h2muxStream{
+		conn:       conn.(closableConn),
+		id:         id,
+		localAddr:  types.WrapAddr(localAddr, id),
+		remoteAddr: types.WrapAddr(remoteAddr, id),
+	}
+}
+
+func (s *h2muxStream) CloseChan() <-chan struct{} {
+	return s.conn.CloseChan()
+}
+
+func (s *h2muxStream) Read(b []byte) (int, error) {
+	return s.conn.Read(b)
+}
+
+func (s *h2muxStream) Write(b []byte) (int, error) {
+	return s.conn.Write(b)
+}
+
+func (s *h2muxStream) Close() error {
+	return s.conn.Close()
+}
+
+func (s *h2muxStream) LocalAddr() net.Addr {
+	return s.localAddr
+}
+
+func (s *h2muxStream) RemoteAddr() net.Addr {
+	return s.remoteAddr
+}
+
+func (s *h2muxStream) SetDeadline(t time.Time) error {
+	return s.conn.SetDeadline(t)
+}
+
+func (s *h2muxStream) SetReadDeadline(t time.Time) error {
+	return s.conn.SetReadDeadline(t)
+}
+
+func (s *h2muxStream) SetWriteDeadline(t time.Time) error {
+	return s.conn.SetWriteDeadline(t)
+}
+
+// StreamID returns the HTTP/2 stream ID of the request.
+func (s *h2muxStream) StreamID() int {
+	return s.id
+}
+
+func (s *h2muxStream) CanRedial() bool {
+	return false
+}
+
+func (s *h2muxStream) Redial() (types.Socket, error) {
+	return nil, muxedsocket.ErrRedialNotSupported
+}
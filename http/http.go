@@ -0,0 +1,92 @@
+package http
+
+import (
+	"context"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+)
+
+const (
+	ParamProto       = "proto"
+	ParamHost        = "host"
+	ParamPath        = "path"
+	ParamQuery       = "query"
+	ParamMethod      = "method"
+	ParamUsername    = "username"
+	ParamPassword    = "password"
+	ParamCompression = "compression"
+	ParamBacklog     = "backlog"
+
+	DefaultBacklog = 1000
+)
+
+var commonParametersHint = []utils.ParameterHint{
+	{Key: ParamProto, Description: "http (HTTP/1.1), https (HTTP/1.1 over TLS below), h2c or h2", Type: utils.ParameterTypeString, DefaultValue: ProtoHTTP},
+	{Key: ParamHost, Description: "host of requests", Type: utils.ParameterTypeString},
+	{Key: ParamPath, Description: "path of requests", Type: utils.ParameterTypeString, DefaultValue: "/"},
+	{Key: ParamQuery, Description: "query of requests; server requires the same values", Type: utils.ParameterTypeString},
+	{Key: ParamMethod, Description: "method of requests, such as GET, POST or CONNECT", Type: utils.ParameterTypeString, DefaultValue: "GET"},
+	{Key: ParamUsername, Description: "username for basic authorization", Type: utils.ParameterTypeString},
+	{Key: ParamPassword, Description: "password for basic authorization", Type: utils.ParameterTypeString},
+}
+
+var clientParametersHint = append([]utils.ParameterHint{
+	{Key: ParamCompression, Description: "ask for compressed responses (h2, h2c)", Type: utils.ParameterTypeBool, DefaultValue: "true"},
+}, commonParametersHint...)
+
+var serverParametersHint = append([]utils.ParameterHint{
+	{Key: ParamBacklog, Description: "tunnels waiting to be accepted", Type: utils.ParameterTypeInt, DefaultValue: "1000"},
+}, commonParametersHint...)
+
+// Implementation tunnels streams through HTTP requests. Over HTTP/1.1, the connection carries the tunnel once the
+// request is answered; over HTTP/2, the bodies of request and response do.
+type Implementation struct {
+	// nothing.
+}
+
+var _ types.StreamObfuscatorImplementation = &Implementation{}
+var _ types.StreamObfuscatorContextImplementation = &Implementation{}
+var _ types.HasParametersHint = &Implementation{}
+
+func (i *Implementation) Server(conn types.StreamListenFunc, parameters utils.Parameters) (types.StreamListenFunc, error) {
+	listenFunc, err := i.ServerContext(conn.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return listenFunc.WithoutContext(), nil
+}
+
+func (i *Implementation) Client(conn types.StreamDialFunc, parameters utils.Parameters) (types.StreamDialFunc, error) {
+	return WrapHttpClient(conn, parameters)
+}
+
+func (i *Implementation) ServerContext(conn types.StreamListenContextFunc, parameters utils.Parameters) (types.StreamListenContextFunc, error) {
+	// fail early on bad parameters, instead of when listening.
+	if _, _, err := newRequestHandler(parameters, ProtoHTTP, methodFromParameters(parameters), tunnelAdapter, nil); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) (types.StreamListener, error) {
+		listener, err := conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		httpListener, err := wrapHttpServer(listener, parameters)
+		if err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+		return httpListener, nil
+	}, nil
+}
+
+func (i *Implementation) ClientContext(conn types.StreamDialContextFunc, parameters utils.Parameters) (types.StreamDialContextFunc, error) {
+	return WrapHttpClientContext(conn, parameters)
+}
+
+func (i *Implementation) ClientParametersHint() []utils.ParameterHint {
+	return clientParametersHint
+}
+
+func (i *Implementation) ServerParametersHint() []utils.ParameterHint {
+	return serverParametersHint
+}
@@ -0,0 +1,14 @@
+package http
+
+import "github.com/hadi77ir/muxedsocket"
+
+func init() {
+	muxedsocket.GlobalCreators().StreamObfuscators().Register("http", &Implementation{})
+	muxedsocket.GlobalCreators().StreamObfuscators().Register("ws", &WebSocketImplementation{})
+	muxedsocket.GlobalCreators().PacketAdapters().Register("wsp", &WebSocketPacketImplementation{})
+	muxedsocket.GlobalCreators().StreamSolutions().Register("h2mux", &H2MuxImplementation{})
+	muxedsocket.GlobalCreators().StreamObfuscators().Register("grpc", &GRPCImplementation{})
+	muxedsocket.GlobalCreators().StreamSolutions().Register("grpcmux", &GRPCMuxImplementation{})
+	// "wss" needs tls to be registered as well.
+	muxedsocket.GlobalCreators().Aliases().Register("wss", muxedsocket.Alias{Scheme: "ws+tls"})
+}
@@ -1,6 +1,8 @@
 package http
 
 import (
+	"bufio"
+	"crypto/subtle"
 	"errors"
 	"github.com/hadi77ir/muxedsocket"
 	"github.com/hadi77ir/muxedsocket/basics/stream"
@@ -12,38 +14,48 @@ import (
 	"net"
 	"net/http"
 	"net/url"
-	"strings"
+	"sync"
 )
 
-func wrapHttpServer(listener net.Listener, parameters utils.Parameters) (types.StreamListener, error) {
+func wrapHttpServer(listener types.StreamListener, parameters utils.Parameters) (types.StreamListener, error) {
 	_, scheme := GetProtocolFromParameters(parameters)
 	// cleartext
-	if scheme == "http" {
+	if scheme == ProtoHTTP {
 		return wrapListenerH2C(listener, parameters)
 	}
-	if scheme == "https" {
+	if scheme == ProtoHTTPS {
 		return wrapListenerH2S(listener, parameters)
 	}
 	return nil, muxedsocket.ErrSchemeNotSupported
 }
 
-func wrapListenerH2C(listener net.Listener, parameters utils.Parameters) (types.StreamListener, error) {
-	handler, backlogChannel, err := newRequestHandler(parameters, ProtoHTTP, plainAdapter)
+func wrapListenerH2C(listener types.StreamListener, parameters utils.Parameters) (types.StreamListener, error) {
+	return serveListener(listener, parameters, ProtoHTTP, methodFromParameters(parameters), tunnelAdapter)
+}
+
+// wrapListenerH2S serves HTTP over a listener that is already secured by a layer below, so there is no ALPN to tell
+// HTTP/2 apart from HTTP/1.1. Like h2c, HTTP/2 is detected from its connection preface.
+func wrapListenerH2S(listener types.StreamListener, parameters utils.Parameters) (types.StreamListener, error) {
+	return serveListener(listener, parameters, ProtoHTTPS, methodFromParameters(parameters), tunnelAdapter)
+}
+
+func serveListener(listener types.StreamListener, parameters utils.Parameters, scheme string, method string, adapter requestAdapterFunc) (*httpListener, error) {
+	closed := make(chan struct{})
+	handler, backlogChannel, err := newRequestHandler(parameters, scheme, method, adapter, closed)
 	if err != nil {
 		return nil, err
 	}
 	server := &http.Server{
-		Handler: h2c.NewHandler(handler, &http2.Server{}),
+		Handler: hijackedPassthrough(h2c.NewHandler(handler, &http2.Server{})),
 	}
-	return &httpListener{
+	h := &httpListener{
+		listener:       listener,
 		server:         server,
 		backlogChannel: backlogChannel,
-		closed:         make(chan struct{}, 1),
-	}, nil
-}
-
-func wrapListenerH2S(listener net.Listener, parameters utils.Parameters) (types.StreamListener, error) {
-
+		closed:         closed,
+	}
+	go h.serve()
+	return h, nil
 }
 
 type requestMatcherFunc func(request *http.Request) bool
@@ -89,46 +101,132 @@ func matchGetParameters(haystack url.Values, needles url.Values) bool {
 	}
 	return true
 }
-func plainAdapter(writer http.ResponseWriter, request *http.Request, backlogChan chan net.Conn) {
-	var wrappedWriter io.WriteCloser = WriterToWriteCloserAdapter(writer.Write)
-	if flusher, ok := writer.(http.Flusher); ok {
-		wrappedWriter = WrapWriterAsFlusherWriter(writer, flusher)
+
+// tunnelAdapter accepts the request as a tunnel. HTTP/1.1 requests take over their connection once answered, as
+// with CONNECT. HTTP/2 requests are full-duplex, so their bodies carry the tunnel.
+func tunnelAdapter(writer http.ResponseWriter, request *http.Request, backlogChan chan<- net.Conn, closed <-chan struct{}) {
+	if request.ProtoMajor == 1 {
+		hijacker, ok := writer.(http.Hijacker)
+		if !ok {
+			http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		conn, readWriter, err := hijacker.Hijack()
+		if err != nil {
+			return
+		}
+		if _, err = conn.Write([]byte("HTTP/1.1 200 OK\r\n\r\n")); err != nil {
+			_ = conn.Close()
+			return
+		}
+		accepted := newBufferedConn(conn, readWriter.Reader)
+		select {
+		case backlogChan <- accepted:
+		case <-closed:
+			_ = accepted.Close()
+		}
+		return
+	}
+
+	streamResponse(writer, request, backlogChan, closed, stream.WrapFifoConn)
+}
+
+// streamResponse answers request with 200, then pushes the connection wrap makes of bodies of request and response,
+// and waits for it to be closed. The connection reports addresses of the one request came on. It returns false if the
+// connection was never accepted, as listener was closed or request ended first.
+func streamResponse(writer http.ResponseWriter, request *http.Request, backlogChan chan<- net.Conn, closed <-chan struct{}, wrap func(io.ReadCloser, io.WriteCloser) *stream.DoubleFifoConn) bool {
+	writer.WriteHeader(http.StatusOK)
+	flusher, _ := writer.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	// writer can't be used once handler returns.
+	responseWriter := &handlerWriter{writer: writer, flusher: flusher}
+	defer responseWriter.Close()
+	accepted := newRequestConn(wrap(request.Body, responseWriter), request)
+	select {
+	case backlogChan <- accepted:
+	case <-closed:
+		return false
+	case <-request.Context().Done():
+		return false
 	}
-	accepted := stream.WrapFifoConn(request.Body, wrappedWriter)
-	backlogChan <- accepted
 	select {
 	case <-accepted.CloseChan():
 	case <-request.Context().Done():
 	}
+	return true
+}
+
+// handlerWriter writes to response of a handler, until it is closed.
+type handlerWriter struct {
+	mutex   sync.Mutex
+	writer  io.Writer
+	flusher http.Flusher
+	done    bool
+}
+
+func (w *handlerWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.done {
+		return 0, net.ErrClosed
+	}
+	n, err := w.writer.Write(p)
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+	return n, err
+}
+
+func (w *handlerWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.done = true
+	return nil
 }
 
 // requestAdapterFunc transforms given Request and ResponseWriter to a net.Conn and pushes to channel, then waits for
-// connection being closed.
-type requestAdapterFunc func(w http.ResponseWriter, r *http.Request, c chan net.Conn)
+// connection being closed. It gives up pushing once closed is closed.
+type requestAdapterFunc func(w http.ResponseWriter, r *http.Request, c chan<- net.Conn, closed <-chan struct{})
 
-func newRequestHandler(parameters utils.Parameters, scheme string, adapter requestAdapterFunc) (http.Handler, <-chan net.Conn, error) {
+func newRequestHandler(parameters utils.Parameters, scheme string, method string, adapter requestAdapterFunc, closed <-chan struct{}) (http.Handler, <-chan net.Conn, error) {
 	handledUrl := createURLFromParameters(parameters, scheme)
-	method := strings.ToUpper(utils.StringFromParameters(parameters, "method", "GET"))
 	// todo: extra headers matcher
-	// todo: authorization support
-	requestMatcher, err := getRequestMatcher(method, handledUrl, dummyHeaderMatcher)
+	headerMatcher := dummyHeaderMatcher
+	if handledUrl.User != nil {
+		headerMatcher = authorizationMatcher(method, handledUrl.User)
+	}
+	requestMatcher, err := getRequestMatcher(method, handledUrl, headerMatcher)
 	if err != nil {
 		return nil, nil, err
 	}
-	backlogSize := utils.IntegerFromParameters(parameters, "backlog", 1000)
+	backlogSize := utils.IntegerFromParameters(parameters, ParamBacklog, DefaultBacklog)
 	if backlogSize < 1 {
 		return nil, nil, ErrInvalidBacklogSize
 	}
 	backlogChan := make(chan net.Conn, backlogSize)
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		if requestMatcher(request) {
-			adapter(writer, request, backlogChan)
+			adapter(writer, request, backlogChan, closed)
 			return
 		}
 		http.NotFound(writer, request)
 	}), backlogChan, nil
 }
 
+// authorizationMatcher matches requests carrying credentials of userInfo, in the header the client puts them in.
+func authorizationMatcher(method string, userInfo *url.Userinfo) headerMatcherFunc {
+	header := "Authorization"
+	if method == http.MethodConnect {
+		header = "Proxy-Authorization"
+	}
+	expected := []byte(basicAuthorization(userInfo))
+	return func(h http.Header) bool {
+		return subtle.ConstantTimeCompare([]byte(h.Get(header)), expected) == 1
+	}
+}
+
 var ErrInvalidBacklogSize = errors.New("backlog size has to be >= 1")
 
 // Workaround for "http.ResponseWriter" not supporting "io.Closer"
@@ -153,32 +251,107 @@ func WrapWriterAsFlusherWriter(writer io.Writer, flusher http.Flusher) io.WriteC
 }
 
 type httpListener struct {
+	listener       types.StreamListener
 	server         *http.Server
 	backlogChannel <-chan net.Conn
 	closed         chan struct{}
+	closeOnce      sync.Once
+}
+
+var _ types.StreamListener = &httpListener{}
+
+func (h *httpListener) serve() {
+	_ = h.server.Serve(netListener{h.listener})
+	h.signalClose()
+}
+
+func (h *httpListener) signalClose() {
+	h.closeOnce.Do(func() {
+		close(h.closed)
+	})
 }
 
 func (h *httpListener) CloseChan() <-chan struct{} {
-	//TODO implement me
-	panic("implement me")
+	return h.closed
 }
 
+// Close stops accepting requests. Tunnels that were already accepted are left open.
 func (h *httpListener) Close() error {
-	//TODO implement me
-	panic("implement me")
+	h.signalClose()
+	err := h.server.Close()
+	// Serve may not have started yet, leaving listener open.
+	_ = h.listener.Close()
+	return err
 }
 
 func (h *httpListener) Accept() (socket types.Socket, err error) {
-	//TODO implement me
-	panic("implement me")
+	return h.AcceptConn()
 }
 
 func (h *httpListener) Addr() net.Addr {
-	//TODO implement me
-	panic("implement me")
+	return h.listener.Addr()
 }
 
 func (h *httpListener) AcceptConn() (socket types.StreamConn, err error) {
-	//TODO implement me
-	panic("implement me")
+	conn, err := h.acceptRaw()
+	if err != nil {
+		return nil, err
+	}
+	return stream.WrapConn(conn, nil, nil), nil
+}
+
+// acceptRaw returns the next connection as the request adapter made it.
+func (h *httpListener) acceptRaw() (net.Conn, error) {
+	select {
+	case conn := <-h.backlogChannel:
+		return conn, nil
+	case <-h.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// netListener lets http.Server accept from a StreamListener. http.Server uses deadlines to interrupt reads, which
+// connections below may take for an end, so it gets deadlines of its own until it hands the connection over with
+// Hijack. See hijackedPassthrough.
+type netListener struct {
+	types.StreamListener
+}
+
+func (l netListener) Accept() (net.Conn, error) {
+	conn, err := l.AcceptConn()
+	if err != nil {
+		return nil, err
+	}
+	return stream.WrapDeadlineConn(conn), nil
+}
+
+// hijackedPassthrough makes connections that handler hijacks stop giving deadlines of their own, as http.Server is done
+// with them. This covers HTTP/1.1 tunnels, WebSockets and HTTP/2 connections of h2c alike.
+func hijackedPassthrough(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		handler.ServeHTTP(passthroughWriter{writer}, request)
+	})
+}
+
+// passthroughWriter is a http.ResponseWriter whose Hijack returns the connection as it is below netListener.
+type passthroughWriter struct {
+	http.ResponseWriter
+}
+
+func (w passthroughWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w passthroughWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, readWriter, err := hijacker.Hijack()
+	if deadlineConn, ok := conn.(*stream.DeadlineConn); ok && err == nil {
+		deadlineConn.Passthrough()
+	}
+	return conn, readWriter, err
 }
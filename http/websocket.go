@@ -1,3 +1,432 @@
 package http
 
-import "github.com/gorilla/websocket"
+import (
+	"context"
+	"encoding/base64"
+	"github.com/gorilla/websocket"
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/basics/stream"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ParamHeaders         = "headers"
+	ParamSubprotocols    = "subprotocols"
+	ParamOrigin          = "origin"
+	ParamMaxMessageSize  = "maxmessage"
+	ParamEarlyData       = "earlydata"
+	ParamEarlyDataHeader = "earlydataheader"
+
+	DefaultMaxMessageSize  = 65536
+	DefaultEarlyDataHeader = "Sec-WebSocket-Protocol"
+
+	closeTimeout = time.Second
+)
+
+var webSocketCommonParametersHint = []utils.ParameterHint{
+	{Key: ParamHost, Description: "host of upgrade requests", Type: utils.ParameterTypeString},
+	{Key: ParamPath, Description: "path of upgrade requests", Type: utils.ParameterTypeString, DefaultValue: "/"},
+	{Key: ParamQuery, Description: "query of upgrade requests; server requires the same values", Type: utils.ParameterTypeString},
+	{Key: ParamUsername, Description: "username for basic authorization", Type: utils.ParameterTypeString},
+	{Key: ParamPassword, Description: "password for basic authorization", Type: utils.ParameterTypeString},
+	{Key: ParamSubprotocols, Description: "subprotocols, comma-separated in order of preference", Type: utils.ParameterTypeMultiString},
+	{Key: ParamOrigin, Description: "origin sent by client; server accepts only this origin if set", Type: utils.ParameterTypeString},
+	{Key: ParamMaxMessageSize, Description: "largest message sent or accepted; peers must agree", Type: utils.ParameterTypeInt, DefaultValue: "65536"},
+}
+
+var webSocketClientParametersHint = append([]utils.ParameterHint{
+	{Key: ParamHeaders, Description: "extra headers of upgrade requests, as comma-separated Name:Value pairs", Type: utils.ParameterTypeMultiString},
+}, webSocketCommonParametersHint...)
+
+var webSocketServerParametersHint = append([]utils.ParameterHint{
+	{Key: ParamBacklog, Description: "connections waiting to be accepted", Type: utils.ParameterTypeInt, DefaultValue: "1000"},
+}, webSocketCommonParametersHint...)
+
+var webSocketEarlyDataParametersHint = []utils.ParameterHint{
+	{Key: ParamEarlyData, Description: "bytes of first write sent in upgrade request, 0 to disable; server accepts up to this many", Type: utils.ParameterTypeInt, DefaultValue: "0"},
+	{Key: ParamEarlyDataHeader, Description: "header carrying early data, encoded in base64", Type: utils.ParameterTypeString, DefaultValue: DefaultEarlyDataHeader},
+}
+
+var webSocketStreamClientParametersHint = append(append([]utils.ParameterHint{}, webSocketClientParametersHint...), webSocketEarlyDataParametersHint...)
+var webSocketStreamServerParametersHint = append(append([]utils.ParameterHint{}, webSocketServerParametersHint...), webSocketEarlyDataParametersHint...)
+
+// WebSocketImplementation carries streams in binary WebSocket messages. TLS, for "wss", goes in a layer below.
+type WebSocketImplementation struct {
+	// nothing.
+}
+
+var _ types.StreamObfuscatorImplementation = &WebSocketImplementation{}
+var _ types.StreamObfuscatorContextImplementation = &WebSocketImplementation{}
+var _ types.HasParametersHint = &WebSocketImplementation{}
+
+type webSocketOptions struct {
+	url            string
+	header         http.Header
+	subprotocols   []string
+	origin         string
+	maxMessageSize int
+	// earlyData is zero when early data is disabled.
+	earlyData       int
+	earlyDataHeader string
+}
+
+func webSocketOptionsFromParameters(parameters utils.Parameters) (*webSocketOptions, error) {
+	requestUrl := createURLFromParameters(parameters, "ws")
+	if requestUrl.Host == "" {
+		return nil, ErrHostNotDefined
+	}
+	header, problems := headersFromParameters(parameters)
+	options := &webSocketOptions{
+		header:          header,
+		subprotocols:    utils.MultiStringFromParameters(parameters, ParamSubprotocols, nil),
+		origin:          utils.StringFromParameters(parameters, ParamOrigin, ""),
+		maxMessageSize:  utils.IntegerFromParameters(parameters, ParamMaxMessageSize, DefaultMaxMessageSize),
+		earlyData:       utils.IntegerFromParameters(parameters, ParamEarlyData, 0),
+		earlyDataHeader: http.CanonicalHeaderKey(utils.StringFromParameters(parameters, ParamEarlyDataHeader, DefaultEarlyDataHeader)),
+	}
+	if options.maxMessageSize < 1 {
+		problems = append(problems, muxedsocket.ParameterProblem{Key: ParamMaxMessageSize, Reason: "must be positive"})
+	}
+	if options.earlyData < 0 {
+		problems = append(problems, muxedsocket.ParameterProblem{Key: ParamEarlyData, Reason: "must not be negative"})
+	}
+	if options.earlyData > 0 && options.earlyDataHeader == "" {
+		problems = append(problems, muxedsocket.ParameterProblem{Key: ParamEarlyDataHeader, Reason: "must not be empty"})
+	}
+	if options.earlyData > 0 && options.earlyDataHeader == http.CanonicalHeaderKey(DefaultEarlyDataHeader) && len(options.subprotocols) > 0 {
+		problems = append(problems, muxedsocket.ParameterProblem{Key: ParamEarlyDataHeader, Reason: "early data takes place of subprotocols; pick another header"})
+	}
+	if len(problems) > 0 {
+		return nil, muxedsocket.ErrInvalidParameters{Problems: problems}
+	}
+	if requestUrl.User != nil {
+		options.header.Set("Authorization", basicAuthorization(requestUrl.User))
+		requestUrl.User = nil
+	}
+	if options.origin != "" {
+		options.header.Set("Origin", options.origin)
+	}
+	options.url = requestUrl.String()
+	return options, nil
+}
+
+// headersFromParameters parses extra headers of requests, given as Name:Value pairs.
+func headersFromParameters(parameters utils.Parameters) (http.Header, []muxedsocket.ParameterProblem) {
+	header := make(http.Header)
+	var problems []muxedsocket.ParameterProblem
+	for _, pair := range utils.MultiStringFromParameters(parameters, ParamHeaders, nil) {
+		name, value, found := strings.Cut(pair, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			problems = append(problems, muxedsocket.ParameterProblem{Key: ParamHeaders, Reason: "expected Name:Value pairs"})
+			continue
+		}
+		header.Add(name, strings.TrimSpace(value))
+	}
+	return header, problems
+}
+
+func (i *WebSocketImplementation) Server(conn types.StreamListenFunc, parameters utils.Parameters) (types.StreamListenFunc, error) {
+	listenFunc, err := i.ServerContext(conn.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return listenFunc.WithoutContext(), nil
+}
+
+func (i *WebSocketImplementation) Client(conn types.StreamDialFunc, parameters utils.Parameters) (types.StreamDialFunc, error) {
+	dialFunc, err := i.ClientContext(conn.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return dialFunc.WithoutContext(), nil
+}
+
+func (i *WebSocketImplementation) ServerContext(conn types.StreamListenContextFunc, parameters utils.Parameters) (types.StreamListenContextFunc, error) {
+	options, err := webSocketOptionsFromParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+	adapter := webSocketAdapter(options)
+	// fail early on bad parameters, instead of when listening.
+	if _, _, err := newRequestHandler(parameters, ProtoHTTP, http.MethodGet, adapter, nil); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) (types.StreamListener, error) {
+		listener, err := conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		wsListener, err := serveListener(listener, parameters, ProtoHTTP, http.MethodGet, adapter)
+		if err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+		return wsListener, nil
+	}, nil
+}
+
+func (i *WebSocketImplementation) ClientContext(conn types.StreamDialContextFunc, parameters utils.Parameters) (types.StreamDialContextFunc, error) {
+	options, err := webSocketOptionsFromParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+	dialer := func(ctx context.Context) (net.Conn, error) {
+		if options.earlyData > 0 {
+			return dialEarlyData(ctx, conn, options)
+		}
+		return dialWebSocket(ctx, conn, options)
+	}
+	// redialing happens later, outside the lifetime of dial context.
+	redialer := func() (net.Conn, error) {
+		return dialer(context.Background())
+	}
+	return func(ctx context.Context) (types.StreamConn, error) {
+		conn, err := dialer(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return stream.WrapConn(conn, redialer, nil), nil
+	}, nil
+}
+
+func dialWebSocket(ctx context.Context, dialFunc types.StreamDialContextFunc, options *webSocketOptions) (*webSocketConn, error) {
+	underlying, err := dialFunc(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := handshakeWebSocket(ctx, underlying, options, nil)
+	if err != nil {
+		_ = underlying.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// handshakeWebSocket upgrades underlying, sending earlyData along with the upgrade request. It leaves closing
+// underlying on failure to the caller.
+func handshakeWebSocket(ctx context.Context, underlying net.Conn, options *webSocketOptions, earlyData []byte) (*webSocketConn, error) {
+	header := options.header.Clone()
+	if len(earlyData) > 0 {
+		header.Set(options.earlyDataHeader, base64.RawURLEncoding.EncodeToString(earlyData))
+	}
+	dialer := &websocket.Dialer{
+		NetDialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+			return underlying, nil
+		},
+		Subprotocols: options.subprotocols,
+	}
+	stopWatching := cancelWhenDone(ctx, func() {
+		// unblocks the handshake below.
+		_ = underlying.SetDeadline(time.Unix(1, 0))
+	})
+	conn, response, err := dialer.DialContext(ctx, options.url, header)
+	if cancelled := stopWatching(); cancelled {
+		err = ctx.Err()
+	}
+	if err == websocket.ErrBadHandshake && response != nil {
+		err = ErrRequestRejected(response.Status)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newWebSocketConn(conn, options.maxMessageSize), nil
+}
+
+// webSocketAdapter upgrades requests. Upgrader answers requests it can't upgrade by itself.
+func webSocketAdapter(options *webSocketOptions) requestAdapterFunc {
+	upgrader := &websocket.Upgrader{
+		Subprotocols: options.subprotocols,
+		CheckOrigin: func(r *http.Request) bool {
+			return options.origin == "" || r.Header.Get("Origin") == options.origin
+		},
+	}
+	return func(writer http.ResponseWriter, request *http.Request, backlogChan chan<- net.Conn, closed <-chan struct{}) {
+		earlyData, responseHeader, err := acceptEarlyData(request, options)
+		if err != nil {
+			http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		conn, err := upgrader.Upgrade(writer, request, responseHeader)
+		if err != nil {
+			return
+		}
+		accepted := newWebSocketConn(conn, options.maxMessageSize)
+		accepted.earlyData = earlyData
+		select {
+		case backlogChan <- accepted:
+		case <-closed:
+			_ = accepted.Close()
+		}
+	}
+}
+
+// acceptEarlyData decodes early data sent along with request, if server takes early data. When early data comes in
+// Sec-WebSocket-Protocol, the value is echoed back as the chosen subprotocol, as browsers expect.
+func acceptEarlyData(request *http.Request, options *webSocketOptions) ([]byte, http.Header, error) {
+	if options.earlyData == 0 {
+		return nil, nil, nil
+	}
+	value := request.Header.Get(options.earlyDataHeader)
+	if value == "" {
+		return nil, nil, nil
+	}
+	earlyData, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(earlyData) > options.earlyData {
+		return nil, nil, ErrEarlyDataTooLarge
+	}
+	if options.earlyDataHeader == http.CanonicalHeaderKey(DefaultEarlyDataHeader) {
+		return earlyData, http.Header{options.earlyDataHeader: {value}}, nil
+	}
+	return earlyData, nil, nil
+}
+
+// webSocketConn is a stream carried in binary messages. Writes larger than maxMessageSize are split.
+type webSocketConn struct {
+	conn           *websocket.Conn
+	maxMessageSize int
+	// earlyData is read before any message.
+	earlyData []byte
+
+	readMutex  sync.Mutex
+	reader     io.Reader
+	writeMutex sync.Mutex
+}
+
+var _ net.Conn = &webSocketConn{}
+
+func newWebSocketConn(conn *websocket.Conn, maxMessageSize int) *webSocketConn {
+	conn.SetReadLimit(int64(maxMessageSize))
+	return &webSocketConn{conn: conn, maxMessageSize: maxMessageSize}
+}
+
+func (c *webSocketConn) Read(b []byte) (int, error) {
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
+	if len(c.earlyData) > 0 {
+		n := copy(b, c.earlyData)
+		c.earlyData = c.earlyData[n:]
+		return n, nil
+	}
+	for {
+		if c.reader == nil {
+			messageType, reader, err := c.conn.NextReader()
+			if err != nil {
+				return 0, webSocketError(err)
+			}
+			if messageType != websocket.BinaryMessage {
+				continue
+			}
+			c.reader = reader
+		}
+		n, err := c.reader.Read(b)
+		if err == io.EOF {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, webSocketError(err)
+	}
+}
+
+// readPacket returns the next binary message whole.
+func (c *webSocketConn) readPacket() ([]byte, error) {
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
+	c.reader = nil
+	for {
+		messageType, p, err := c.conn.ReadMessage()
+		if err != nil {
+			return nil, webSocketError(err)
+		}
+		if messageType == websocket.BinaryMessage {
+			return p, nil
+		}
+	}
+}
+
+// writePacket sends p as a single binary message.
+func (c *webSocketConn) writePacket(p []byte, deadline time.Time) error {
+	if len(p) > c.maxMessageSize {
+		return muxedsocket.ErrPacketTooLarge
+	}
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	_ = c.conn.SetWriteDeadline(deadline)
+	return webSocketError(c.conn.WriteMessage(websocket.BinaryMessage, p))
+}
+
+func (c *webSocketConn) Write(b []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	written := 0
+	for written < len(b) {
+		size := len(b) - written
+		if size > c.maxMessageSize {
+			size = c.maxMessageSize
+		}
+		if err := c.conn.WriteMessage(websocket.BinaryMessage, b[written:written+size]); err != nil {
+			return written, webSocketError(err)
+		}
+		written += size
+	}
+	return written, nil
+}
+
+// Close tells peer that connection is closing, then closes it without waiting for an answer.
+func (c *webSocketConn) Close() error {
+	message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	_ = c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(closeTimeout))
+	return c.conn.Close()
+}
+
+func (c *webSocketConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *webSocketConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *webSocketConn) SetDeadline(t time.Time) error {
+	if err := c.conn.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.conn.SetWriteDeadline(t)
+}
+
+func (c *webSocketConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *webSocketConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// webSocketError reports closing by peer as io.EOF, like other connections do.
+func webSocketError(err error) error {
+	if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+		return io.EOF
+	}
+	return err
+}
+
+func (i *WebSocketImplementation) ClientParametersHint() []utils.ParameterHint {
+	return webSocketStreamClientParametersHint
+}
+
+func (i *WebSocketImplementation) ServerParametersHint() []utils.ParameterHint {
+	return webSocketStreamServerParametersHint
+}
@@ -1,8 +1,10 @@
 package http
 
 import (
+	"bufio"
 	"context"
 	"crypto/tls"
+	"encoding/base64"
 	"errors"
 	"github.com/hadi77ir/muxedsocket/basics/stream"
 	"github.com/hadi77ir/muxedsocket/types"
@@ -13,56 +15,195 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
 var ErrHostNotDefined = errors.New("host is required")
 
+// ErrRequestRejected is returned when server answers the request with anything but 200 OK. It holds the status.
+type ErrRequestRejected string
+
+func (e ErrRequestRejected) Error() string {
+	return "http request rejected: " + string(e)
+}
+
 func WrapHttpClient(dialFunc types.StreamDialFunc, parameters utils.Parameters) (types.StreamDialFunc, error) {
-	dialer, err := wrapStandardHttpClient(func() (net.Conn, error) {
-		return dialFunc()
-	}, parameters)
+	dialer, err := WrapHttpClientContext(dialFunc.WithContext(), parameters)
 	if err != nil {
 		return nil, err
 	}
-	return stream.WrapDialer(dialer), nil
+	return dialer.WithoutContext(), nil
 }
 
-func wrapStandardHttpClient(dialFunc stream.StandardPrimedDialFunc, parameters utils.Parameters) (stream.StandardPrimedDialFunc, error) {
-	transport, scheme, err := CreateTransport(dialFunc, parameters)
+// WrapHttpClientContext is like WrapHttpClient, but the context passed when dialing bounds both dialing the
+// underlying connection and the HTTP round trip, until response headers are received.
+func WrapHttpClientContext(dialFunc types.StreamDialContextFunc, parameters utils.Parameters) (types.StreamDialContextFunc, error) {
+	dialer, err := wrapStandardHttpClient(func(ctx context.Context) (net.Conn, error) {
+		return dialFunc(ctx)
+	}, parameters)
 	if err != nil {
 		return nil, err
 	}
+	// redialing happens later, outside the lifetime of dial context.
+	redialer := func() (net.Conn, error) {
+		return dialer(context.Background())
+	}
+	return func(ctx context.Context) (types.StreamConn, error) {
+		conn, err := dialer(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return stream.WrapConn(conn, redialer, nil), nil
+	}, nil
+}
+
+func wrapStandardHttpClient(dialFunc stream.StandardPrimedDialContextFunc, parameters utils.Parameters) (stream.StandardPrimedDialContextFunc, error) {
+	forceH2, scheme := GetProtocolFromParameters(parameters)
 	requestConstructor, err := CreateRequestConstructor(parameters, scheme)
 	if err != nil {
 		return nil, err
 	}
-	return func() (net.Conn, error) {
+	if !forceH2 {
+		return wrapHTTP1Client(dialFunc, requestConstructor), nil
+	}
+	return wrapH2Client(dialFunc, newH2Transport(parameters), requestConstructor, newFifoConn), nil
+}
+
+// responseConnFunc makes a connection of the response to a tunnel request, and the writer of its request body.
+type responseConnFunc func(response *http.Response, bodyWriter io.WriteCloser) (*stream.DoubleFifoConn, error)
+
+func newFifoConn(response *http.Response, bodyWriter io.WriteCloser) (*stream.DoubleFifoConn, error) {
+	return stream.WrapFifoConn(response.Body, bodyWriter), nil
+}
+
+// wrapH2Client tunnels each connection through a request of its own, on a connection of its own. Bodies of request
+// and response carry the tunnel, as newConn makes of them.
+func wrapH2Client(dialFunc stream.StandardPrimedDialContextFunc, transport *http2.Transport, requestConstructor RequestConstructorFunc, newConn responseConnFunc) stream.StandardPrimedDialContextFunc {
+	return func(ctx context.Context) (net.Conn, error) {
+		// every tunnel gets a connection of its own, as other obfuscators do.
+		underlying, err := dialFunc(ctx)
+		if err != nil {
+			return nil, err
+		}
+		clientConn, err := transport.NewClientConn(underlying)
+		if err != nil {
+			_ = underlying.Close()
+			return nil, err
+		}
 		bodyReader, bodyWriter := net.Pipe()
 		request, err := requestConstructor(bodyReader)
 		if err != nil {
+			_ = clientConn.Close()
 			return nil, err
 		}
-		response, err := transport.RoundTrip(request)
-		return stream.WrapFifoConn(response.Body, bodyWriter), nil
-	}, nil
+		// request has to outlive ctx, as its body is the connection being returned.
+		requestCtx, cancelRequest := context.WithCancel(context.Background())
+		stopWatching := cancelWhenDone(ctx, cancelRequest)
+		response, err := clientConn.RoundTrip(request.WithContext(requestCtx))
+		if cancelled := stopWatching(); cancelled {
+			if err == nil {
+				_ = response.Body.Close()
+			}
+			err = ctx.Err()
+		}
+		if err == nil && response.StatusCode != http.StatusOK {
+			_ = response.Body.Close()
+			err = ErrRequestRejected(response.Status)
+		}
+		var conn *stream.DoubleFifoConn
+		if err == nil {
+			conn, err = newConn(response, bodyWriter)
+			if err != nil {
+				_ = response.Body.Close()
+			}
+		}
+		if err != nil {
+			cancelRequest()
+			_ = bodyWriter.Close()
+			_ = clientConn.Close()
+			return nil, err
+		}
+		go func() {
+			<-conn.CloseChan()
+			cancelRequest()
+			_ = clientConn.Close()
+		}()
+		return conn, nil
+	}
+}
+
+// wrapHTTP1Client sends the request without a body and, once the server accepts it, uses the connection itself as
+// the tunnel, as with CONNECT. Full-duplex request bodies are not something HTTP/1.1 servers can be relied on for.
+func wrapHTTP1Client(dialFunc stream.StandardPrimedDialContextFunc, requestConstructor RequestConstructorFunc) stream.StandardPrimedDialContextFunc {
+	return func(ctx context.Context) (net.Conn, error) {
+		conn, err := dialFunc(ctx)
+		if err != nil {
+			return nil, err
+		}
+		request, err := requestConstructor(nil)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		stopWatching := cancelWhenDone(ctx, func() {
+			// unblocks the exchange below.
+			_ = conn.SetDeadline(time.Unix(1, 0))
+		})
+		reader := bufio.NewReader(conn)
+		err = request.Write(conn)
+		var response *http.Response
+		if err == nil {
+			response, err = http.ReadResponse(reader, request)
+		}
+		if cancelled := stopWatching(); cancelled {
+			err = ctx.Err()
+			_ = conn.SetDeadline(time.Time{})
+		}
+		if err == nil && response.StatusCode != http.StatusOK {
+			err = ErrRequestRejected(response.Status)
+		}
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return newBufferedConn(conn, reader), nil
+	}
+}
+
+// cancelWhenDone calls cancel if ctx is done before the returned function is called. The returned function reports
+// whether cancel was called.
+func cancelWhenDone(ctx context.Context, cancel context.CancelFunc) func() bool {
+	stop := make(chan struct{})
+	cancelled := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+			cancelled <- true
+		case <-stop:
+			cancelled <- false
+		}
+	}()
+	return func() bool {
+		close(stop)
+		return <-cancelled
+	}
 }
 
 type RequestConstructorFunc func(reqBody io.ReadCloser) (*http.Request, error)
 
-func CreateTransport(dialFunc stream.StandardPrimedDialFunc, parameters utils.Parameters) (roundTripper http.RoundTripper, scheme string, err error) {
-	dialer := WrapDialerWithContext(func(network, addr string) (net.Conn, error) {
-		return dialFunc()
-	})
+func CreateTransport(dialFunc stream.StandardPrimedDialContextFunc, parameters utils.Parameters) (roundTripper http.RoundTripper, scheme string, err error) {
+	dialer := func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		return dialFunc(ctx)
+	}
 
 	forceH2, scheme := GetProtocolFromParameters(parameters)
 	if forceH2 {
-		roundTripper = &http2.Transport{
-			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
-				return dialer(ctx, network, addr)
-			},
-			DisableCompression: !utils.BoolFromParameters(parameters, "compression", true),
-			AllowHTTP:          true,
+		transport := newH2Transport(parameters)
+		transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dialer(ctx, network, addr)
 		}
+		roundTripper = transport
 		return
 	}
 
@@ -70,7 +211,7 @@ func CreateTransport(dialFunc stream.StandardPrimedDialFunc, parameters utils.Pa
 		DialTLSContext:      dialer,
 		DialContext:         dialer,
 		ForceAttemptHTTP2:   false,
-		DisableCompression:  !utils.BoolFromParameters(parameters, "compression", true),
+		DisableCompression:  !utils.BoolFromParameters(parameters, ParamCompression, true),
 		DisableKeepAlives:   !utils.BoolFromParameters(parameters, "keepalive", true),
 		MaxIdleConns:        utils.IntegerFromParameters(parameters, "idle", 0),
 		MaxIdleConnsPerHost: utils.IntegerFromParameters(parameters, "idleperhost", http.DefaultMaxIdleConnsPerHost),
@@ -78,13 +219,20 @@ func CreateTransport(dialFunc stream.StandardPrimedDialFunc, parameters utils.Pa
 	return
 }
 
+func newH2Transport(parameters utils.Parameters) *http2.Transport {
+	return &http2.Transport{
+		DisableCompression: !utils.BoolFromParameters(parameters, ParamCompression, true),
+		AllowHTTP:          true,
+	}
+}
+
 const (
 	ProtoHTTP  = "http"
 	ProtoHTTPS = "https"
 )
 
 func GetProtocolFromParameters(parameters utils.Parameters) (bool, string) {
-	switch utils.StringFromParameters(parameters, "proto", "http") {
+	switch utils.StringFromParameters(parameters, ParamProto, ProtoHTTP) {
 	case "https":
 		// HTTP/1.1 over TLS. doesn't really differ from cleartext connection.
 		return false, ProtoHTTPS
@@ -132,8 +280,13 @@ func WrapDialerWithContext(dialer stream.StandardDialFunc) DialContextFunc {
 
 func CreateRequestConstructor(parameters utils.Parameters, scheme string) (RequestConstructorFunc, error) {
 	remoteUrl := createURLFromParameters(parameters, scheme)
-	remoteUrlStr := remoteUrl.String()
-	method := strings.ToUpper(utils.StringFromParameters(parameters, "method", "GET"))
+	method := methodFromParameters(parameters)
+	if remoteUrl.Host == "" {
+		return nil, ErrHostNotDefined
+	}
+	// credentials go into headers, not into the request line.
+	userInfo := remoteUrl.User
+	remoteUrl.User = nil
 	switch method {
 	case "CONNECT":
 		connectUrl, err := createConnectURLFromParameters(scheme, remoteUrl.Host)
@@ -142,16 +295,53 @@ func CreateRequestConstructor(parameters utils.Parameters, scheme string) (Reque
 		}
 		connectUrlStr := connectUrl.String()
 		return func(reqBody io.ReadCloser) (*http.Request, error) {
-			req := http.NewRequest(http.MethodConnect, connectUrlStr, reqBody)
-			req.Header.Add("Proxy-Authorization")
+			req, err := http.NewRequest(http.MethodConnect, connectUrlStr, reqBody)
+			if err != nil {
+				return nil, err
+			}
+			if userInfo != nil {
+				req.Header.Add("Proxy-Authorization", basicAuthorization(userInfo))
+			}
+			return req, nil
 		}, nil
 	default:
+		remoteUrlStr := remoteUrl.String()
 		return func(reqBody io.ReadCloser) (*http.Request, error) {
-			return http.NewRequest(method, remoteUrlStr, reqBody)
+			req, err := http.NewRequest(method, remoteUrlStr, reqBody)
+			if err != nil {
+				return nil, err
+			}
+			if userInfo != nil {
+				req.Header.Add("Authorization", basicAuthorization(userInfo))
+			}
+			return req, nil
 		}, nil
 	}
 }
 
+// withHeaders sets header on requests requestConstructor makes.
+func withHeaders(requestConstructor RequestConstructorFunc, header http.Header) RequestConstructorFunc {
+	return func(reqBody io.ReadCloser) (*http.Request, error) {
+		req, err := requestConstructor(reqBody)
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		return req, nil
+	}
+}
+
+func basicAuthorization(userInfo *url.Userinfo) string {
+	password, _ := userInfo.Password()
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(userInfo.Username()+":"+password))
+}
+
+func methodFromParameters(parameters utils.Parameters) string {
+	return strings.ToUpper(utils.StringFromParameters(parameters, ParamMethod, http.MethodGet))
+}
+
 func createConnectURLFromParameters(scheme, host string) (*url.URL, error) {
 	connectUrl := &url.URL{
 		Scheme: scheme,
@@ -166,13 +356,13 @@ func createConnectURLFromParameters(scheme, host string) (*url.URL, error) {
 func createURLFromParameters(parameters utils.Parameters, scheme string) *url.URL {
 	userInfo := userInfoFromParameters(parameters)
 	requestURL := &url.URL{
-		Host: utils.StringFromParameters(parameters, "host", ""),
+		Host: utils.StringFromParameters(parameters, ParamHost, ""),
 		// Scheme should be set to "https", regardless of whether our connection is encrypted or not.
 		// This will prevent HTTP client to introduce TLS itself.
 		Scheme:   scheme,
 		User:     userInfo,
-		Path:     utils.StringFromParameters(parameters, "path", ""),
-		RawQuery: utils.StringFromParameters(parameters, "query", ""),
+		Path:     utils.StringFromParameters(parameters, ParamPath, ""),
+		RawQuery: utils.StringFromParameters(parameters, ParamQuery, ""),
 	}
 	if !strings.HasPrefix(requestURL.Path, "/") {
 		requestURL.Path = "/" + requestURL.Path
@@ -181,8 +371,8 @@ func createURLFromParameters(parameters utils.Parameters, scheme string) *url.UR
 }
 
 func userInfoFromParameters(parameters utils.Parameters) *url.Userinfo {
-	if username, found := parameters.Get("username"); found {
-		if password, found := parameters.Get("password"); found {
+	if username, found := parameters.Get(ParamUsername); found {
+		if password, found := parameters.Get(ParamPassword); found {
 			return url.UserPassword(username, password)
 		}
 		return url.User(username)
@@ -0,0 +1,305 @@
+package http
+
+import (
+	"context"
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+const packetQueueSize = 64
+
+// WebSocketPacketImplementation carries packets over WebSocket, one packet per binary message, as in
+// "quic+wsp+tls+tcp". It takes the parameters of "ws"; packets larger than maxmessage are refused.
+type WebSocketPacketImplementation struct {
+	// nothing.
+}
+
+var _ types.PacketAdapterImplementation = &WebSocketPacketImplementation{}
+var _ types.PacketAdapterContextImplementation = &WebSocketPacketImplementation{}
+var _ types.HasParametersHint = &WebSocketPacketImplementation{}
+
+// WebSocketPeerAddr is the address server side sees packets of a WebSocket connection coming from. Connections from
+// the same remote address still get addresses of their own.
+type WebSocketPeerAddr struct {
+	ID     uint64
+	Remote net.Addr
+}
+
+func (a *WebSocketPeerAddr) Network() string {
+	return "wsp"
+}
+
+func (a *WebSocketPeerAddr) String() string {
+	return strconv.FormatUint(a.ID, 10) + "@" + a.Remote.String()
+}
+
+var _ net.Addr = &WebSocketPeerAddr{}
+
+func (i *WebSocketPacketImplementation) SupportsParallel() bool {
+	return false
+}
+
+func (i *WebSocketPacketImplementation) Server(listener types.StreamListenFunc, parameters utils.Parameters) (types.PacketConnFunc, error) {
+	listenFunc, err := i.ServerContext(listener.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return listenFunc.WithoutContext(), nil
+}
+
+func (i *WebSocketPacketImplementation) Client(dialFunc types.StreamDialFunc, parameters utils.Parameters) (types.PacketConnFunc, error) {
+	connFunc, err := i.ClientContext(dialFunc.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return connFunc.WithoutContext(), nil
+}
+
+// webSocketPacketOptionsFromParameters takes options of "ws", leaving early data out as it would break the boundaries
+// of packets.
+func webSocketPacketOptionsFromParameters(parameters utils.Parameters) (*webSocketOptions, error) {
+	options, err := webSocketOptionsFromParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+	options.earlyData = 0
+	return options, nil
+}
+
+func (i *WebSocketPacketImplementation) ServerContext(listener types.StreamListenContextFunc, parameters utils.Parameters) (types.PacketConnContextFunc, error) {
+	options, err := webSocketPacketOptionsFromParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+	adapter := webSocketAdapter(options)
+	// fail early on bad parameters, instead of when listening.
+	if _, _, err := newRequestHandler(parameters, ProtoHTTP, http.MethodGet, adapter, nil); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) (types.PacketConn, error) {
+		streamListener, err := listener(ctx)
+		if err != nil {
+			return nil, err
+		}
+		wsListener, err := serveListener(streamListener, parameters, ProtoHTTP, http.MethodGet, adapter)
+		if err != nil {
+			_ = streamListener.Close()
+			return nil, err
+		}
+		return listenWebSocketPackets(wsListener), nil
+	}, nil
+}
+
+func (i *WebSocketPacketImplementation) ClientContext(dialFunc types.StreamDialContextFunc, parameters utils.Parameters) (types.PacketConnContextFunc, error) {
+	options, err := webSocketPacketOptionsFromParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+	var connFunc types.PacketConnContextFunc
+	connFunc = func(ctx context.Context) (types.PacketConn, error) {
+		conn, err := dialWebSocket(ctx, dialFunc, options)
+		if err != nil {
+			return nil, err
+		}
+		return newWebSocketPacketClient(conn, connFunc), nil
+	}
+	return connFunc, nil
+}
+
+func (i *WebSocketPacketImplementation) ClientParametersHint() []utils.ParameterHint {
+	return webSocketClientParametersHint
+}
+
+func (i *WebSocketPacketImplementation) ServerParametersHint() []utils.ParameterHint {
+	return webSocketServerParametersHint
+}
+
+// webSocketPacketServer accepts WebSocket connections and sees each of them as a peer.
+type webSocketPacketServer struct {
+	*utils.PacketQueue
+	listener *httpListener
+	nextID   uint64
+
+	mutex sync.Mutex
+	peers map[string]*webSocketConn
+}
+
+func listenWebSocketPackets(listener *httpListener) *webSocketPacketServer {
+	s := &webSocketPacketServer{
+		PacketQueue: utils.NewPacketQueue(packetQueueSize),
+		listener:    listener,
+		peers:       make(map[string]*webSocketConn),
+	}
+	go s.acceptLoop()
+	return s
+}
+
+func (s *webSocketPacketServer) acceptLoop() {
+	for {
+		conn, err := s.listener.acceptRaw()
+		if err != nil {
+			_ = s.Close()
+			return
+		}
+		go s.serve(conn.(*webSocketConn))
+	}
+}
+
+func (s *webSocketPacketServer) serve(conn *webSocketConn) {
+	defer conn.Close()
+	addr := &WebSocketPeerAddr{ID: atomic.AddUint64(&s.nextID, 1), Remote: conn.RemoteAddr()}
+	key := addr.String()
+	s.mutex.Lock()
+	if s.IsClosed() {
+		s.mutex.Unlock()
+		return
+	}
+	s.peers[key] = conn
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.peers, key)
+		s.mutex.Unlock()
+	}()
+	for {
+		payload, err := conn.readPacket()
+		if err != nil {
+			return
+		}
+		// a reader that falls behind loses packets, instead of stalling the websocket.
+		if !s.TryDeliver(payload, addr) {
+			return
+		}
+	}
+}
+
+// WriteTo sends p to the connection at addr, which has to be an address that packets have been received from.
+func (s *webSocketPacketServer) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if s.IsClosed() {
+		return 0, net.ErrClosed
+	}
+	if addr == nil {
+		return 0, muxedsocket.ErrUnknownPeer
+	}
+	s.mutex.Lock()
+	conn, found := s.peers[addr.String()]
+	s.mutex.Unlock()
+	if !found {
+		return 0, muxedsocket.ErrUnknownPeer
+	}
+	if err := conn.writePacket(p, s.WriteDeadline()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *webSocketPacketServer) Close() error {
+	s.mutex.Lock()
+	if !s.Shutdown() {
+		s.mutex.Unlock()
+		return nil
+	}
+	conns := make([]*webSocketConn, 0, len(s.peers))
+	for _, conn := range s.peers {
+		conns = append(conns, conn)
+	}
+	s.mutex.Unlock()
+	err := s.listener.Close()
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+	return err
+}
+
+func (s *webSocketPacketServer) LocalAddr() net.Addr {
+	return s.listener.Addr()
+}
+
+func (s *webSocketPacketServer) RemoteAddr() net.Addr {
+	return nil
+}
+
+func (s *webSocketPacketServer) CanRedial() bool {
+	return false
+}
+
+func (s *webSocketPacketServer) Redial() (types.Socket, error) {
+	return nil, muxedsocket.ErrRedialNotSupported
+}
+
+var _ types.PacketConn = &webSocketPacketServer{}
+
+// webSocketPacketClient sends packets over a single WebSocket connection, and closes along with it.
+type webSocketPacketClient struct {
+	*utils.PacketQueue
+	conn     *webSocketConn
+	connFunc types.PacketConnContextFunc
+}
+
+func newWebSocketPacketClient(conn *webSocketConn, connFunc types.PacketConnContextFunc) *webSocketPacketClient {
+	c := &webSocketPacketClient{
+		PacketQueue: utils.NewPacketQueue(packetQueueSize),
+		conn:        conn,
+		connFunc:    connFunc,
+	}
+	go c.readLoop()
+	return c
+}
+
+func (c *webSocketPacketClient) readLoop() {
+	defer c.Close()
+	remoteAddr := c.conn.RemoteAddr()
+	for {
+		payload, err := c.conn.readPacket()
+		if err != nil {
+			return
+		}
+		// as on server, packets are dropped rather than left to stall the websocket.
+		if !c.TryDeliver(payload, remoteAddr) {
+			return
+		}
+	}
+}
+
+// WriteTo sends p to the peer, whatever addr is.
+func (c *webSocketPacketClient) WriteTo(p []byte, _ net.Addr) (int, error) {
+	if c.IsClosed() {
+		return 0, net.ErrClosed
+	}
+	if err := c.conn.writePacket(p, c.WriteDeadline()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *webSocketPacketClient) Close() error {
+	if !c.Shutdown() {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+func (c *webSocketPacketClient) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *webSocketPacketClient) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *webSocketPacketClient) CanRedial() bool {
+	return true
+}
+
+// Redial starts a new connection, over a WebSocket connection of its own.
+func (c *webSocketPacketClient) Redial() (types.Socket, error) {
+	return c.connFunc(context.Background())
+}
+
+var _ types.PacketConn = &webSocketPacketClient{}
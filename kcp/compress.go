@@ -0,0 +1,35 @@
+package kcp
+
+import (
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/klauspost/compress/snappy"
+	"sync"
+)
+
+// compressedConn compresses a session with snappy framing format, flushing on every write, like kcptun does.
+type compressedConn struct {
+	*Conn
+	reader     *snappy.Reader
+	writer     *snappy.Writer
+	writeMutex sync.Mutex
+}
+
+var _ types.StreamConn = &compressedConn{}
+
+func compress(conn *Conn) *compressedConn {
+	return &compressedConn{Conn: conn, reader: snappy.NewReader(conn), writer: snappy.NewBufferedWriter(conn)}
+}
+
+func (c *compressedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *compressedConn) Write(b []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	n, err := c.writer.Write(b)
+	if err != nil {
+		return n, err
+	}
+	return n, c.writer.Flush()
+}
@@ -0,0 +1,234 @@
+package kcp
+
+import (
+	"crypto/sha1"
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	K "github.com/xtaci/kcp-go/v5"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	ParamNoDelay       = "nodelay"
+	ParamInterval      = "interval"
+	ParamResend        = "resend"
+	ParamNoCongestion  = "nc"
+	ParamSendWindow    = "sndwnd"
+	ParamReceiveWindow = "rcvwnd"
+	ParamMTU           = "mtu"
+	ParamDataShards    = "datashard"
+	ParamParityShards  = "parityshard"
+	ParamDSCP          = "dscp"
+	ParamAckNoDelay    = "acknodelay"
+	ParamCrypt         = "crypt"
+	ParamKey           = "key"
+	ParamSalt          = "salt"
+	ParamMode          = "mode"
+	ParamCompress      = "compress"
+	ParamCompat        = "compat"
+
+	DefaultMode          = "fast"
+	DefaultSendWindow    = 128
+	DefaultReceiveWindow = 512
+	DefaultMTU           = 1350
+	DefaultDataShards    = 10
+	DefaultParityShards  = 3
+	// DefaultSalt is the salt kcptun uses, so that keys derived from the same passphrase match.
+	DefaultSalt = "kcp-go"
+
+	// CompatKcptun makes sessions interoperable with kcptun.
+	CompatKcptun = "kcptun"
+
+	keyIterations = 4096
+	keySize       = 32
+)
+
+// modes are presets of nodelay, interval, resend and nc, named like in kcptun.
+var modes = map[string][4]int{
+	"normal": {0, 40, 2, 1},
+	"fast":   {0, 30, 2, 1},
+	"fast2":  {1, 20, 2, 1},
+	"fast3":  {1, 10, 2, 1},
+}
+
+// kcptunParameters are defaults of kcptun. Its "nocomp" is the opposite of compress.
+var kcptunParameters = utils.Parameters{
+	ParamCrypt:    "aes",
+	ParamKey:      "it's a secrect",
+	ParamMode:     "fast",
+	ParamCompress: "true",
+}
+
+var parametersHint = []utils.ParameterHint{
+	{Key: ParamMode, Description: "preset of nodelay, interval, resend and nc: normal, fast, fast2 or fast3", Type: utils.ParameterTypeString, DefaultValue: DefaultMode},
+	{Key: ParamNoDelay, Description: "nodelay mode of kcp, 0 or 1", Type: utils.ParameterTypeInt, DefaultValue: "set by mode"},
+	{Key: ParamInterval, Description: "internal update interval in milliseconds", Type: utils.ParameterTypeInt, DefaultValue: "set by mode"},
+	{Key: ParamResend, Description: "fast resend after this many duplicate acks, 0 disables", Type: utils.ParameterTypeInt, DefaultValue: "set by mode"},
+	{Key: ParamNoCongestion, Description: "1 disables congestion control", Type: utils.ParameterTypeInt, DefaultValue: "set by mode"},
+	{Key: ParamSendWindow, Description: "send window in packets", Type: utils.ParameterTypeInt, DefaultValue: "128"},
+	{Key: ParamReceiveWindow, Description: "receive window in packets", Type: utils.ParameterTypeInt, DefaultValue: "512"},
+	{Key: ParamMTU, Description: "largest packet sent, including headers", Type: utils.ParameterTypeInt, DefaultValue: "1350"},
+	{Key: ParamDataShards, Description: "data shards of forward error correction", Type: utils.ParameterTypeInt, DefaultValue: "10"},
+	{Key: ParamParityShards, Description: "parity shards of forward error correction, 0 disables it", Type: utils.ParameterTypeInt, DefaultValue: "3"},
+	{Key: ParamDSCP, Description: "DSCP value set on outgoing packets", Type: utils.ParameterTypeInt, DefaultValue: "0"},
+	{Key: ParamAckNoDelay, Description: "send acks as soon as packets arrive", Type: utils.ParameterTypeBool, DefaultValue: "false"},
+	{Key: ParamCrypt, Description: "block cipher: aes, aes-128, aes-192, salsa20, blowfish, twofish, cast5, 3des, tea, xtea, sm4, xor, none or null (no header at all). aes if key is given", Type: utils.ParameterTypeString, DefaultValue: "none"},
+	{Key: ParamKey, Description: "passphrase that key of cipher is derived from", Type: utils.ParameterTypeString, DefaultValue: ""},
+	{Key: ParamSalt, Description: "salt of key derivation", Type: utils.ParameterTypeString, DefaultValue: DefaultSalt},
+	{Key: ParamCompress, Description: "compress streams with snappy", Type: utils.ParameterTypeBool, DefaultValue: "false"},
+	{Key: ParamCompat, Description: "compatibility profile, kcptun for defaults and wire format of kcptun", Type: utils.ParameterTypeString, DefaultValue: ""},
+}
+
+// Config holds settings applied to every KCP session.
+type Config struct {
+	NoDelay       int
+	Interval      int
+	Resend        int
+	NoCongestion  int
+	SendWindow    int
+	ReceiveWindow int
+	MTU           int
+	DataShards    int
+	ParityShards  int
+	DSCP          int
+	AckNoDelay    bool
+	// Block encrypts packets. It is nil for the "null" cipher, which leaves packets without a crypto header.
+	Block K.BlockCrypt
+	// Compress wraps sessions in a snappy stream, flushed on every write.
+	Compress bool
+}
+
+// ConfigFromParameters reads config from parameters, and creates the block cipher it asks for.
+func ConfigFromParameters(parameters utils.Parameters) (*Config, error) {
+	switch compat := utils.StringFromParameters(parameters, ParamCompat, ""); compat {
+	case "":
+	case CompatKcptun:
+		parameters = utils.CombineParameters(kcptunParameters, parameters)
+	default:
+		return nil, muxedsocket.ErrInvalidParameters{Problems: []muxedsocket.ParameterProblem{{Key: ParamCompat, Reason: "unknown profile " + compat}}}
+	}
+	mode, found := modes[utils.StringFromParameters(parameters, ParamMode, DefaultMode)]
+	if !found {
+		return nil, muxedsocket.ErrInvalidParameters{Problems: []muxedsocket.ParameterProblem{{Key: ParamMode, Reason: "unknown mode"}}}
+	}
+	config := &Config{
+		NoDelay:       utils.IntegerFromParameters(parameters, ParamNoDelay, mode[0]),
+		Interval:      utils.IntegerFromParameters(parameters, ParamInterval, mode[1]),
+		Resend:        utils.IntegerFromParameters(parameters, ParamResend, mode[2]),
+		NoCongestion:  utils.IntegerFromParameters(parameters, ParamNoCongestion, mode[3]),
+		SendWindow:    utils.IntegerFromParameters(parameters, ParamSendWindow, DefaultSendWindow),
+		ReceiveWindow: utils.IntegerFromParameters(parameters, ParamReceiveWindow, DefaultReceiveWindow),
+		MTU:           utils.IntegerFromParameters(parameters, ParamMTU, DefaultMTU),
+		DataShards:    utils.IntegerFromParameters(parameters, ParamDataShards, DefaultDataShards),
+		ParityShards:  utils.IntegerFromParameters(parameters, ParamParityShards, DefaultParityShards),
+		DSCP:          utils.IntegerFromParameters(parameters, ParamDSCP, 0),
+		AckNoDelay:    utils.BoolFromParameters(parameters, ParamAckNoDelay, false),
+		Compress:      utils.BoolFromParameters(parameters, ParamCompress, false),
+	}
+	if err := config.verify(); err != nil {
+		return nil, err
+	}
+
+	key, hasKey := parameters.Get(ParamKey)
+	crypt := "none"
+	if hasKey {
+		crypt = "aes"
+	}
+	crypt = utils.StringFromParameters(parameters, ParamCrypt, crypt)
+	if crypt != "none" && crypt != "null" && !hasKey {
+		return nil, muxedsocket.ErrMissingPart(ParamKey)
+	}
+	salt := utils.StringFromParameters(parameters, ParamSalt, DefaultSalt)
+	block, err := NewBlockCrypt(crypt, DeriveKey(key, salt))
+	if err != nil {
+		return nil, err
+	}
+	config.Block = block
+	return config, nil
+}
+
+func (c *Config) verify() error {
+	var problems []muxedsocket.ParameterProblem
+	positive := map[string]int{ParamInterval: c.Interval, ParamSendWindow: c.SendWindow, ParamReceiveWindow: c.ReceiveWindow, ParamMTU: c.MTU}
+	for _, key := range []string{ParamInterval, ParamSendWindow, ParamReceiveWindow, ParamMTU} {
+		if positive[key] <= 0 {
+			problems = append(problems, muxedsocket.ParameterProblem{Key: key, Reason: "must be positive"})
+		}
+	}
+	if c.DataShards < 0 {
+		problems = append(problems, muxedsocket.ParameterProblem{Key: ParamDataShards, Reason: "must not be negative"})
+	}
+	if c.ParityShards < 0 {
+		problems = append(problems, muxedsocket.ParameterProblem{Key: ParamParityShards, Reason: "must not be negative"})
+	}
+	if c.DSCP < 0 || c.DSCP > 63 {
+		problems = append(problems, muxedsocket.ParameterProblem{Key: ParamDSCP, Reason: "must be between 0 and 63"})
+	}
+	if len(problems) > 0 {
+		return muxedsocket.ErrInvalidParameters{Problems: problems}
+	}
+	return nil
+}
+
+// apply sets the config on a session.
+func (c *Config) apply(session *K.UDPSession) {
+	session.SetStreamMode(true)
+	session.SetWriteDelay(false)
+	session.SetNoDelay(c.NoDelay, c.Interval, c.Resend, c.NoCongestion)
+	session.SetWindowSize(c.SendWindow, c.ReceiveWindow)
+	session.SetMtu(c.MTU)
+	session.SetACKNoDelay(c.AckNoDelay)
+	if c.DSCP > 0 {
+		// best effort; not every packet connection allows setting it.
+		_ = session.SetDSCP(c.DSCP)
+	}
+}
+
+// wrap compresses conn, if config asks for it.
+func (c *Config) wrap(conn *Conn) types.StreamConn {
+	if c.Compress {
+		return compress(conn)
+	}
+	return conn
+}
+
+// DeriveKey derives key of a cipher from a passphrase, with PBKDF2.
+func DeriveKey(passphrase, salt string) []byte {
+	return pbkdf2.Key([]byte(passphrase), []byte(salt), keyIterations, keySize, sha1.New)
+}
+
+// NewBlockCrypt creates the cipher named crypt. Ciphers taking shorter keys use the beginning of key.
+func NewBlockCrypt(crypt string, key []byte) (K.BlockCrypt, error) {
+	switch crypt {
+	case "null":
+		return nil, nil
+	case "none":
+		return K.NewNoneBlockCrypt(key)
+	case "aes":
+		return K.NewAESBlockCrypt(key)
+	case "aes-128":
+		return K.NewAESBlockCrypt(key[:16])
+	case "aes-192":
+		return K.NewAESBlockCrypt(key[:24])
+	case "salsa20":
+		return K.NewSalsa20BlockCrypt(key)
+	case "blowfish":
+		return K.NewBlowfishBlockCrypt(key)
+	case "twofish":
+		return K.NewTwofishBlockCrypt(key)
+	case "cast5":
+		return K.NewCast5BlockCrypt(key[:16])
+	case "3des":
+		return K.NewTripleDESBlockCrypt(key[:24])
+	case "tea":
+		return K.NewTEABlockCrypt(key[:16])
+	case "xtea":
+		return K.NewXTEABlockCrypt(key[:16])
+	case "sm4":
+		return K.NewSM4BlockCrypt(key[:16])
+	case "xor":
+		return K.NewSimpleXORBlockCrypt(key)
+	}
+	return nil, muxedsocket.ErrInvalidParameters{Problems: []muxedsocket.ParameterProblem{{Key: ParamCrypt, Reason: "unknown cipher " + crypt}}}
+}
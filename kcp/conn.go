@@ -0,0 +1,88 @@
+package kcp
+
+import (
+	"context"
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/types"
+	K "github.com/xtaci/kcp-go/v5"
+	"net"
+	"sync"
+	"time"
+)
+
+var _ types.StreamConn = &Conn{}
+
+type Conn struct {
+	session *K.UDPSession
+	// packetConn of a dialed session is closed along with it, as kcp-go leaves it open. It is nil for accepted
+	// sessions, which share packet connection of the listener.
+	packetConn types.PacketConn
+	// dialFunc dials a new session, for redialing. It is nil for accepted sessions.
+	dialFunc  types.StreamDialContextFunc
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func wrapConn(session *K.UDPSession, packetConn types.PacketConn, dialFunc types.StreamDialContextFunc) *Conn {
+	return &Conn{session: session, packetConn: packetConn, dialFunc: dialFunc, closed: make(chan struct{})}
+}
+
+func (c *Conn) CloseChan() <-chan struct{} {
+	return c.closed
+}
+
+func (c *Conn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		err = c.session.Close()
+		if c.packetConn != nil {
+			_ = c.packetConn.Close()
+		}
+	})
+	return err
+}
+
+func (c *Conn) Read(b []byte) (n int, err error) {
+	return c.session.Read(b)
+}
+
+func (c *Conn) Write(b []byte) (n int, err error) {
+	return c.session.Write(b)
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	return c.session.LocalAddr()
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.session.RemoteAddr()
+}
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.session.SetDeadline(t)
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.session.SetReadDeadline(t)
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.session.SetWriteDeadline(t)
+}
+
+// Session returns the underlying KCP session, for tuning it further.
+func (c *Conn) Session() *K.UDPSession {
+	return c.session
+}
+
+func (c *Conn) CanRedial() bool {
+	return c.dialFunc != nil
+}
+
+func (c *Conn) Redial() (types.Socket, error) {
+	if c.dialFunc == nil {
+		return nil, muxedsocket.ErrRedialNotSupported
+	}
+	return c.dialFunc(context.Background())
+}
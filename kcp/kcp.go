@@ -0,0 +1,107 @@
+// Package kcp puts reliable streams on top of packet connections, using KCP from kcp-go. Packets may be protected by
+// forward error correction and encrypted by a block cipher, whose key is derived from a passphrase.
+//
+// With compat=kcptun, defaults and wire format follow kcptun: its default key and cipher, "fast" mode and snappy
+// compression of sessions (compress=false stands for its -nocomp). Together with the same profile of smux, or the
+// "kcptun" alias standing for both, a "kcptun+udp" client talks to a stock kcptun server, and the other way around.
+package kcp
+
+import (
+	"context"
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	K "github.com/xtaci/kcp-go/v5"
+)
+
+type Implementation struct {
+	// nothing.
+}
+
+var _ types.StreamAdapterImplementation = &Implementation{}
+var _ types.StreamAdapterContextImplementation = &Implementation{}
+var _ types.HasParametersHint = &Implementation{}
+
+func (i *Implementation) Server(conn types.PacketConnFunc, parameters utils.Parameters) (types.StreamListenFunc, error) {
+	listenFunc, err := i.ServerContext(conn.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return listenFunc.WithoutContext(), nil
+}
+
+func (i *Implementation) Client(conn types.PacketConnFunc, parameters utils.Parameters) (types.StreamDialFunc, error) {
+	dialFunc, err := i.ClientContext(conn.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return dialFunc.WithoutContext(), nil
+}
+
+func (i *Implementation) ServerContext(conn types.PacketConnContextFunc, parameters utils.Parameters) (types.StreamListenContextFunc, error) {
+	config, err := ConfigFromParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) (types.StreamListener, error) {
+		packetConn, err := conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return Listen(packetConn, config)
+	}, nil
+}
+
+func (i *Implementation) ClientContext(conn types.PacketConnContextFunc, parameters utils.Parameters) (types.StreamDialContextFunc, error) {
+	config, err := ConfigFromParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+	var dialFunc types.StreamDialContextFunc
+	dialFunc = func(ctx context.Context) (types.StreamConn, error) {
+		packetConn, err := conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return Dial(packetConn, config, dialFunc)
+	}
+	return dialFunc, nil
+}
+
+// Dial starts a session with the remote address of packetConn, which it takes over. dialFunc is used for redialing,
+// and may be nil.
+func Dial(packetConn types.PacketConn, config *Config, dialFunc types.StreamDialContextFunc) (types.StreamConn, error) {
+	remoteAddr := packetConn.RemoteAddr()
+	if remoteAddr == nil {
+		_ = packetConn.Close()
+		return nil, muxedsocket.ErrNoRemoteAddr
+	}
+	session, err := K.NewConn2(remoteAddr, config.Block, config.DataShards, config.ParityShards, packetConn)
+	if err != nil {
+		_ = packetConn.Close()
+		return nil, err
+	}
+	config.apply(session)
+	return config.wrap(wrapConn(session, packetConn, dialFunc)), nil
+}
+
+// Listen accepts sessions coming to packetConn, which it takes over.
+func Listen(packetConn types.PacketConn, config *Config) (types.StreamListener, error) {
+	listener, err := K.ServeConn(config.Block, config.DataShards, config.ParityShards, packetConn)
+	if err != nil {
+		_ = packetConn.Close()
+		return nil, err
+	}
+	if config.DSCP > 0 {
+		_ = listener.SetDSCP(config.DSCP)
+	}
+	return wrapListener(listener, packetConn, config), nil
+}
+
+func (i *Implementation) ClientParametersHint() []utils.ParameterHint {
+	return parametersHint
+}
+
+func (i *Implementation) ServerParametersHint() []utils.ParameterHint {
+	return parametersHint
+}
@@ -0,0 +1,59 @@
+package kcp
+
+import (
+	"github.com/hadi77ir/muxedsocket/types"
+	K "github.com/xtaci/kcp-go/v5"
+	"net"
+	"sync"
+)
+
+var _ types.StreamListener = &Listener{}
+
+type Listener struct {
+	listener *K.Listener
+	// packetConn is closed along with listener, as kcp-go leaves it open.
+	packetConn types.PacketConn
+	config     *Config
+	closed     chan struct{}
+	closeOnce  sync.Once
+}
+
+func wrapListener(listener *K.Listener, packetConn types.PacketConn, config *Config) *Listener {
+	return &Listener{listener: listener, packetConn: packetConn, config: config, closed: make(chan struct{})}
+}
+
+func (l *Listener) AcceptConn() (types.StreamConn, error) {
+	session, err := l.listener.AcceptKCP()
+	if err != nil {
+		select {
+		case <-l.closed:
+			return nil, net.ErrClosed
+		default:
+		}
+		return nil, err
+	}
+	l.config.apply(session)
+	return l.config.wrap(wrapConn(session, nil, nil)), nil
+}
+
+func (l *Listener) Accept() (types.Socket, error) {
+	return l.AcceptConn()
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+func (l *Listener) CloseChan() <-chan struct{} {
+	return l.closed
+}
+
+func (l *Listener) Close() error {
+	err := net.ErrClosed
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		err = l.listener.Close()
+		_ = l.packetConn.Close()
+	})
+	return err
+}
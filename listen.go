@@ -1,6 +1,7 @@
 package muxedsocket
 
 import (
+	"context"
 	"github.com/hadi77ir/muxedsocket/chaining"
 	"github.com/hadi77ir/muxedsocket/types"
 	"github.com/hadi77ir/muxedsocket/utils"
@@ -10,9 +11,10 @@ import (
 
 type ListenFuncCreator[TFunc any] func(addr string, parameters utils.Parameters) (TFunc, error)
 type MuxListenFuncCreator ListenFuncCreator[types.MuxListenFunc]
+type MuxListenContextFuncCreator ListenFuncCreator[types.MuxListenContextFunc]
 
 func ConstructListenFuncCreatorWithRegistry(creators *Creators, scheme string) (MuxListenFuncCreator, error) {
-	if solution, found := creators.AddrSolutions().Get(scheme); found && solution != nil {
+	if solution, found := getAddrSolution(creators, scheme); found {
 		return solution.Server, nil
 	}
 	schemeParts := GetSchemeParts(scheme)
@@ -27,10 +29,38 @@ func ConstructListenFuncCreator(scheme string) (MuxListenFuncCreator, error) {
 	return ConstructListenFuncCreatorWithRegistry(creators, scheme)
 }
 
+func ConstructContextListenFuncCreatorWithRegistry(creators *Creators, scheme string) (MuxListenContextFuncCreator, error) {
+	if solution, found := getAddrSolution(creators, scheme); found {
+		if contextSolution, ok := solution.(types.AddrSolutionContextImplementation); ok {
+			return contextSolution.ServerContext, nil
+		}
+		return func(addr string, parameters utils.Parameters) (types.MuxListenContextFunc, error) {
+			listenFunc, err := solution.Server(addr, parameters)
+			if err != nil {
+				return nil, err
+			}
+			return listenFunc.WithContext(), nil
+		}, nil
+	}
+	schemeParts := GetSchemeParts(scheme)
+	chainer, err := chaining.CreateMuxLayersChainer(creators, GetDefaults(creators), schemeParts)
+	if err != nil {
+		return nil, err
+	}
+	return chainer.ConstructListenContextFunc, nil
+}
+
+func ConstructContextListenFuncCreator(scheme string) (MuxListenContextFuncCreator, error) {
+	return ConstructContextListenFuncCreatorWithRegistry(creators, scheme)
+}
+
 func CreateListenFuncWithRegistry(creators *Creators, addr *url.URL) (types.MuxListenFunc, error) {
 	if addr == nil {
 		return nil, net.InvalidAddrError("address was nil")
 	}
+	if err := validateIfStrict(creators, addr, true); err != nil {
+		return nil, err
+	}
 	creatorFunc, err := ConstructListenFuncCreatorWithRegistry(creators, addr.Scheme)
 	if err != nil {
 		return nil, err
@@ -42,6 +72,26 @@ func CreateListenFunc(addr *url.URL) (types.MuxListenFunc, error) {
 	return CreateListenFuncWithRegistry(creators, addr)
 }
 
+// CreateContextListenFuncWithRegistry is like CreateListenFuncWithRegistry, but the returned function takes a context
+// that bounds setting up the whole chain of layers.
+func CreateContextListenFuncWithRegistry(creators *Creators, addr *url.URL) (types.MuxListenContextFunc, error) {
+	if addr == nil {
+		return nil, net.InvalidAddrError("address was nil")
+	}
+	if err := validateIfStrict(creators, addr, true); err != nil {
+		return nil, err
+	}
+	creatorFunc, err := ConstructContextListenFuncCreatorWithRegistry(creators, addr.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	return creatorFunc(addr.Host, utils.ParametersFromURL(addr.Query()))
+}
+
+func CreateContextListenFunc(addr *url.URL) (types.MuxListenContextFunc, error) {
+	return CreateContextListenFuncWithRegistry(creators, addr)
+}
+
 func ListenURIWithRegistry(creators *Creators, uri string) (types.MuxedListener, error) {
 	parsed, err := url.Parse(uri)
 	if err != nil {
@@ -57,3 +107,21 @@ func ListenURIWithRegistry(creators *Creators, uri string) (types.MuxedListener,
 func ListenURI(uri string) (types.MuxedListener, error) {
 	return ListenURIWithRegistry(creators, uri)
 }
+
+// ListenURIWithRegistryContext starts listening on the given URI. ctx only bounds setting up the listener; cancelling
+// it afterwards doesn't close the listener.
+func ListenURIWithRegistryContext(ctx context.Context, creators *Creators, uri string) (types.MuxedListener, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := CreateContextListenFuncWithRegistry(creators, parsed)
+	if err != nil {
+		return nil, err
+	}
+	return listener(ctx)
+}
+
+func ListenURIContext(ctx context.Context, uri string) (types.MuxedListener, error) {
+	return ListenURIWithRegistryContext(ctx, creators, uri)
+}
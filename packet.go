@@ -0,0 +1,68 @@
+package muxedsocket
+
+import (
+	"context"
+	"github.com/hadi77ir/muxedsocket/chaining"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"net/url"
+)
+
+// DialPacketURIWithRegistryContext dials the given URI, like DialURIWithRegistryContext, but stops at the packet
+// layer instead of putting a muxer on top. Scheme has to end up with a packet connection, like "udp" or
+// "spos+tls+tcp".
+func DialPacketURIWithRegistryContext(ctx context.Context, creators *Creators, uri string) (types.PacketConn, error) {
+	parsed, chainer, err := packetChainer(creators, uri, false)
+	if err != nil {
+		return nil, err
+	}
+	dialFunc, err := chainer.ConstructDialContextFunc(parsed.Host, utils.ParametersFromURL(parsed.Query()))
+	if err != nil {
+		return nil, err
+	}
+	return dialFunc(ctx)
+}
+
+func DialPacketURIContext(ctx context.Context, uri string) (types.PacketConn, error) {
+	return DialPacketURIWithRegistryContext(ctx, creators, uri)
+}
+
+func DialPacketURI(uri string) (types.PacketConn, error) {
+	return DialPacketURIWithRegistryContext(context.Background(), creators, uri)
+}
+
+// ListenPacketURIWithRegistryContext is the server side counterpart of DialPacketURIWithRegistryContext.
+func ListenPacketURIWithRegistryContext(ctx context.Context, creators *Creators, uri string) (types.PacketConn, error) {
+	parsed, chainer, err := packetChainer(creators, uri, true)
+	if err != nil {
+		return nil, err
+	}
+	listenFunc, err := chainer.ConstructListenContextFunc(parsed.Host, utils.ParametersFromURL(parsed.Query()))
+	if err != nil {
+		return nil, err
+	}
+	return listenFunc(ctx)
+}
+
+func ListenPacketURIContext(ctx context.Context, uri string) (types.PacketConn, error) {
+	return ListenPacketURIWithRegistryContext(ctx, creators, uri)
+}
+
+func ListenPacketURI(uri string) (types.PacketConn, error) {
+	return ListenPacketURIWithRegistryContext(context.Background(), creators, uri)
+}
+
+func packetChainer(creators *Creators, uri string, server bool) (*url.URL, chaining.PacketLayersChainer, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = validateIfStrict(creators, parsed, server); err != nil {
+		return nil, nil, err
+	}
+	chainer, err := chaining.CreatePacketLayersChainer(creators, GetDefaults(creators), GetSchemeParts(parsed.Scheme))
+	if err != nil {
+		return nil, nil, err
+	}
+	return parsed, chainer, nil
+}
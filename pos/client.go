@@ -0,0 +1,200 @@
+package pos
+
+import (
+	"context"
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+type clientOptions struct {
+	// handshake is written first on every stream. Plain pos has none.
+	handshake bool
+	// streams is the number of streams packets are striped over.
+	streams int
+	// redialDelay is how long to wait before replacing a broken stream. Negative means connection is closed instead.
+	redialDelay time.Duration
+}
+
+// client sends packets over one or more streams, all leading to the same peer.
+type client struct {
+	*utils.PacketQueue
+	id         SessionAddr
+	dialFunc   types.StreamDialContextFunc
+	options    clientOptions
+	localAddr  net.Addr
+	remoteAddr net.Addr
+
+	mutex sync.Mutex
+	links []*link
+	next  int
+}
+
+func dialClient(ctx context.Context, dialFunc types.StreamDialContextFunc, options clientOptions) (*client, error) {
+	id, err := newSessionAddr()
+	if err != nil {
+		return nil, err
+	}
+	c := &client{
+		PacketQueue: utils.NewPacketQueue(queueSize),
+		id:          id,
+		dialFunc:    dialFunc,
+		options:     options,
+		links:       make([]*link, options.streams),
+	}
+	for i := range c.links {
+		l, err := c.dialLink(ctx)
+		if err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+		c.links[i] = l
+	}
+	c.localAddr, c.remoteAddr = c.links[0].conn.LocalAddr(), c.links[0].conn.RemoteAddr()
+	if options.handshake {
+		c.localAddr = id
+	}
+	for i, l := range c.links {
+		go c.maintain(i, l)
+	}
+	return c, nil
+}
+
+func (c *client) dialLink(ctx context.Context) (*link, error) {
+	conn, err := c.dialFunc(ctx)
+	if err != nil {
+		return nil, err
+	}
+	l := &link{conn: conn}
+	if c.options.handshake {
+		if _, err = conn.Write(sessionHandshake(c.id)); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// maintain reads packets from the stream in given slot, and replaces the stream when it breaks.
+func (c *client) maintain(slot int, l *link) {
+	for {
+		c.readLink(l)
+		c.setLink(slot, nil)
+		_ = l.conn.Close()
+		if c.options.redialDelay < 0 {
+			_ = c.Close()
+			return
+		}
+		for l = nil; l == nil; {
+			select {
+			case <-c.CloseChan():
+				return
+			case <-time.After(c.options.redialDelay):
+			}
+			l, _ = c.dialLink(context.Background())
+		}
+		if !c.setLink(slot, l) {
+			_ = l.conn.Close()
+			return
+		}
+	}
+}
+
+func (c *client) readLink(l *link) {
+	for {
+		payload, err := readFrame(l.conn)
+		if err != nil {
+			return
+		}
+		// a reader that falls behind loses packets, instead of stalling the stream.
+		if !c.TryDeliver(payload, c.remoteAddr) {
+			return
+		}
+	}
+}
+
+// setLink puts l in given slot, unless connection is closed.
+func (c *client) setLink(slot int, l *link) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.IsClosed() {
+		return false
+	}
+	c.links[slot] = l
+	return true
+}
+
+func (c *client) pickLinks() []*link {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	picked := make([]*link, 0, len(c.links))
+	for i := range c.links {
+		if l := c.links[(c.next+i)%len(c.links)]; l != nil {
+			picked = append(picked, l)
+		}
+	}
+	c.next = (c.next + 1) % len(c.links)
+	return picked
+}
+
+// WriteTo sends p to the peer, whatever addr is. While all streams are being replaced, packets are dropped, like on
+// any other lossy path.
+func (c *client) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if c.IsClosed() {
+		return 0, net.ErrClosed
+	}
+	if len(p) > MaxPacketSize {
+		return 0, muxedsocket.ErrPacketTooLarge
+	}
+	writeDeadline := c.WriteDeadline()
+	for _, l := range c.pickLinks() {
+		err := l.write(p, writeDeadline)
+		if err == nil {
+			return len(p), nil
+		}
+		if os.IsTimeout(err) {
+			return 0, err
+		}
+		// reader of this link notices and replaces it.
+		_ = l.conn.Close()
+	}
+	return len(p), nil
+}
+
+func (c *client) Close() error {
+	c.mutex.Lock()
+	first := c.Shutdown()
+	links := c.links
+	c.mutex.Unlock()
+	if first {
+		for _, l := range links {
+			if l != nil {
+				_ = l.conn.Close()
+			}
+		}
+	}
+	return nil
+}
+
+func (c *client) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+func (c *client) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+func (c *client) CanRedial() bool {
+	return true
+}
+
+// Redial starts a new connection, with a session of its own.
+func (c *client) Redial() (types.Socket, error) {
+	return dialClient(context.Background(), c.dialFunc, c.options)
+}
+
+var _ types.PacketConn = &client{}
@@ -0,0 +1,134 @@
+package pos
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/types"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// MaxPacketSize is the largest packet that fits in a frame, as length is encoded in two bytes.
+	MaxPacketSize    = 0xffff
+	handshakeTimeout = 10 * time.Second
+	queueSize        = 64
+)
+
+var ErrBadHandshake = errors.New("bad session handshake")
+
+// sessionMagic starts every stream of a session, followed by session id.
+var sessionMagic = []byte("SPoS\x01")
+
+// SessionAddr is the virtual address of a session. Server side sees packets of a session coming from it, no matter
+// which of the streams of the session carried them.
+type SessionAddr [16]byte
+
+func (a SessionAddr) Network() string {
+	return "spos"
+}
+
+func (a SessionAddr) String() string {
+	return hex.EncodeToString(a[:])
+}
+
+var _ net.Addr = SessionAddr{}
+
+// StreamAddr is the address server side of plain pos sees packets of a stream coming from. Streams from the same remote
+// address, or from transports that don't tell addresses apart, still get addresses of their own.
+type StreamAddr struct {
+	ID     uint64
+	Remote net.Addr
+}
+
+func (a *StreamAddr) Network() string {
+	return "pos"
+}
+
+func (a *StreamAddr) String() string {
+	if a.Remote == nil {
+		return strconv.FormatUint(a.ID, 10)
+	}
+	return strconv.FormatUint(a.ID, 10) + "@" + a.Remote.String()
+}
+
+var _ net.Addr = &StreamAddr{}
+
+var lastStreamID uint64
+
+func newSessionAddr() (SessionAddr, error) {
+	var addr SessionAddr
+	_, err := rand.Read(addr[:])
+	return addr, err
+}
+
+func writeFrame(w io.Writer, p []byte) error {
+	if len(p) > MaxPacketSize {
+		return muxedsocket.ErrPacketTooLarge
+	}
+	// header and payload go in a single write, so that frames don't get split by obfuscators above.
+	frame := make([]byte, 2+len(p))
+	binary.BigEndian.PutUint16(frame, uint16(len(p)))
+	copy(frame[2:], p)
+	_, err := w.Write(frame)
+	return err
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	p := make([]byte, binary.BigEndian.Uint16(header[:]))
+	if _, err := io.ReadFull(r, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func sessionHandshake(id SessionAddr) []byte {
+	return append(append([]byte{}, sessionMagic...), id[:]...)
+}
+
+// readSessionHandshake returns the key and address of the session that conn belongs to.
+func readSessionHandshake(conn types.StreamConn) (string, net.Addr, error) {
+	_ = conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	handshake := make([]byte, len(sessionMagic)+len(SessionAddr{}))
+	if _, err := io.ReadFull(conn, handshake); err != nil {
+		return "", nil, err
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	if !bytes.Equal(handshake[:len(sessionMagic)], sessionMagic) {
+		return "", nil, ErrBadHandshake
+	}
+	var addr SessionAddr
+	copy(addr[:], handshake[len(sessionMagic):])
+	return addr.String(), addr, nil
+}
+
+// readStreamAddr makes every stream a peer of its own, as plain pos does.
+func readStreamAddr(conn types.StreamConn) (string, net.Addr, error) {
+	addr := &StreamAddr{ID: atomic.AddUint64(&lastStreamID, 1), Remote: conn.RemoteAddr()}
+	return addr.String(), addr, nil
+}
+
+// link is a stream carrying frames. Writes are serialized so that frames of concurrent writers don't interleave.
+type link struct {
+	conn       types.StreamConn
+	writeMutex sync.Mutex
+}
+
+func (l *link) write(p []byte, deadline time.Time) error {
+	l.writeMutex.Lock()
+	defer l.writeMutex.Unlock()
+	_ = l.conn.SetWriteDeadline(deadline)
+	return writeFrame(l.conn, p)
+}
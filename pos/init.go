@@ -0,0 +1,9 @@
+package pos
+
+import "github.com/hadi77ir/muxedsocket"
+
+func init() {
+	muxedsocket.GlobalCreators().PacketAdapters().Register("pos", NewPoSImplementation())
+	muxedsocket.GlobalCreators().PacketAdapters().Register("spos", NewSPoSImplementation())
+	muxedsocket.GlobalCreators().PacketAdapters().Register("pspos", NewPSPoSImplementation())
+}
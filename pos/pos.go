@@ -0,0 +1,119 @@
+// Package pos carries packets over streams, for networks where only stream-oriented connections get through. Each
+// packet is sent as a frame, prefixed with its length in two bytes.
+//
+// Three flavors are provided:
+//   - "pos": a single stream per peer. Connection ends with the stream.
+//   - "spos": a session that survives its stream. Streams start with a session id, so a redialed stream resumes the
+//     same session, and server sees the session under a virtual address (SessionAddr).
+//   - "pspos": like spos, but packets are striped over several parallel streams of the session.
+package pos
+
+import (
+	"context"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"time"
+)
+
+const (
+	ParamStreams        = "streams"
+	ParamRedialDelay    = "redialdelay"
+	ParamSessionTimeout = "sessiontimeout"
+
+	DefaultStreams        = 4
+	DefaultRedialDelay    = time.Second
+	DefaultSessionTimeout = 2 * time.Minute
+)
+
+type Implementation struct {
+	sessions bool
+	parallel bool
+}
+
+// NewPoSImplementation creates the plain flavor, "pos".
+func NewPoSImplementation() *Implementation {
+	return &Implementation{}
+}
+
+// NewSPoSImplementation creates the session-based flavor, "spos".
+func NewSPoSImplementation() *Implementation {
+	return &Implementation{sessions: true}
+}
+
+// NewPSPoSImplementation creates the parallel session-based flavor, "pspos".
+func NewPSPoSImplementation() *Implementation {
+	return &Implementation{sessions: true, parallel: true}
+}
+
+var _ types.PacketAdapterImplementation = &Implementation{}
+var _ types.PacketAdapterContextImplementation = &Implementation{}
+var _ types.HasParametersHint = &Implementation{}
+
+// SupportsParallel is true for pspos, which spreads packets over several streams.
+func (i *Implementation) SupportsParallel() bool {
+	return i.parallel
+}
+
+func (i *Implementation) Server(listener types.StreamListenFunc, parameters utils.Parameters) (types.PacketConnFunc, error) {
+	listenFunc, err := i.ServerContext(listener.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return listenFunc.WithoutContext(), nil
+}
+
+func (i *Implementation) Client(dialFunc types.StreamDialFunc, parameters utils.Parameters) (types.PacketConnFunc, error) {
+	connFunc, err := i.ClientContext(dialFunc.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return connFunc.WithoutContext(), nil
+}
+
+func (i *Implementation) ServerContext(listener types.StreamListenContextFunc, parameters utils.Parameters) (types.PacketConnContextFunc, error) {
+	identify, linger := identifyFunc(readStreamAddr), time.Duration(0)
+	if i.sessions {
+		identify = readSessionHandshake
+		linger = utils.DurationFromParameters(parameters, ParamSessionTimeout, DefaultSessionTimeout)
+	}
+	return func(ctx context.Context) (types.PacketConn, error) {
+		return listenServer(ctx, listener, identify, linger)
+	}, nil
+}
+
+func (i *Implementation) ClientContext(dialFunc types.StreamDialContextFunc, parameters utils.Parameters) (types.PacketConnContextFunc, error) {
+	options := clientOptions{streams: 1, redialDelay: -1}
+	if i.sessions {
+		options.handshake = true
+		options.redialDelay = utils.DurationFromParameters(parameters, ParamRedialDelay, DefaultRedialDelay)
+	}
+	if i.parallel {
+		options.streams = utils.IntegerFromParameters(parameters, ParamStreams, DefaultStreams)
+		if options.streams < 1 {
+			options.streams = 1
+		}
+	}
+	return func(ctx context.Context) (types.PacketConn, error) {
+		return dialClient(ctx, dialFunc, options)
+	}, nil
+}
+
+func (i *Implementation) ClientParametersHint() []utils.ParameterHint {
+	var hints []utils.ParameterHint
+	if i.sessions {
+		hints = append(hints, utils.ParameterHint{Key: ParamRedialDelay, Description: "wait before replacing a broken stream", Type: utils.ParameterTypeDuration, DefaultValue: DefaultRedialDelay.String()})
+	}
+	if i.parallel {
+		hints = append(hints, utils.ParameterHint{Key: ParamStreams, Description: "number of parallel streams", Type: utils.ParameterTypeInt, DefaultValue: "4"})
+	}
+	return hints
+}
+
+func (i *Implementation) ServerParametersHint() []utils.ParameterHint {
+	if !i.sessions {
+		return nil
+	}
+	return []utils.ParameterHint{
+		{Key: ParamSessionTimeout, Description: "how long a session without streams is kept", Type: utils.ParameterTypeDuration, DefaultValue: DefaultSessionTimeout.String()},
+	}
+}
@@ -0,0 +1,339 @@
+package pos
+
+import (
+	"context"
+	"github.com/hadi77ir/muxedsocket/basics/stream"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingConn counts bytes read from it.
+type countingConn struct {
+	net.Conn
+	read int64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.read, int64(n))
+	return n, err
+}
+
+// pipeListener hands out server ends of net.Pipe connections, all of which report the same "pipe" address.
+type pipeListener struct {
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mutex    sync.Mutex
+	accepted []*countingConn
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), closed: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		counting := &countingConn{Conn: conn}
+		l.mutex.Lock()
+		l.accepted = append(l.accepted, counting)
+		l.mutex.Unlock()
+		return counting, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// acceptedConns returns server ends accepted so far.
+func (l *pipeListener) acceptedConns() []*countingConn {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]*countingConn(nil), l.accepted...)
+}
+
+func (l *pipeListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: "pipe", Net: "pipe"}
+}
+
+// dial makes a new pipe on every call, as redialing streams needs.
+func (l *pipeListener) dial() types.StreamDialContextFunc {
+	return func(ctx context.Context) (types.StreamConn, error) {
+		client, server := net.Pipe()
+		select {
+		case l.conns <- server:
+			return stream.WrapConn(client, nil, nil), nil
+		case <-l.closed:
+			return nil, net.ErrClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func listenPipe(t *testing.T, impl *Implementation) (*pipeListener, types.PacketConn) {
+	listener := newPipeListener()
+	listenFunc, err := impl.ServerContext(stream.FromListener(listener).WithContext(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := listenFunc(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return listener, server
+}
+
+func dialPipe(t *testing.T, impl *Implementation, listener *pipeListener) types.PacketConn {
+	return dialPipeWithParameters(t, impl, listener, nil)
+}
+
+func dialPipeWithParameters(t *testing.T, impl *Implementation, listener *pipeListener, parameters utils.Parameters) types.PacketConn {
+	connFunc, err := impl.ClientContext(listener.dial(), parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := connFunc(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func echo(server types.PacketConn) {
+	buf := make([]byte, MaxPacketSize)
+	for {
+		n, addr, err := server.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		_, _ = server.WriteTo(buf[:n], addr)
+	}
+}
+
+func TestPeersWithSameRemoteAddr(t *testing.T) {
+	impl := NewPoSImplementation()
+	listener, server := listenPipe(t, impl)
+	defer server.Close()
+
+	clients := make([]types.PacketConn, 3)
+	for i := range clients {
+		clients[i] = dialPipe(t, impl, listener)
+		defer clients[i].Close()
+	}
+
+	seen := make(map[string]bool)
+	buf := make([]byte, MaxPacketSize)
+	for i, client := range clients {
+		msg := []byte{byte(i)}
+		if _, err := client.WriteTo(msg, nil); err != nil {
+			t.Fatal(err)
+		}
+		_ = server.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, addr, err := server.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 || buf[0] != byte(i) {
+			t.Fatalf("client %d: got %v", i, buf[:n])
+		}
+		if seen[addr.String()] {
+			t.Fatalf("client %d shares address %s with another one", i, addr)
+		}
+		seen[addr.String()] = true
+		if _, err := server.WriteTo([]byte{byte(i), 'r'}, addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, client := range clients {
+		_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := client.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 2 || buf[0] != byte(i) {
+			t.Fatalf("client %d got reply %v of another client", i, buf[:n])
+		}
+	}
+}
+
+func TestServerDropsWhenReaderFallsBehind(t *testing.T) {
+	impl := NewPoSImplementation()
+	listener, server := listenPipe(t, impl)
+	defer server.Close()
+	client := dialPipe(t, impl, listener)
+	defer client.Close()
+
+	// nothing reads from server, yet its streams have to keep flowing.
+	_ = client.SetWriteDeadline(time.Now().Add(2 * time.Second))
+	for i := 0; i < queueSize*4; i++ {
+		if _, err := client.WriteTo([]byte("flood"), nil); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+
+	go echo(server)
+	buf := make([]byte, MaxPacketSize)
+	for {
+		if _, err := client.WriteTo([]byte("last"), nil); err != nil {
+			t.Fatal(err)
+		}
+		_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := client.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) == "last" {
+			return
+		}
+	}
+}
+
+func TestStreamAddrWithoutRemote(t *testing.T) {
+	addr := &StreamAddr{ID: 7}
+	if addr.String() != "7" {
+		t.Fatal(addr.String())
+	}
+}
+
+func TestClientDropsWhenReaderFallsBehind(t *testing.T) {
+	impl := NewPoSImplementation()
+	listener, server := listenPipe(t, impl)
+	defer server.Close()
+	client := dialPipe(t, impl, listener)
+	defer client.Close()
+
+	if _, err := client.WriteTo([]byte("hello"), nil); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, MaxPacketSize)
+	_ = server.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, addr, err := server.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nothing reads from client.
+	_ = server.SetWriteDeadline(time.Now().Add(2 * time.Second))
+	for i := 0; i < queueSize*4; i++ {
+		if _, err := server.WriteTo([]byte("flood"), addr); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+}
+
+func TestSessionResumesOnNewStream(t *testing.T) {
+	impl := NewSPoSImplementation()
+	listener, server := listenPipe(t, impl)
+	defer server.Close()
+	client := dialPipeWithParameters(t, impl, listener, utils.Parameters{ParamRedialDelay: "20ms"})
+	defer client.Close()
+
+	buf := make([]byte, MaxPacketSize)
+	if _, err := client.WriteTo([]byte("first"), nil); err != nil {
+		t.Fatal(err)
+	}
+	_ = server.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, addr, err := server.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := addr.(SessionAddr); !ok {
+		t.Fatalf("%T is not a session address", addr)
+	}
+
+	// the stream breaks; client redials and resumes the session.
+	_ = listener.acceptedConns()[0].Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if time.Now().After(deadline) {
+			t.Fatal("session didn't resume")
+		}
+		// packets are dropped while there is no stream.
+		_, _ = client.WriteTo([]byte("second"), nil)
+		_ = server.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, resumed, err := server.ReadFrom(buf)
+		if err != nil {
+			continue
+		}
+		if string(buf[:n]) != "second" {
+			t.Fatal(string(buf[:n]))
+		}
+		if resumed.String() != addr.String() {
+			t.Fatalf("resumed as %s, was %s", resumed, addr)
+		}
+		break
+	}
+	if len(listener.acceptedConns()) != 2 {
+		t.Fatalf("%d streams accepted", len(listener.acceptedConns()))
+	}
+
+	if _, err := server.WriteTo([]byte("reply"), addr); err != nil {
+		t.Fatal(err)
+	}
+	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := client.ReadFrom(buf)
+	if err != nil || string(buf[:n]) != "reply" {
+		t.Fatal(string(buf[:n]), err)
+	}
+}
+
+func TestParallelStreamsStripePackets(t *testing.T) {
+	impl := NewPSPoSImplementation()
+	listener, server := listenPipe(t, impl)
+	defer server.Close()
+	client := dialPipeWithParameters(t, impl, listener, utils.Parameters{ParamStreams: "3"})
+	defer client.Close()
+
+	buf := make([]byte, MaxPacketSize)
+	var addr net.Addr
+	for i := 0; i < 30; i++ {
+		if _, err := client.WriteTo([]byte{byte(i)}, nil); err != nil {
+			t.Fatal(err)
+		}
+		_ = server.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, from, err := server.ReadFrom(buf)
+		if err != nil || n != 1 {
+			t.Fatal(n, err)
+		}
+		if addr != nil && from.String() != addr.String() {
+			t.Fatalf("packet %d came from %s, others from %s", i, from, addr)
+		}
+		addr = from
+	}
+
+	conns := listener.acceptedConns()
+	if len(conns) != 3 {
+		t.Fatalf("%d streams accepted", len(conns))
+	}
+	handshakeSize := int64(len(sessionHandshake(SessionAddr{})))
+	for i, conn := range conns {
+		// every stream carries a share of frames of 3 bytes each.
+		if read := atomic.LoadInt64(&conn.read); read != handshakeSize+10*3 {
+			t.Fatalf("stream %d carried %d bytes", i, read-handshakeSize)
+		}
+	}
+
+	for i := 0; i < 30; i++ {
+		if _, err := server.WriteTo([]byte{byte(i)}, addr); err != nil {
+			t.Fatal(err)
+		}
+		_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if n, _, err := client.ReadFrom(buf); err != nil || n != 1 {
+			t.Fatal(n, err)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package pos
+
+import (
+	"context"
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// identifyFunc tells which peer a freshly accepted stream belongs to.
+type identifyFunc func(conn types.StreamConn) (key string, addr net.Addr, err error)
+
+type peer struct {
+	addr      net.Addr
+	links     []*link
+	next      int
+	idleSince time.Time
+}
+
+// server accepts streams and groups them by peer. Packets read from any stream of a peer appear coming from its
+// address, and packets written to that address are striped over its streams.
+type server struct {
+	*utils.PacketQueue
+	listener types.StreamListener
+	identify identifyFunc
+	// linger is how long a peer without streams is kept around, waiting for a stream to come back.
+	linger time.Duration
+
+	mutex sync.Mutex
+	peers map[string]*peer
+}
+
+func listenServer(ctx context.Context, listenFunc types.StreamListenContextFunc, identify identifyFunc, linger time.Duration) (*server, error) {
+	listener, err := listenFunc(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s := &server{
+		PacketQueue: utils.NewPacketQueue(queueSize),
+		listener:    listener,
+		identify:    identify,
+		linger:      linger,
+		peers:       make(map[string]*peer),
+	}
+	go s.acceptLoop()
+	if linger > 0 {
+		go s.expireLoop()
+	}
+	return s, nil
+}
+
+func (s *server) acceptLoop() {
+	for {
+		conn, err := s.listener.AcceptConn()
+		if err != nil {
+			_ = s.Close()
+			return
+		}
+		go s.serve(conn)
+	}
+}
+
+func (s *server) serve(conn types.StreamConn) {
+	defer conn.Close()
+	key, addr, err := s.identify(conn)
+	if err != nil {
+		return
+	}
+	l := &link{conn: conn}
+	if !s.addLink(key, addr, l) {
+		return
+	}
+	defer s.removeLink(key, l)
+	for {
+		payload, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+		// a reader that falls behind loses packets, instead of stalling the stream.
+		if !s.TryDeliver(payload, addr) {
+			return
+		}
+	}
+}
+
+func (s *server) addLink(key string, addr net.Addr, l *link) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.IsClosed() {
+		return false
+	}
+	p, found := s.peers[key]
+	if !found {
+		p = &peer{addr: addr}
+		s.peers[key] = p
+	}
+	p.links = append(p.links, l)
+	return true
+}
+
+func (s *server) removeLink(key string, l *link) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	p, found := s.peers[key]
+	if !found {
+		return
+	}
+	for i, existing := range p.links {
+		if existing == l {
+			p.links = append(p.links[:i], p.links[i+1:]...)
+			break
+		}
+	}
+	if len(p.links) == 0 {
+		if s.linger <= 0 {
+			delete(s.peers, key)
+			return
+		}
+		p.idleSince = time.Now()
+	}
+}
+
+func (s *server) expireLoop() {
+	ticker := time.NewTicker(s.linger / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.CloseChan():
+			return
+		case now := <-ticker.C:
+			s.mutex.Lock()
+			for key, p := range s.peers {
+				if len(p.links) == 0 && now.Sub(p.idleSince) > s.linger {
+					delete(s.peers, key)
+				}
+			}
+			s.mutex.Unlock()
+		}
+	}
+}
+
+func (s *server) pickLinks(addr net.Addr) ([]*link, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	p, found := s.peers[addr.String()]
+	if !found {
+		return nil, false
+	}
+	picked := make([]*link, 0, len(p.links))
+	for i := range p.links {
+		picked = append(picked, p.links[(p.next+i)%len(p.links)])
+	}
+	p.next++
+	return picked, true
+}
+
+// WriteTo sends p to the peer at addr, which has to be an address that packets have been received from. Packets to a
+// peer whose streams are all gone are dropped, as it may come back.
+func (s *server) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if s.IsClosed() {
+		return 0, net.ErrClosed
+	}
+	if len(p) > MaxPacketSize {
+		return 0, muxedsocket.ErrPacketTooLarge
+	}
+	if addr == nil {
+		return 0, muxedsocket.ErrUnknownPeer
+	}
+	links, found := s.pickLinks(addr)
+	if !found {
+		return 0, muxedsocket.ErrUnknownPeer
+	}
+	writeDeadline := s.WriteDeadline()
+	for _, l := range links {
+		err := l.write(p, writeDeadline)
+		if err == nil {
+			return len(p), nil
+		}
+		if os.IsTimeout(err) {
+			return 0, err
+		}
+		_ = l.conn.Close()
+	}
+	return len(p), nil
+}
+
+func (s *server) Close() error {
+	s.mutex.Lock()
+	if !s.Shutdown() {
+		s.mutex.Unlock()
+		return nil
+	}
+	var links []*link
+	for _, p := range s.peers {
+		links = append(links, p.links...)
+	}
+	s.mutex.Unlock()
+	err := s.listener.Close()
+	for _, l := range links {
+		_ = l.conn.Close()
+	}
+	return err
+}
+
+func (s *server) LocalAddr() net.Addr {
+	return s.listener.Addr()
+}
+
+func (s *server) RemoteAddr() net.Addr {
+	return nil
+}
+
+func (s *server) CanRedial() bool {
+	return false
+}
+
+func (s *server) Redial() (types.Socket, error) {
+	return nil, muxedsocket.ErrRedialNotSupported
+}
+
+var _ types.PacketConn = &server{}
@@ -1,20 +1,83 @@
 package quic
 
 import (
+	"crypto/tls"
 	"github.com/hadi77ir/muxedsocket"
+	T "github.com/hadi77ir/muxedsocket/tls"
+	"github.com/hadi77ir/muxedsocket/utils"
 	Q "github.com/lucas-clemente/quic-go"
+	"time"
 )
 
-// getConfig creates a new instance of Config, with prefilled values.
-func getConfig(params muxedsocket.CommonParams) *Q.Config {
+const (
+	ParamMaxStreams      = "maxstreams"
+	ParamIdleTimeout     = "idletimeout"
+	ParamStreamWindow    = "streamwindow"
+	ParamMaxStreamWindow = "maxstreamwindow"
+	ParamConnWindow      = "connwindow"
+	ParamMaxConnWindow   = "maxconnwindow"
+	ParamZeroRTT         = "0rtt"
+
+	// the default 100 is a bit low, but 1000 seems a good choice
+	DefaultMaxStreams      = 1000
+	DefaultIdleTimeout     = 30 * time.Second
+	DefaultStreamWindow    = 512 * 1024
+	DefaultMaxStreamWindow = 6 * 1024 * 1024
+	DefaultConnWindow      = 768 * 1024
+	DefaultMaxConnWindow   = 15 * 1024 * 1024
+	// DefaultALPN is used when no ALPN protocol is given, as QUIC requires one.
+	DefaultALPN = "muxedsocket"
+)
+
+var parametersHint = []utils.ParameterHint{
+	{Key: ParamMaxStreams, Description: "streams peer may have open at once", Type: utils.ParameterTypeInt, DefaultValue: "1000"},
+	{Key: ParamIdleTimeout, Description: "close connection after being idle this long", Type: utils.ParameterTypeDuration, DefaultValue: DefaultIdleTimeout.String()},
+	{Key: ParamStreamWindow, Description: "initial flow control window of a stream", Type: utils.ParameterTypeInt, DefaultValue: "524288"},
+	{Key: ParamMaxStreamWindow, Description: "largest flow control window of a stream", Type: utils.ParameterTypeInt, DefaultValue: "6291456"},
+	{Key: ParamConnWindow, Description: "initial flow control window of connection", Type: utils.ParameterTypeInt, DefaultValue: "786432"},
+	{Key: ParamMaxConnWindow, Description: "largest flow control window of connection", Type: utils.ParameterTypeInt, DefaultValue: "15728640"},
+	{Key: ParamZeroRTT, Description: "send and accept data before handshake completes (0-RTT)", Type: utils.ParameterTypeBool, DefaultValue: "false"},
+}
+
+// getConfig creates a new instance of Config from parameters.
+func getConfig(parameters utils.Parameters) *Q.Config {
+	keepAlive, _ := muxedsocket.KeepAliveFromParameters(parameters)
 	return &Q.Config{
 		// datagrams are supported
 		EnableDatagrams: true,
 		// only allow Version 2
-		Versions: []Q.VersionNumber{Q.Version2},
-		// the default 100 is a bit low, but 1000 seems a good choice
-		MaxIncomingStreams: 1000,
-		MaxIdleTimeout:     params.MaxIdleTimeout,
-		KeepAlivePeriod:    params.KeepalivePeriod,
+		Versions:                       []Q.VersionNumber{Q.Version2},
+		MaxIncomingStreams:             int64(utils.IntegerFromParameters(parameters, ParamMaxStreams, DefaultMaxStreams)),
+		MaxIdleTimeout:                 utils.DurationFromParameters(parameters, ParamIdleTimeout, DefaultIdleTimeout),
+		KeepAlivePeriod:                keepAlive,
+		InitialStreamReceiveWindow:     uint64(utils.IntegerFromParameters(parameters, ParamStreamWindow, DefaultStreamWindow)),
+		MaxStreamReceiveWindow:         uint64(utils.IntegerFromParameters(parameters, ParamMaxStreamWindow, DefaultMaxStreamWindow)),
+		InitialConnectionReceiveWindow: uint64(utils.IntegerFromParameters(parameters, ParamConnWindow, DefaultConnWindow)),
+		MaxConnectionReceiveWindow:     uint64(utils.IntegerFromParameters(parameters, ParamMaxConnWindow, DefaultMaxConnWindow)),
+	}
+}
+
+// getTLSConfig builds TLS config the same way tls layer does, so that the same parameters apply.
+func getTLSConfig(parameters utils.Parameters, isClient bool, zeroRTT bool) (*tls.Config, error) {
+	params, err := T.ParseTLS(parameters, isClient)
+	if err != nil {
+		return nil, err
+	}
+	config := T.StandardConfig(params)
+	if config == nil {
+		config = &tls.Config{}
+	}
+	return completeTLSConfig(config, isClient, zeroRTT), nil
+}
+
+// completeTLSConfig fills in what QUIC needs and config may lack.
+func completeTLSConfig(config *tls.Config, isClient bool, zeroRTT bool) *tls.Config {
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{DefaultALPN}
+	}
+	if isClient && zeroRTT && config.ClientSessionCache == nil {
+		// 0-RTT resumes a session, which has to be remembered.
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(0)
 	}
+	return config
 }
@@ -2,7 +2,6 @@ package quic
 
 import (
 	"context"
-	"crypto/tls"
 	"github.com/hadi77ir/muxedsocket"
 	"github.com/hadi77ir/muxedsocket/types"
 	Q "github.com/lucas-clemente/quic-go"
@@ -16,9 +15,19 @@ const GracefulCloseString string = "graceful close"
 
 type Conn struct {
 	conn Q.Connection
+	// dialFunc dials a new connection, for redialing. It is nil for accepted connections.
+	dialFunc types.MuxDialContextFunc
 }
 
+// SupportsDatagrams reports whether peer accepts datagrams. For 0-RTT connections, it waits for handshake to complete.
 func (c *Conn) SupportsDatagrams() (bool, error) {
+	if early, ok := c.conn.(Q.EarlyConnection); ok {
+		select {
+		case <-early.HandshakeComplete().Done():
+		case <-c.conn.Context().Done():
+			return false, net.ErrClosed
+		}
+	}
 	state := c.conn.ConnectionState()
 	return state.SupportsDatagrams, nil
 }
@@ -27,15 +36,6 @@ func (c *Conn) CloseChan() <-chan struct{} {
 	return c.conn.Context().Done()
 }
 
-// Dial dials the target server and establishes a connection.
-func Dial(pConn net.PacketConn, tlsConfig *tls.Config, clientParams *muxedsocket.ClientParams) (types.MuxedSocket, error) {
-	conn, err := Q.Dial(pConn, clientParams.RemoteAddr, tlsConfig.ServerName, tlsConfig, getConfig(clientParams.CommonParams))
-	if err != nil {
-		return nil, err
-	}
-	return wrapConn(conn)
-}
-
 func (c *Conn) AcceptStream() (stream types.MuxStream, err error) {
 	s, err := c.conn.AcceptStream(context.Background())
 	if err != nil {
@@ -71,3 +71,15 @@ func (c *Conn) LocalAddr() net.Addr {
 func (c *Conn) RemoteAddr() net.Addr {
 	return c.conn.RemoteAddr()
 }
+
+func (c *Conn) CanRedial() bool {
+	return c.dialFunc != nil
+}
+
+// Redial dials a new connection, over a new packet connection.
+func (c *Conn) Redial() (types.Socket, error) {
+	if c.dialFunc == nil {
+		return nil, muxedsocket.ErrRedialNotSupported
+	}
+	return c.dialFunc(context.Background())
+}
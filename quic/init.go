@@ -3,6 +3,5 @@ package quic
 import "github.com/hadi77ir/muxedsocket"
 
 func init() {
-	muxedsocket.GlobalCreators().MuxDialers().Register("quic", Dial)
-	muxedsocket.GlobalCreators().MuxListeners().Register("quic", Listen)
+	muxedsocket.GlobalCreators().PacketSolutions().Register("quic", &Implementation{})
 }
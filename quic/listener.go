@@ -2,21 +2,34 @@ package quic
 
 import (
 	"context"
-	"crypto/tls"
-	"github.com/hadi77ir/muxedsocket"
 	"github.com/hadi77ir/muxedsocket/types"
 	Q "github.com/lucas-clemente/quic-go"
 	"net"
+	"sync"
 )
 
 var _ types.MuxedListener = &Listener{}
 
 type Listener struct {
 	listener Q.Listener
+	// packetConn isn't closed by quic-go, as it wasn't created there.
+	packetConn types.PacketConn
+	closed     chan struct{}
+	closeOnce  sync.Once
+}
+
+func (l *Listener) CloseChan() <-chan struct{} {
+	return l.closed
 }
 
 func (l *Listener) Close() error {
-	return l.listener.Close()
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		err = l.listener.Close()
+		_ = l.packetConn.Close()
+	})
+	return err
 }
 
 func (l *Listener) Addr() net.Addr {
@@ -24,17 +37,28 @@ func (l *Listener) Addr() net.Addr {
 }
 
 func (l *Listener) Accept() (types.Socket, error) {
+	return l.AcceptMuxed()
+}
+
+func (l *Listener) AcceptMuxed() (types.MuxedSocket, error) {
 	conn, err := l.listener.Accept(context.Background())
 	if err != nil {
+		select {
+		case <-l.closed:
+			return nil, net.ErrClosed
+		default:
+		}
 		return nil, err
 	}
-	return wrapConn(conn)
+	return wrapConn(conn, nil), nil
 }
 
-func Listen(packetConn net.PacketConn, tlsConfig *tls.Config, params *muxedsocket.ServerParams) (types.MuxedListener, error) {
-	listener, err := Q.Listen(packetConn, tlsConfig, getConfig(params.CommonParams))
-	if err != nil {
-		return nil, err
-	}
-	return wrapListener(listener), nil
+// earlyListener gives out connections of an EarlyListener as regular ones. They may be used before handshake
+// completes.
+type earlyListener struct {
+	Q.EarlyListener
+}
+
+func (l earlyListener) Accept(ctx context.Context) (Q.Connection, error) {
+	return l.EarlyListener.Accept(ctx)
 }
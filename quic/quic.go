@@ -0,0 +1,128 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/hadi77ir/muxedsocket"
+	T "github.com/hadi77ir/muxedsocket/tls"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	Q "github.com/lucas-clemente/quic-go"
+)
+
+type Implementation struct {
+	// tlsConfig, if set, is used instead of TLS parameters.
+	tlsConfig *tls.Config
+}
+
+// NewImplementationWithTLSConfig returns an implementation that uses given TLS config as is, instead of building one
+// from TLS parameters. Other parameters still apply.
+func NewImplementationWithTLSConfig(config *tls.Config) *Implementation {
+	return &Implementation{tlsConfig: config}
+}
+
+var _ types.PacketSolutionImplementation = &Implementation{}
+var _ types.PacketSolutionContextImplementation = &Implementation{}
+var _ types.HasParametersHint = &Implementation{}
+
+func (i *Implementation) Server(conn types.PacketConnFunc, parameters utils.Parameters) (types.MuxListenFunc, error) {
+	listenFunc, err := i.ServerContext(conn.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return listenFunc.WithoutContext(), nil
+}
+
+func (i *Implementation) Client(conn types.PacketConnFunc, parameters utils.Parameters) (types.MuxDialFunc, error) {
+	dialFunc, err := i.ClientContext(conn.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return dialFunc.WithoutContext(), nil
+}
+
+func (i *Implementation) ServerContext(conn types.PacketConnContextFunc, parameters utils.Parameters) (types.MuxListenContextFunc, error) {
+	zeroRTT := utils.BoolFromParameters(parameters, ParamZeroRTT, false)
+	tlsConfig, err := i.getTLSConfig(parameters, false, zeroRTT)
+	if err != nil {
+		return nil, err
+	}
+	config := getConfig(parameters)
+	return func(ctx context.Context) (types.MuxedListener, error) {
+		packetConn, err := conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		listener, err := listen(packetConn, tlsConfig, config, zeroRTT)
+		if err != nil {
+			_ = packetConn.Close()
+			return nil, err
+		}
+		return wrapListener(listener, packetConn), nil
+	}, nil
+}
+
+func (i *Implementation) ClientContext(conn types.PacketConnContextFunc, parameters utils.Parameters) (types.MuxDialContextFunc, error) {
+	zeroRTT := utils.BoolFromParameters(parameters, ParamZeroRTT, false)
+	tlsConfig, err := i.getTLSConfig(parameters, true, zeroRTT)
+	if err != nil {
+		return nil, err
+	}
+	config := getConfig(parameters)
+	var dialFunc types.MuxDialContextFunc
+	dialFunc = func(ctx context.Context) (types.MuxedSocket, error) {
+		packetConn, err := conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		qconn, err := dial(ctx, packetConn, tlsConfig, config, zeroRTT)
+		if err != nil {
+			_ = packetConn.Close()
+			return nil, err
+		}
+		// packetConn was made for this connection alone.
+		go func() {
+			<-qconn.Context().Done()
+			_ = packetConn.Close()
+		}()
+		return wrapConn(qconn, dialFunc), nil
+	}
+	return dialFunc, nil
+}
+
+func (i *Implementation) getTLSConfig(parameters utils.Parameters, isClient bool, zeroRTT bool) (*tls.Config, error) {
+	if i.tlsConfig != nil {
+		return completeTLSConfig(i.tlsConfig.Clone(), isClient, zeroRTT), nil
+	}
+	return getTLSConfig(parameters, isClient, zeroRTT)
+}
+
+func listen(packetConn types.PacketConn, tlsConfig *tls.Config, config *Q.Config, zeroRTT bool) (Q.Listener, error) {
+	if zeroRTT {
+		listener, err := Q.ListenEarly(packetConn, tlsConfig, config)
+		if err != nil {
+			return nil, err
+		}
+		return earlyListener{listener}, nil
+	}
+	return Q.Listen(packetConn, tlsConfig, config)
+}
+
+func dial(ctx context.Context, packetConn types.PacketConn, tlsConfig *tls.Config, config *Q.Config, zeroRTT bool) (Q.Connection, error) {
+	remoteAddr := packetConn.RemoteAddr()
+	if remoteAddr == nil {
+		return nil, muxedsocket.ErrNoRemoteAddr
+	}
+	if zeroRTT {
+		return Q.DialEarlyContext(ctx, packetConn, remoteAddr, tlsConfig.ServerName, tlsConfig, config)
+	}
+	return Q.DialContext(ctx, packetConn, remoteAddr, tlsConfig.ServerName, tlsConfig, config)
+}
+
+func (i *Implementation) ClientParametersHint() []utils.ParameterHint {
+	return append(append([]utils.ParameterHint{}, parametersHint...), T.ClientParametersHint()...)
+}
+
+func (i *Implementation) ServerParametersHint() []utils.ParameterHint {
+	return append(append([]utils.ParameterHint{}, parametersHint...), T.ServerParametersHint()...)
+}
@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"github.com/hadi77ir/muxedsocket"
 	"github.com/hadi77ir/muxedsocket/types"
 	Q "github.com/lucas-clemente/quic-go"
 	"net"
@@ -15,8 +16,9 @@ type Stream struct {
 	remoteAddr *types.MuxedAddr
 }
 
+// CloseChan is closed once the sending side of stream is closed.
 func (s *Stream) CloseChan() <-chan struct{} {
-	return s.CloseChan()
+	return s.stream.Context().Done()
 }
 
 func (s *Stream) Read(b []byte) (n int, err error) {
@@ -54,3 +56,11 @@ func (s *Stream) SetWriteDeadline(t time.Time) error {
 func (s *Stream) StreamID() int {
 	return int(s.stream.StreamID())
 }
+
+func (s *Stream) CanRedial() bool {
+	return false
+}
+
+func (s *Stream) Redial() (types.Socket, error) {
+	return nil, muxedsocket.ErrRedialNotSupported
+}
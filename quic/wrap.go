@@ -5,12 +5,12 @@ import (
 	Q "github.com/lucas-clemente/quic-go"
 )
 
-func wrapListener(listener Q.Listener) types.MuxedListener {
-	return &Listener{listener: listener}
+func wrapListener(listener Q.Listener, packetConn types.PacketConn) types.MuxedListener {
+	return &Listener{listener: listener, packetConn: packetConn, closed: make(chan struct{})}
 }
 
-func wrapConn(conn Q.Connection) (types.DatagramCapableMuxedSocket, error) {
-	return &Conn{conn: conn}, nil
+func wrapConn(conn Q.Connection, dialFunc types.MuxDialContextFunc) types.DatagramCapableMuxedSocket {
+	return &Conn{conn: conn, dialFunc: dialFunc}
 }
 
 func wrapStream(c Q.Connection, s Q.Stream) (types.MuxStream, error) {
@@ -0,0 +1,12 @@
+package muxedsocket
+
+import "github.com/hadi77ir/muxedsocket/utils"
+
+// RedactURIWithRegistry returns uri with secrets and references in its parameters replaced, so that it can be logged.
+func RedactURIWithRegistry(creators *Creators, uri string) string {
+	return utils.RedactURI(creators.Resolvers(), uri)
+}
+
+func RedactURI(uri string) string {
+	return RedactURIWithRegistry(creators, uri)
+}
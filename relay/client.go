@@ -0,0 +1,317 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	ParamRedialDelay   = "redialdelay"
+	DefaultRedialDelay = time.Second
+	queueSize          = 64
+)
+
+var ErrNoRoutes = errors.New("no routes given")
+
+// Route is a packet chain leading to a relay, like "spos+tls+tcp://relay1:443". Routes with more weight carry more of
+// the packets. Weight below one counts as one.
+type Route struct {
+	URI    string
+	Weight int
+}
+
+// routesAddr is what the final destination looks like to a multi-route client, whichever route packets take.
+type routesAddr struct{}
+
+func (routesAddr) Network() string {
+	return "relay"
+}
+
+func (routesAddr) String() string {
+	return "routes"
+}
+
+type routeState struct {
+	route Route
+	// conn is nil while route is down.
+	conn types.PacketConn
+	// current is the running score of smooth weighted round-robin.
+	current int
+}
+
+// multiRouteConn spreads packets of one session over several routes. Routes that fail are left out until they are
+// redialed.
+type multiRouteConn struct {
+	*utils.PacketQueue
+	session     SessionAddr
+	tagger      tagger
+	creators    *muxedsocket.Creators
+	redialDelay time.Duration
+
+	mutex  sync.Mutex
+	routes []*routeState
+}
+
+// DialRoutesWithRegistry dials every route, and returns a connection that spreads packets over the routes which
+// succeeded. It fails only if all of them fail. Peer of the connection is the final destination the relays lead to.
+// key is the one shared with relays, or nil if tags are not authenticated.
+func DialRoutesWithRegistry(ctx context.Context, creators *muxedsocket.Creators, routes []Route, redialDelay time.Duration, key []byte) (types.PacketConn, error) {
+	if len(routes) == 0 {
+		return nil, ErrNoRoutes
+	}
+	session, err := newSessionAddr()
+	if err != nil {
+		return nil, err
+	}
+	c := &multiRouteConn{
+		PacketQueue: utils.NewPacketQueue(queueSize),
+		session:     session,
+		tagger:      newTagger(key),
+		creators:    creators,
+		redialDelay: redialDelay,
+		routes:      make([]*routeState, len(routes)),
+	}
+	var lastErr error
+	for i, route := range routes {
+		if route.Weight < 1 {
+			route.Weight = 1
+		}
+		state := &routeState{route: route}
+		c.routes[i] = state
+		state.conn, err = muxedsocket.DialPacketURIWithRegistryContext(ctx, creators, route.URI)
+		if err != nil {
+			lastErr = err
+		}
+	}
+	if lastErr != nil && !c.anyUp() {
+		_ = c.Close()
+		return nil, lastErr
+	}
+	for _, state := range c.routes {
+		go c.maintain(state)
+	}
+	return c, nil
+}
+
+func DialRoutes(ctx context.Context, routes []Route, key []byte) (types.PacketConn, error) {
+	return DialRoutesWithRegistry(ctx, muxedsocket.GlobalCreators(), routes, DefaultRedialDelay, key)
+}
+
+func (c *multiRouteConn) anyUp() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, state := range c.routes {
+		if state.conn != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// maintain reads from the route while it is up, and redials it whenever it goes down.
+func (c *multiRouteConn) maintain(state *routeState) {
+	for {
+		c.mutex.Lock()
+		conn := state.conn
+		c.mutex.Unlock()
+		if conn != nil {
+			c.readRoute(conn)
+			_ = conn.Close()
+			if !c.setConn(state, nil) {
+				return
+			}
+		}
+		select {
+		case <-c.CloseChan():
+			return
+		case <-time.After(c.redialDelay):
+		}
+		conn, err := muxedsocket.DialPacketURIWithRegistryContext(context.Background(), c.creators, state.route.URI)
+		if err != nil {
+			continue
+		}
+		if !c.setConn(state, conn) {
+			_ = conn.Close()
+			return
+		}
+	}
+}
+
+func (c *multiRouteConn) readRoute(conn types.PacketConn) {
+	buffer := make([]byte, 0xffff+c.tagger.overhead())
+	for {
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		session, payload, ok := c.tagger.untag(buffer[:n])
+		if !ok || session != c.session {
+			continue
+		}
+		// a reader that falls behind loses packets, instead of stalling the route.
+		if !c.TryDeliver(append([]byte{}, payload...), routesAddr{}) {
+			return
+		}
+	}
+}
+
+func (c *multiRouteConn) setConn(state *routeState, conn types.PacketConn) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.IsClosed() {
+		return false
+	}
+	state.conn = conn
+	state.current = 0
+	return true
+}
+
+// pick orders routes that are up by smooth weighted round-robin: first one is the turn of this packet, the rest are
+// for failing over.
+func (c *multiRouteConn) pick() []types.PacketConn {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var best *routeState
+	total := 0
+	up := make([]types.PacketConn, 0, len(c.routes))
+	for _, state := range c.routes {
+		if state.conn == nil {
+			continue
+		}
+		state.current += state.route.Weight
+		total += state.route.Weight
+		if best == nil || state.current > best.current {
+			best = state
+		}
+		up = append(up, state.conn)
+	}
+	if best == nil {
+		return nil
+	}
+	best.current -= total
+	for i, conn := range up {
+		if conn == best.conn {
+			up[0], up[i] = up[i], up[0]
+			break
+		}
+	}
+	return up
+}
+
+// WriteTo sends p over one of the routes, whatever addr is. If that route fails, it is taken down and the next one is
+// tried. While all routes are down, packets are dropped.
+func (c *multiRouteConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if c.IsClosed() {
+		return 0, net.ErrClosed
+	}
+	tagged := c.tagger.tag(c.session, p)
+	writeDeadline := c.WriteDeadline()
+	for _, conn := range c.pick() {
+		_ = conn.SetWriteDeadline(writeDeadline)
+		_, err := conn.WriteTo(tagged, conn.RemoteAddr())
+		if err == nil {
+			return len(p), nil
+		}
+		if os.IsTimeout(err) {
+			return 0, err
+		}
+		// reader of the route notices and redials it.
+		_ = conn.Close()
+	}
+	return len(p), nil
+}
+
+func (c *multiRouteConn) Close() error {
+	c.mutex.Lock()
+	first := c.Shutdown()
+	var conns []types.PacketConn
+	for _, state := range c.routes {
+		if state != nil && state.conn != nil {
+			conns = append(conns, state.conn)
+		}
+	}
+	c.mutex.Unlock()
+	if first {
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}
+	return nil
+}
+
+func (c *multiRouteConn) LocalAddr() net.Addr {
+	return c.session
+}
+
+func (c *multiRouteConn) RemoteAddr() net.Addr {
+	return routesAddr{}
+}
+
+func (c *multiRouteConn) CanRedial() bool {
+	return false
+}
+
+func (c *multiRouteConn) Redial() (types.Socket, error) {
+	return nil, muxedsocket.ErrRedialNotSupported
+}
+
+var _ types.PacketConn = &multiRouteConn{}
+
+// RoutesImplementation is a packet transport that takes given routes, ignoring the address it is given. Register it
+// under a name to use the routes in URIs, like "quic+myroutes://destination".
+type RoutesImplementation struct {
+	creators *muxedsocket.Creators
+	routes   []Route
+}
+
+// NewRoutesImplementation creates a transport over given routes. Routes are dialed using creators, which may be the
+// same creators the implementation is registered on.
+func NewRoutesImplementation(creators *muxedsocket.Creators, routes ...Route) *RoutesImplementation {
+	return &RoutesImplementation{creators: creators, routes: routes}
+}
+
+var _ types.PacketConnImplementation = &RoutesImplementation{}
+var _ types.PacketConnContextImplementation = &RoutesImplementation{}
+var _ types.HasParametersHint = &RoutesImplementation{}
+
+func (i *RoutesImplementation) Server(addr string, parameters utils.Parameters) (types.PacketConnFunc, error) {
+	return nil, muxedsocket.ErrOpNotSupported
+}
+
+func (i *RoutesImplementation) Client(addr string, parameters utils.Parameters) (types.PacketConnFunc, error) {
+	dialFunc, err := i.ClientContext(addr, parameters)
+	if err != nil {
+		return nil, err
+	}
+	return dialFunc.WithoutContext(), nil
+}
+
+func (i *RoutesImplementation) ServerContext(addr string, parameters utils.Parameters) (types.PacketConnContextFunc, error) {
+	return nil, muxedsocket.ErrOpNotSupported
+}
+
+func (i *RoutesImplementation) ClientContext(addr string, parameters utils.Parameters) (types.PacketConnContextFunc, error) {
+	redialDelay := utils.DurationFromParameters(parameters, ParamRedialDelay, DefaultRedialDelay)
+	key := keyFromParameters(parameters)
+	return func(ctx context.Context) (types.PacketConn, error) {
+		return DialRoutesWithRegistry(ctx, i.creators, i.routes, redialDelay, key)
+	}, nil
+}
+
+func (i *RoutesImplementation) ClientParametersHint() []utils.ParameterHint {
+	return []utils.ParameterHint{
+		{Key: ParamRedialDelay, Description: "wait before redialing a route that failed", Type: utils.ParameterTypeDuration, DefaultValue: DefaultRedialDelay.String()},
+		keyHint,
+	}
+}
+
+func (i *RoutesImplementation) ServerParametersHint() []utils.ParameterHint {
+	return nil
+}
@@ -0,0 +1,7 @@
+package relay
+
+import "github.com/hadi77ir/muxedsocket"
+
+func init() {
+	muxedsocket.GlobalCreators().PacketObfuscators().Register("relayed", &TaggingImplementation{})
+}
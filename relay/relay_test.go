@@ -0,0 +1,196 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memAddr string
+
+func (a memAddr) Network() string {
+	return "mem"
+}
+
+func (a memAddr) String() string {
+	return string(a)
+}
+
+// memNetwork delivers packets between memConns by address, dropping those to unknown addresses.
+type memNetwork struct {
+	mutex sync.Mutex
+	conns map[string]*memConn
+}
+
+func newMemNetwork() *memNetwork {
+	return &memNetwork{conns: make(map[string]*memConn)}
+}
+
+func (n *memNetwork) listen(local string, remote string) *memConn {
+	c := &memConn{PacketQueue: utils.NewPacketQueue(64), network: n, local: memAddr(local)}
+	if remote != "" {
+		c.remote = memAddr(remote)
+	}
+	n.mutex.Lock()
+	n.conns[local] = c
+	n.mutex.Unlock()
+	return c
+}
+
+type memConn struct {
+	*utils.PacketQueue
+	network *memNetwork
+	local   net.Addr
+	remote  net.Addr
+}
+
+var _ types.PacketConn = &memConn{}
+
+func (c *memConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if c.IsClosed() {
+		return 0, net.ErrClosed
+	}
+	if addr == nil {
+		addr = c.remote
+	}
+	c.network.mutex.Lock()
+	peer := c.network.conns[addr.String()]
+	c.network.mutex.Unlock()
+	if peer != nil {
+		peer.TryDeliver(append([]byte(nil), p...), c.local)
+	}
+	return len(p), nil
+}
+
+func (c *memConn) Close() error {
+	c.Shutdown()
+	return nil
+}
+
+func (c *memConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *memConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *memConn) CanRedial() bool {
+	return false
+}
+
+func (c *memConn) Redial() (types.Socket, error) {
+	return nil, net.ErrClosed
+}
+
+func TestTaggerAuthenticates(t *testing.T) {
+	session, err := newSessionAddr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyed := newTagger([]byte("key"))
+	tagged := keyed.tag(session, []byte("data"))
+	if got, payload, ok := keyed.untag(tagged); !ok || got != session || string(payload) != "data" {
+		t.Fatal(got, string(payload), ok)
+	}
+
+	if _, _, ok := newTagger([]byte("other key")).untag(tagged); ok {
+		t.Fatal("accepted a tag of another key")
+	}
+	if _, _, ok := newTagger(nil).untag(tagged); !ok {
+		t.Fatal("rejected a tag without key")
+	}
+	tampered := append([]byte(nil), tagged...)
+	tampered[len(tampered)-1] ^= 1
+	if _, _, ok := keyed.untag(tampered); ok {
+		t.Fatal("accepted a tampered payload")
+	}
+	if _, _, ok := keyed.untag(newTagger(nil).tag(session, []byte("data"))); ok {
+		t.Fatal("accepted a tag without MAC")
+	}
+}
+
+func TestPathsAreCapped(t *testing.T) {
+	p := newPaths(time.Minute)
+	session := SessionAddr{1}
+	for i := 0; i < maxPaths; i++ {
+		p.record(session, memAddr(fmt.Sprint("path", i)))
+	}
+	// path0 is seen again, leaving path1 as the oldest.
+	time.Sleep(time.Millisecond)
+	p.record(session, memAddr("path0"))
+	p.record(session, memAddr("new"))
+
+	picked := p.pick(session)
+	if len(picked) != maxPaths {
+		t.Fatalf("%d paths remembered", len(picked))
+	}
+	found := make(map[string]bool)
+	for _, addr := range picked {
+		found[addr.String()] = true
+	}
+	if !found["new"] || !found["path0"] || found["path1"] {
+		t.Fatal(found)
+	}
+}
+
+func TestServerIgnoresForgedTags(t *testing.T) {
+	key := []byte("shared key")
+	network := newMemNetwork()
+	downstream := network.listen("relay", "")
+	upstream := network.listen("relay upstream", "destination")
+	server := NewServer(downstream, upstream, nil, time.Minute, key)
+	go func() {
+		_ = server.Serve()
+	}()
+	defer server.Close()
+	destination := Terminate(network.listen("destination", ""), time.Minute, key)
+	defer destination.Close()
+
+	session, err := newSessionAddr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &taggingConn{PacketConn: network.listen("client", "relay"), session: session, tagger: newTagger(key)}
+	defer client.Close()
+	attacker := &taggingConn{PacketConn: network.listen("attacker", "relay"), session: session, tagger: newTagger([]byte("guess"))}
+	defer attacker.Close()
+
+	if _, err := attacker.WriteTo([]byte("forged"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.WriteTo([]byte("hello"), nil); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	_ = destination.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, addr, err := destination.ReadFrom(buf)
+	if err != nil || string(buf[:n]) != "hello" {
+		t.Fatal(string(buf[:n]), err)
+	}
+	if addr != session {
+		t.Fatalf("packet came from %s, not %s", addr, session)
+	}
+
+	if _, err := destination.WriteTo([]byte("reply"), addr); err != nil {
+		t.Fatal(err)
+	}
+	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err = client.ReadFrom(buf)
+	if err != nil || !bytes.Equal(buf[:n], []byte("reply")) {
+		t.Fatal(string(buf[:n]), err)
+	}
+	_ = attacker.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, err := attacker.ReadFrom(buf); !os.IsTimeout(err) {
+		t.Fatal("reply reached the forged path:", err)
+	}
+	if picked := server.paths.pick(session); len(picked) != 1 || picked[0].String() != "client" {
+		t.Fatal(picked)
+	}
+}
@@ -0,0 +1,183 @@
+package relay
+
+import (
+	"context"
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/types"
+	"net"
+	"sync"
+	"time"
+)
+
+const upstreamRedialDelay = time.Second
+
+// Server relays tagged packets between clients, reaching it on a downstream packet listener, and an upstream, which is
+// either the final destination or another relay. Packets are passed on as they are; session ids are only read to send
+// replies back to the client the session belongs to. If a key is shared with clients, packets whose tags don't match
+// it are dropped.
+type Server struct {
+	downstream   types.PacketConn
+	upstreamFunc types.PacketConnContextFunc
+	paths        *paths
+	tagger       tagger
+
+	mutex     sync.Mutex
+	upstream  types.PacketConn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// ListenWithRegistry listens on listenURI and dials upstreamURI, both of which have to be packet chains, like
+// "spos+tls+tcp://:443" and "udp://destination:443". key is the one given to clients, or nil if tags are not
+// authenticated. Call Serve to start relaying.
+func ListenWithRegistry(ctx context.Context, creators *muxedsocket.Creators, listenURI string, upstreamURI string, key []byte) (*Server, error) {
+	upstreamFunc := func(ctx context.Context) (types.PacketConn, error) {
+		return muxedsocket.DialPacketURIWithRegistryContext(ctx, creators, upstreamURI)
+	}
+	upstream, err := upstreamFunc(ctx)
+	if err != nil {
+		return nil, err
+	}
+	downstream, err := muxedsocket.ListenPacketURIWithRegistryContext(ctx, creators, listenURI)
+	if err != nil {
+		_ = upstream.Close()
+		return nil, err
+	}
+	return NewServer(downstream, upstream, upstreamFunc, DefaultSessionTimeout, key), nil
+}
+
+func Listen(ctx context.Context, listenURI string, upstreamURI string, key []byte) (*Server, error) {
+	return ListenWithRegistry(ctx, muxedsocket.GlobalCreators(), listenURI, upstreamURI, key)
+}
+
+// NewServer creates a relay over existing connections. upstreamFunc is used to replace upstream when it breaks, and
+// may be nil if it shouldn't be replaced.
+func NewServer(downstream types.PacketConn, upstream types.PacketConn, upstreamFunc types.PacketConnContextFunc, sessionTimeout time.Duration, key []byte) *Server {
+	return &Server{
+		downstream:   downstream,
+		upstream:     upstream,
+		upstreamFunc: upstreamFunc,
+		paths:        newPaths(sessionTimeout),
+		tagger:       newTagger(key),
+		closed:       make(chan struct{}),
+	}
+}
+
+func (s *Server) Addr() net.Addr {
+	return s.downstream.LocalAddr()
+}
+
+// Serve relays packets until server is closed or downstream fails. Error is nil if server was closed.
+func (s *Server) Serve() error {
+	go s.serveUpstream()
+	buffer := make([]byte, 0xffff+s.tagger.overhead())
+	for {
+		n, from, err := s.downstream.ReadFrom(buffer)
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			_ = s.Close()
+			return err
+		}
+		session, _, ok := s.tagger.untag(buffer[:n])
+		if !ok {
+			continue
+		}
+		s.paths.record(session, from)
+		if upstream := s.getUpstream(); upstream != nil {
+			// a lost packet is left for the session to recover from.
+			_, _ = upstream.WriteTo(buffer[:n], upstream.RemoteAddr())
+		}
+	}
+}
+
+func (s *Server) serveUpstream() {
+	buffer := make([]byte, 0xffff+s.tagger.overhead())
+	for {
+		upstream := s.getUpstream()
+		for {
+			n, _, err := upstream.ReadFrom(buffer)
+			if err != nil {
+				break
+			}
+			session, _, ok := s.tagger.untag(buffer[:n])
+			if !ok {
+				continue
+			}
+			for _, to := range s.paths.pick(session) {
+				if _, err = s.downstream.WriteTo(buffer[:n], to); err == nil {
+					break
+				}
+				s.paths.forget(session, to)
+			}
+		}
+		_ = upstream.Close()
+		if s.upstreamFunc == nil || !s.redialUpstream() {
+			_ = s.Close()
+			return
+		}
+	}
+}
+
+// redialUpstream retries until upstream is replaced, or server is closed.
+func (s *Server) redialUpstream() bool {
+	s.setUpstream(nil)
+	for {
+		select {
+		case <-s.closed:
+			return false
+		case <-time.After(upstreamRedialDelay):
+		}
+		upstream, err := s.upstreamFunc(context.Background())
+		if err != nil {
+			continue
+		}
+		if !s.setUpstream(upstream) {
+			_ = upstream.Close()
+			return false
+		}
+		return true
+	}
+}
+
+func (s *Server) getUpstream() types.PacketConn {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.upstream
+}
+
+func (s *Server) setUpstream(upstream types.PacketConn) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.isClosed() {
+		return false
+	}
+	s.upstream = upstream
+	return true
+}
+
+func (s *Server) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops relaying and closes both sides.
+func (s *Server) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		s.mutex.Lock()
+		close(s.closed)
+		upstream := s.upstream
+		s.mutex.Unlock()
+		err = s.downstream.Close()
+		if upstream != nil {
+			_ = upstream.Close()
+		}
+	})
+	return err
+}
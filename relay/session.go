@@ -0,0 +1,208 @@
+package relay
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// tagSize is the length of session id, which prefixes every relayed packet.
+	tagSize = len(SessionAddr{})
+	// macSize is the length of the truncated HMAC-SHA256 that follows session id, if a key is shared.
+	macSize = 16
+	// maxPaths bounds how many paths are remembered for a session. Once reached, the one seen least recently is
+	// forgotten to make room.
+	maxPaths = 8
+
+	DefaultSessionTimeout = 2 * time.Minute
+	// pathTimeout is how long a path a session was last seen on is considered usable for replying.
+	pathTimeout = 30 * time.Second
+)
+
+// SessionAddr is the virtual address of a relayed session. Final destination sees packets of a session coming from it,
+// whichever relay they took.
+type SessionAddr [16]byte
+
+func (a SessionAddr) Network() string {
+	return "relay"
+}
+
+func (a SessionAddr) String() string {
+	return hex.EncodeToString(a[:])
+}
+
+var _ net.Addr = SessionAddr{}
+
+func newSessionAddr() (SessionAddr, error) {
+	var addr SessionAddr
+	_, err := rand.Read(addr[:])
+	return addr, err
+}
+
+// tagger tags packets with their session id. If there is a key, tags carry a MAC of session id and payload, so that
+// only those who share the key can make packets relays take for a session. Captured packets may still be replayed
+// from elsewhere, which is why paths of a session are capped.
+type tagger struct {
+	key []byte
+}
+
+func newTagger(key []byte) tagger {
+	if len(key) == 0 {
+		return tagger{}
+	}
+	return tagger{key: key}
+}
+
+// overhead is how much longer tagging makes a packet.
+func (t tagger) overhead() int {
+	if t.key == nil {
+		return tagSize
+	}
+	return tagSize + macSize
+}
+
+func (t tagger) mac(session SessionAddr, p []byte) []byte {
+	h := hmac.New(sha256.New, t.key)
+	h.Write(session[:])
+	h.Write(p)
+	return h.Sum(nil)[:macSize]
+}
+
+func (t tagger) tag(session SessionAddr, p []byte) []byte {
+	tagged := make([]byte, t.overhead()+len(p))
+	copy(tagged, session[:])
+	if t.key != nil {
+		copy(tagged[tagSize:], t.mac(session, p))
+	}
+	copy(tagged[t.overhead():], p)
+	return tagged
+}
+
+// untag returns session id and payload of a tagged packet. It fails if packet is too short, or its MAC doesn't match.
+func (t tagger) untag(tagged []byte) (SessionAddr, []byte, bool) {
+	var session SessionAddr
+	if len(tagged) < t.overhead() {
+		return session, nil, false
+	}
+	copy(session[:], tagged)
+	payload := tagged[t.overhead():]
+	if t.key != nil && !hmac.Equal(tagged[tagSize:tagSize+macSize], t.mac(session, payload)) {
+		return session, nil, false
+	}
+	return session, payload, true
+}
+
+type path struct {
+	addr     net.Addr
+	lastSeen time.Time
+}
+
+// paths remembers the addresses each session was recently seen on, so that replies can be sent back along them.
+type paths struct {
+	mutex     sync.Mutex
+	timeout   time.Duration
+	sessions  map[SessionAddr][]*path
+	next      map[SessionAddr]int
+	lastSweep time.Time
+}
+
+func newPaths(timeout time.Duration) *paths {
+	return &paths{
+		timeout:   timeout,
+		sessions:  make(map[SessionAddr][]*path),
+		next:      make(map[SessionAddr]int),
+		lastSweep: time.Now(),
+	}
+}
+
+func (p *paths) record(session SessionAddr, addr net.Addr) {
+	now := time.Now()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if now.Sub(p.lastSweep) > p.timeout {
+		p.sweep(now)
+	}
+	key := addr.String()
+	known := p.sessions[session]
+	oldest := 0
+	for i, existing := range known {
+		if existing.addr.String() == key {
+			existing.lastSeen = now
+			return
+		}
+		if existing.lastSeen.Before(known[oldest].lastSeen) {
+			oldest = i
+		}
+	}
+	if len(known) >= maxPaths {
+		known[oldest] = &path{addr: addr, lastSeen: now}
+		return
+	}
+	p.sessions[session] = append(known, &path{addr: addr, lastSeen: now})
+}
+
+// sweep forgets sessions that haven't been seen in a while, along with stale paths of the others.
+func (p *paths) sweep(now time.Time) {
+	p.lastSweep = now
+	for session, known := range p.sessions {
+		fresh := known[:0]
+		for _, existing := range known {
+			if now.Sub(existing.lastSeen) <= p.timeout {
+				fresh = append(fresh, existing)
+			}
+		}
+		if len(fresh) == 0 {
+			delete(p.sessions, session)
+			delete(p.next, session)
+			continue
+		}
+		p.sessions[session] = fresh
+	}
+}
+
+// pick returns the paths to reply to session on, in the order they should be tried. Paths seen lately take turns in
+// going first; if there are none, the latest one is used.
+func (p *paths) pick(session SessionAddr) []net.Addr {
+	now := time.Now()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	known := p.sessions[session]
+	if len(known) == 0 {
+		return nil
+	}
+	var latest *path
+	var recent []net.Addr
+	for _, existing := range known {
+		if latest == nil || existing.lastSeen.After(latest.lastSeen) {
+			latest = existing
+		}
+		if now.Sub(existing.lastSeen) <= pathTimeout {
+			recent = append(recent, existing.addr)
+		}
+	}
+	if len(recent) == 0 {
+		return []net.Addr{latest.addr}
+	}
+	next := p.next[session] % len(recent)
+	p.next[session] = next + 1
+	return append(recent[next:], recent[:next]...)
+}
+
+// forget removes a path that failed, until session is seen on it again.
+func (p *paths) forget(session SessionAddr, addr net.Addr) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	key := addr.String()
+	known := p.sessions[session]
+	for i, existing := range known {
+		if existing.addr.String() == key {
+			p.sessions[session] = append(known[:i], known[i+1:]...)
+			return
+		}
+	}
+}
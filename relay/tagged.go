@@ -0,0 +1,185 @@
+package relay
+
+import (
+	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	ParamSessionTimeout = "sessiontimeout"
+	ParamKey            = "key"
+)
+
+// keyFromParameters returns the key shared by clients and relays, or nil if there is none.
+func keyFromParameters(parameters utils.Parameters) []byte {
+	key, _ := parameters.Get(ParamKey)
+	if key == "" {
+		return nil
+	}
+	return []byte(key)
+}
+
+// TaggingImplementation is the packet obfuscator named "relayed". On server side, it terminates relayed sessions at
+// the final destination: session ids are stripped and each session appears as a peer of its own, with a SessionAddr.
+// On client side, it tags packets of a single path with a session id, so a client can reach the final destination
+// directly as well as through relays. With a key, tags are authenticated (see ParamKey), and clients, relays and the
+// final destination have to share it.
+type TaggingImplementation struct{}
+
+var _ types.PacketObfuscatorImplementation = &TaggingImplementation{}
+var _ types.HasParametersHint = &TaggingImplementation{}
+
+func (i *TaggingImplementation) Server(conn types.PacketConnFunc, parameters utils.Parameters) (types.PacketConnFunc, error) {
+	timeout := utils.DurationFromParameters(parameters, ParamSessionTimeout, DefaultSessionTimeout)
+	key := keyFromParameters(parameters)
+	return func() (types.PacketConn, error) {
+		inner, err := conn()
+		if err != nil {
+			return nil, err
+		}
+		return Terminate(inner, timeout, key), nil
+	}, nil
+}
+
+func (i *TaggingImplementation) Client(conn types.PacketConnFunc, parameters utils.Parameters) (types.PacketConnFunc, error) {
+	tagger := newTagger(keyFromParameters(parameters))
+	return func() (types.PacketConn, error) {
+		session, err := newSessionAddr()
+		if err != nil {
+			return nil, err
+		}
+		inner, err := conn()
+		if err != nil {
+			return nil, err
+		}
+		return &taggingConn{PacketConn: inner, session: session, tagger: tagger}, nil
+	}, nil
+}
+
+var keyHint = utils.ParameterHint{Key: ParamKey, Description: "key shared with relays, that tags are authenticated with", Type: utils.ParameterTypeString, DefaultValue: ""}
+
+func (i *TaggingImplementation) ClientParametersHint() []utils.ParameterHint {
+	return []utils.ParameterHint{keyHint}
+}
+
+func (i *TaggingImplementation) ServerParametersHint() []utils.ParameterHint {
+	return []utils.ParameterHint{
+		{Key: ParamSessionTimeout, Description: "how long an idle session is remembered", Type: utils.ParameterTypeDuration, DefaultValue: DefaultSessionTimeout.String()},
+		keyHint,
+	}
+}
+
+// Terminate makes conn, which receives tagged packets from relays, give out untagged packets. Replies to a session
+// are tagged and sent back along the paths the session was recently seen on. key is the one shared with relays and
+// clients, or nil if tags are not authenticated.
+func Terminate(conn types.PacketConn, sessionTimeout time.Duration, key []byte) types.PacketConn {
+	return &terminatingConn{PacketConn: conn, paths: newPaths(sessionTimeout), tagger: newTagger(key)}
+}
+
+type terminatingConn struct {
+	types.PacketConn
+	paths  *paths
+	tagger tagger
+}
+
+func (c *terminatingConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	buffer := make([]byte, c.tagger.overhead()+len(p))
+	for {
+		n, from, err := c.PacketConn.ReadFrom(buffer)
+		if err != nil {
+			return 0, nil, err
+		}
+		session, payload, ok := c.tagger.untag(buffer[:n])
+		if !ok {
+			continue
+		}
+		c.paths.record(session, from)
+		return copy(p, payload), session, nil
+	}
+}
+
+func (c *terminatingConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	session, ok := addr.(SessionAddr)
+	if !ok {
+		return 0, muxedsocket.ErrUnknownPeer
+	}
+	candidates := c.paths.pick(session)
+	if len(candidates) == 0 {
+		return 0, muxedsocket.ErrUnknownPeer
+	}
+	tagged := c.tagger.tag(session, p)
+	var err error
+	for _, to := range candidates {
+		if _, err = c.PacketConn.WriteTo(tagged, to); err == nil {
+			return len(p), nil
+		}
+		if os.IsTimeout(err) {
+			break
+		}
+		c.paths.forget(session, to)
+	}
+	return 0, err
+}
+
+func (c *terminatingConn) RemoteAddr() net.Addr {
+	return nil
+}
+
+func (c *terminatingConn) CanRedial() bool {
+	return false
+}
+
+func (c *terminatingConn) Redial() (types.Socket, error) {
+	return nil, muxedsocket.ErrRedialNotSupported
+}
+
+// taggingConn is a client that takes a single path.
+type taggingConn struct {
+	types.PacketConn
+	session SessionAddr
+	tagger  tagger
+}
+
+func (c *taggingConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	buffer := make([]byte, c.tagger.overhead()+len(p))
+	for {
+		n, from, err := c.PacketConn.ReadFrom(buffer)
+		if err != nil {
+			return 0, nil, err
+		}
+		session, payload, ok := c.tagger.untag(buffer[:n])
+		if !ok || session != c.session {
+			continue
+		}
+		return copy(p, payload), from, nil
+	}
+}
+
+func (c *taggingConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if _, err := c.PacketConn.WriteTo(c.tagger.tag(c.session, p), addr); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *taggingConn) LocalAddr() net.Addr {
+	return c.session
+}
+
+// Redial replaces the path, keeping the session.
+func (c *taggingConn) Redial() (types.Socket, error) {
+	redialed, err := c.PacketConn.Redial()
+	if err != nil {
+		return nil, err
+	}
+	inner, ok := redialed.(types.PacketConn)
+	if !ok {
+		_ = redialed.Close()
+		return nil, muxedsocket.ErrInvalidChainingResult
+	}
+	return &taggingConn{PacketConn: inner, session: c.session, tagger: c.tagger}, nil
+}
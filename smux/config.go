@@ -2,17 +2,62 @@ package smux
 
 import (
 	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/utils"
 	S "github.com/xtaci/smux"
 )
 
 const SupportedSMuxVersion = 2
 
-// getConfig creates a new instance of Config, with prefilled values.
-func getConfig(params muxedsocket.CommonParams) *S.Config {
+const (
+	ParamVersion          = "version"
+	ParamMaxFrameSize     = "maxframesize"
+	ParamMaxReceiveBuffer = "maxreceivebuffer"
+	ParamMaxStreamBuffer  = "maxstreambuffer"
+	ParamCompat           = "compat"
+
+	DefaultMaxFrameSize     = 32768
+	DefaultMaxReceiveBuffer = 4194304
+	DefaultMaxStreamBuffer  = 65536
+
+	// CompatKcptun uses defaults of kcptun, which peers must agree on.
+	CompatKcptun = "kcptun"
+)
+
+// kcptunParameters are defaults of kcptun: its smuxver, smuxbuf, streambuf and keepalive.
+var kcptunParameters = utils.Parameters{
+	ParamVersion:               "1",
+	ParamMaxReceiveBuffer:      "4194304",
+	ParamMaxStreamBuffer:       "2097152",
+	ParamMaxFrameSize:          "32768",
+	muxedsocket.ParamKeepAlive: "10s",
+}
+
+var parametersHint = []utils.ParameterHint{
+	{Key: ParamVersion, Description: "protocol version, 1 or 2", Type: utils.ParameterTypeInt, DefaultValue: "2"},
+	{Key: ParamMaxFrameSize, Description: "largest frame sent to peer", Type: utils.ParameterTypeInt, DefaultValue: "32768"},
+	{Key: ParamMaxReceiveBuffer, Description: "bytes buffered for the whole session", Type: utils.ParameterTypeInt, DefaultValue: "4194304"},
+	{Key: ParamMaxStreamBuffer, Description: "bytes buffered per stream (version 2)", Type: utils.ParameterTypeInt, DefaultValue: "65536"},
+	{Key: ParamCompat, Description: "compatibility profile, kcptun for defaults of kcptun", Type: utils.ParameterTypeString, DefaultValue: ""},
+}
+
+// getConfig creates a new instance of Config from parameters, and verifies it.
+func getConfig(parameters utils.Parameters) (*S.Config, error) {
+	switch compat := utils.StringFromParameters(parameters, ParamCompat, ""); compat {
+	case "":
+	case CompatKcptun:
+		parameters = utils.CombineParameters(kcptunParameters, parameters)
+	default:
+		return nil, muxedsocket.ErrInvalidParameters{Problems: []muxedsocket.ParameterProblem{{Key: ParamCompat, Reason: "unknown profile " + compat}}}
+	}
 	config := S.DefaultConfig()
-	config.Version = SupportedSMuxVersion
-	config.KeepAliveDisabled = params.KeepalivePeriod <= 0 || params.MaxIdleTimeout <= params.KeepalivePeriod
-	config.KeepAliveInterval = params.KeepalivePeriod
-	config.KeepAliveTimeout = params.MaxIdleTimeout
-	return config
+	config.Version = utils.IntegerFromParameters(parameters, ParamVersion, SupportedSMuxVersion)
+	config.KeepAliveInterval, config.KeepAliveTimeout = muxedsocket.KeepAliveFromParameters(parameters)
+	config.KeepAliveDisabled = config.KeepAliveInterval <= 0
+	config.MaxFrameSize = utils.IntegerFromParameters(parameters, ParamMaxFrameSize, DefaultMaxFrameSize)
+	config.MaxReceiveBuffer = utils.IntegerFromParameters(parameters, ParamMaxReceiveBuffer, DefaultMaxReceiveBuffer)
+	config.MaxStreamBuffer = utils.IntegerFromParameters(parameters, ParamMaxStreamBuffer, DefaultMaxStreamBuffer)
+	if err := S.VerifyConfig(config); err != nil {
+		return nil, err
+	}
+	return config, nil
 }
@@ -12,23 +12,14 @@ var _ types.MuxedSocket = &Conn{}
 
 type Conn struct {
 	session *S.Session
-	ctx     context.Context
+	// dialFunc dials a new session, for redialing. It is nil for accepted sessions.
+	dialFunc types.MuxDialContextFunc
 }
 
 func (c *Conn) CloseChan() <-chan struct{} {
 	return c.session.CloseChan()
 }
 
-// ClientMuxer dials the target server and establishes a connection. If clientParams.TLSConfig is not nil, a TLS layer is added
-// on top of the connection, else not.
-func ClientMuxer(conn net.Conn, clientParams *muxedsocket.ClientParams) (types.MuxedSocket, error) {
-	sclient, err := S.Client(conn, getConfig(clientParams.CommonParams))
-	if err != nil {
-		return nil, err
-	}
-	return wrapConn(sclient), nil
-}
-
 func (c *Conn) AcceptStream() (stream types.MuxStream, err error) {
 	s, err := c.session.AcceptStream()
 	if err != nil {
@@ -56,3 +47,15 @@ func (c *Conn) LocalAddr() net.Addr {
 func (c *Conn) RemoteAddr() net.Addr {
 	return c.session.RemoteAddr()
 }
+
+func (c *Conn) CanRedial() bool {
+	return c.dialFunc != nil
+}
+
+// Redial dials a new session over a new connection.
+func (c *Conn) Redial() (types.Socket, error) {
+	if c.dialFunc == nil {
+		return nil, muxedsocket.ErrRedialNotSupported
+	}
+	return c.dialFunc(context.Background())
+}
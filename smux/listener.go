@@ -1,7 +1,6 @@
 package smux
 
 import (
-	"github.com/hadi77ir/muxedsocket"
 	"github.com/hadi77ir/muxedsocket/types"
 	S "github.com/xtaci/smux"
 	"net"
@@ -10,27 +9,29 @@ import (
 var _ types.MuxedListener = &Listener{}
 
 type Listener struct {
-	listener net.Listener
+	listener types.StreamListener
 	config   *S.Config
 }
 
-// ServerMuxer takes unencrypted stream-oriented connection-based "listener" and adds TLS and multiplexing.
-// If params.TLSConfig is nil, TLS won't be added.
-func ServerMuxer(listener net.Listener, params *muxedsocket.ServerParams) (types.MuxedListener, error) {
-	return wrapListener(listener, getConfig(params.CommonParams)), nil
+func (l *Listener) Accept() (socket types.Socket, err error) {
+	return l.AcceptMuxed()
 }
 
-func (l *Listener) Accept() (socket types.Socket, err error) {
-	conn, err := l.listener.Accept()
+func (l *Listener) AcceptMuxed() (socket types.MuxedSocket, err error) {
+	conn, err := l.listener.AcceptConn()
 	if err != nil {
 		return nil, err
 	}
-
-	sconn, err := S.Server(conn, l.config)
+	session, err := S.Server(conn, l.config)
 	if err != nil {
+		_ = conn.Close()
 		return nil, err
 	}
-	return wrapConn(sconn), nil
+	return wrapConn(session, nil), nil
+}
+
+func (l *Listener) CloseChan() <-chan struct{} {
+	return l.listener.CloseChan()
 }
 
 func (l *Listener) Close() error {
@@ -1,6 +1,7 @@
 package smux
 
 import (
+	"github.com/hadi77ir/muxedsocket"
 	"github.com/hadi77ir/muxedsocket/types"
 	S "github.com/xtaci/smux"
 	"net"
@@ -15,6 +16,10 @@ type Stream struct {
 	remoteAddr net.Addr
 }
 
+func (s *Stream) CloseChan() <-chan struct{} {
+	return s.stream.GetDieCh()
+}
+
 func (s *Stream) Read(b []byte) (n int, err error) {
 	return s.stream.Read(b)
 }
@@ -36,17 +41,25 @@ func (s *Stream) RemoteAddr() net.Addr {
 }
 
 func (s *Stream) SetDeadline(t time.Time) error {
-	return s.SetDeadline(t)
+	return s.stream.SetDeadline(t)
 }
 
 func (s *Stream) SetReadDeadline(t time.Time) error {
-	return s.SetReadDeadline(t)
+	return s.stream.SetReadDeadline(t)
 }
 
 func (s *Stream) SetWriteDeadline(t time.Time) error {
-	return s.SetWriteDeadline(t)
+	return s.stream.SetWriteDeadline(t)
 }
 
 func (s *Stream) StreamID() int {
 	return int(s.stream.ID())
 }
+
+func (s *Stream) CanRedial() bool {
+	return false
+}
+
+func (s *Stream) Redial() (types.Socket, error) {
+	return nil, muxedsocket.ErrRedialNotSupported
+}
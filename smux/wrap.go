@@ -3,16 +3,16 @@ package smux
 import (
 	"github.com/hadi77ir/muxedsocket/types"
 	"github.com/xtaci/smux"
-	"net"
 )
 
-func wrapConn(conn *smux.Session) types.MuxedSocket {
+func wrapConn(session *smux.Session, dialFunc types.MuxDialContextFunc) types.MuxedSocket {
 	return &Conn{
-		session: conn,
+		session:  session,
+		dialFunc: dialFunc,
 	}
 }
 
-func wrapListener(listener net.Listener, config *smux.Config) *Listener {
+func wrapListener(listener types.StreamListener, config *smux.Config) *Listener {
 	return &Listener{listener: listener, config: config}
 }
 
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/x509"
 	"encoding/hex"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"github.com/hadi77ir/muxedsocket"
@@ -23,6 +24,27 @@ const (
 	CertificatePinDigestMethodSeparator = ":"
 )
 
+var commonParametersHint = []utils.ParameterHint{
+	{Key: ParamNextProtos, Description: "ALPN protocols, comma-separated", Type: utils.ParameterTypeMultiString},
+	{Key: ParamCertificate, Description: "paths to certificates, comma-separated", Type: utils.ParameterTypeMultiString},
+	{Key: ParamPrivateKey, Description: "paths to private keys, comma-separated", Type: utils.ParameterTypeMultiString},
+}
+
+func ClientParametersHint() []utils.ParameterHint {
+	hints := append([]utils.ParameterHint{
+		{Key: ParamSNI, Description: "server name indication", Type: utils.ParameterTypeString},
+		{Key: ParamCertificatePin, Description: "pinned certificate digests as method:hex, comma-separated", Type: utils.ParameterTypeMultiString},
+		{Key: ParamInsecure, Description: "skip certificate verification", Type: utils.ParameterTypeBool, DefaultValue: "false"},
+	}, commonParametersHint...)
+	return append(hints, buildClientParametersHint...)
+}
+
+func ServerParametersHint() []utils.ParameterHint {
+	return append([]utils.ParameterHint{
+		{Key: ParamClientCA, Description: "paths to CA certificates for verifying clients, comma-separated", Type: utils.ParameterTypeMultiString},
+	}, commonParametersHint...)
+}
+
 func LoadCertPoolFromParams(parameters utils.Parameters, paramName string) (*x509.CertPool, int, error) {
 	pool := x509.NewCertPool()
 	certificates, err := LoadCertsFromParams(parameters, paramName)
@@ -41,11 +63,11 @@ func LoadCertsFromParams(parameters utils.Parameters, paramName string) ([]*x509
 	if found {
 		certs := []*x509.Certificate{}
 		for _, path := range pathsSplit {
-			contents, err := utils.ReadFile(path)
+			contents, err := utils.ReadPEMFile(path)
 			if err != nil {
 				return nil, err
 			}
-			newCerts, err := x509.ParseCertificates(contents)
+			newCerts, err := x509.ParseCertificates(derFromPEM(contents))
 			if err != nil {
 				return nil, err
 			}
@@ -56,6 +78,26 @@ func LoadCertsFromParams(parameters utils.Parameters, paramName string) ([]*x509
 	return nil, nil
 }
 
+// derFromPEM returns DER of certificates in contents if it is PEM, or contents itself otherwise.
+func derFromPEM(contents []byte) []byte {
+	var der []byte
+	rest := contents
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			der = append(der, block.Bytes...)
+		}
+	}
+	if der == nil {
+		return contents
+	}
+	return der
+}
+
 func LoadX509PairBytesFromParams(parameters utils.Parameters) (cert []byte, key []byte, err error) {
 	keyPath, keyPathFound := parameters.Get(ParamPrivateKey)
 	certPath, certPathFound := parameters.Get(ParamCertificate)
@@ -73,11 +115,11 @@ func LoadX509PairBytesFromParams(parameters utils.Parameters) (cert []byte, key
 }
 
 func LoadX509PairBytes(certPath, keyPath string) (cert []byte, key []byte, err error) {
-	key, err = utils.ReadFile(keyPath)
+	key, err = utils.ReadPEMFile(keyPath)
 	if err != nil {
 		return nil, nil, err
 	}
-	cert, err = utils.ReadFile(certPath)
+	cert, err = utils.ReadPEMFile(certPath)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -92,6 +134,10 @@ func LoadX509PairsBytesFromParams(parameters utils.Parameters) (certs [][]byte,
 	if !keyPathFound && certPathFound {
 		return nil, nil, muxedsocket.ErrMissingPart(ParamPrivateKey)
 	}
+	if !keyPathFound && !certPathFound {
+		// there is no error. as there was nothing to be loaded.
+		return nil, nil, nil
+	}
 	keyPaths := strings.Split(keyPath, muxedsocket.MultipleValuesSeparator)
 	certPaths := strings.Split(certPath, muxedsocket.MultipleValuesSeparator)
 	if len(keyPaths) > len(certPaths) {
@@ -104,7 +150,7 @@ func LoadX509PairsBytesFromParams(parameters utils.Parameters) (certs [][]byte,
 	certs = make([][]byte, pairCount)
 	keys = make([][]byte, pairCount)
 	for i := 0; i < len(keyPaths); i++ {
-		keys[i], certs[i], err = LoadX509PairBytes(certPaths[i], keyPaths[i])
+		certs[i], keys[i], err = LoadX509PairBytes(certPaths[i], keyPaths[i])
 		if err != nil {
 			return nil, nil, err
 		}
@@ -9,6 +9,9 @@ import (
 	"net"
 )
 
+// no extra parameters in this build.
+var buildClientParametersHint []utils.ParameterHint
+
 func ServerTLS(conn net.Conn, params any) net.Conn {
 	var config *tls.Config
 	if c, ok := params.(*tls.Config); ok {
@@ -25,6 +28,18 @@ func ClientTLS(conn net.Conn, params any) net.Conn {
 	return tls.Client(conn, config)
 }
 
+// configFromStandard returns what ClientTLS and ServerTLS of this build take as params.
+func configFromStandard(config *tls.Config) any {
+	return config
+}
+
+// StandardConfig returns the config that ParseTLS of this build gave as params, for users that only take a standard
+// library config, like QUIC.
+func StandardConfig(params any) *tls.Config {
+	config, _ := params.(*tls.Config)
+	return config
+}
+
 func ParseTLS(parameters utils.Parameters, isClient bool) (any, error) {
 	config := &tls.Config{
 		ServerName: GetSNIFromParams(parameters),
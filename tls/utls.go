@@ -4,6 +4,7 @@
 package tls
 
 import (
+	"crypto/tls"
 	"errors"
 	"github.com/hadi77ir/muxedsocket"
 	"github.com/hadi77ir/muxedsocket/utils"
@@ -14,6 +15,10 @@ import (
 
 var ErrProfileNotSupported = errors.New("profile not supported by uTLS library")
 
+var buildClientParametersHint = []utils.ParameterHint{
+	{Key: ParamHelloId, Description: "uTLS ClientHello profile to mimic", Type: utils.ParameterTypeString},
+}
+
 type TLSParams struct {
 	Config        *utls.Config
 	ClientHelloID utls.ClientHelloID
@@ -31,6 +36,76 @@ func ClientTLS(conn net.Conn, params any) net.Conn {
 	return utils.WrapLazyHandshakingConn(uconn, uconn.HandshakeContext)
 }
 
+// configFromStandard converts a standard library config into what ClientTLS and ServerTLS of this build take as params.
+// Only commonly used fields are carried over.
+func configFromStandard(config *tls.Config) any {
+	if config == nil {
+		return nil
+	}
+	certs := make([]utls.Certificate, len(config.Certificates))
+	for i, cert := range config.Certificates {
+		certs[i] = utls.Certificate{
+			Certificate:                 cert.Certificate,
+			PrivateKey:                  cert.PrivateKey,
+			OCSPStaple:                  cert.OCSPStaple,
+			SignedCertificateTimestamps: cert.SignedCertificateTimestamps,
+			Leaf:                        cert.Leaf,
+		}
+	}
+	return &TLSParams{
+		Config: &utls.Config{
+			Rand:                  config.Rand,
+			Time:                  config.Time,
+			Certificates:          certs,
+			RootCAs:               config.RootCAs,
+			NextProtos:            config.NextProtos,
+			ServerName:            config.ServerName,
+			ClientAuth:            utls.ClientAuthType(config.ClientAuth),
+			ClientCAs:             config.ClientCAs,
+			InsecureSkipVerify:    config.InsecureSkipVerify,
+			VerifyPeerCertificate: config.VerifyPeerCertificate,
+			MinVersion:            config.MinVersion,
+			MaxVersion:            config.MaxVersion,
+			KeyLogWriter:          config.KeyLogWriter,
+		},
+		ClientHelloID: utls.HelloGolang,
+	}
+}
+
+// StandardConfig converts params given by ParseTLS into a standard library config, for users that can't take anything
+// else, like QUIC. Like configFromStandard, only commonly used fields are carried over, and ClientHello profile is lost.
+func StandardConfig(params any) *tls.Config {
+	config, _ := GetParamsUTLS(params)
+	if config == nil {
+		return nil
+	}
+	certs := make([]tls.Certificate, len(config.Certificates))
+	for i, cert := range config.Certificates {
+		certs[i] = tls.Certificate{
+			Certificate:                 cert.Certificate,
+			PrivateKey:                  cert.PrivateKey,
+			OCSPStaple:                  cert.OCSPStaple,
+			SignedCertificateTimestamps: cert.SignedCertificateTimestamps,
+			Leaf:                        cert.Leaf,
+		}
+	}
+	return &tls.Config{
+		Rand:                  config.Rand,
+		Time:                  config.Time,
+		Certificates:          certs,
+		RootCAs:               config.RootCAs,
+		NextProtos:            config.NextProtos,
+		ServerName:            config.ServerName,
+		ClientAuth:            tls.ClientAuthType(config.ClientAuth),
+		ClientCAs:             config.ClientCAs,
+		InsecureSkipVerify:    config.InsecureSkipVerify,
+		VerifyPeerCertificate: config.VerifyPeerCertificate,
+		MinVersion:            config.MinVersion,
+		MaxVersion:            config.MaxVersion,
+		KeyLogWriter:          config.KeyLogWriter,
+	}
+}
+
 func ParseTLS(parameters utils.Parameters, isClient bool) (any, error) {
 	tlsParams := &TLSParams{
 		Config: &utls.Config{
@@ -1,6 +1,8 @@
 package tls
 
 import (
+	"context"
+	"crypto/tls"
 	"github.com/hadi77ir/muxedsocket/basics/stream"
 	"github.com/hadi77ir/muxedsocket/types"
 	"github.com/hadi77ir/muxedsocket/utils"
@@ -30,6 +32,20 @@ func (p *TLSImplementation) Server(conn types.StreamListenFunc, parameters utils
 	}, nil
 }
 
+func (p *TLSImplementation) ServerContext(conn types.StreamListenContextFunc, parameters utils.Parameters) (types.StreamListenContextFunc, error) {
+	params, err := p.configParserFunc(parameters, false)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) (types.StreamListener, error) {
+		listener, err := conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return WrapListener(listener, p.serverFunc, params)
+	}, nil
+}
+
 type ListenerWrapper struct {
 	listener   types.StreamListener
 	serverFunc StandardObfuscatorFunc
@@ -37,11 +53,11 @@ type ListenerWrapper struct {
 }
 
 func (w *ListenerWrapper) CloseChan() <-chan struct{} {
-	return w.CloseChan()
+	return w.listener.CloseChan()
 }
 
 func (w *ListenerWrapper) Close() error {
-	return w.Close()
+	return w.listener.Close()
 }
 
 func (w *ListenerWrapper) Accept() (socket types.Socket, err error) {
@@ -72,6 +88,51 @@ func (p *TLSImplementation) Client(conn types.StreamDialFunc, parameters utils.P
 	return wrapDialer(conn, p.clientFunc, params), nil
 }
 
+// ClientContext returns a dial function that completes the TLS handshake before returning, so that ctx bounds it too.
+func (p *TLSImplementation) ClientContext(conn types.StreamDialContextFunc, parameters utils.Parameters) (types.StreamDialContextFunc, error) {
+	params, err := p.configParserFunc(parameters, true)
+	if err != nil {
+		return nil, err
+	}
+	return wrapContextDialer(conn, p.clientFunc, params), nil
+}
+
+type handshakeContextConn interface {
+	HandshakeContext(ctx context.Context) error
+}
+
+func createTLSContextDialer(conn types.StreamDialContextFunc, obfuscatorFunc StandardObfuscatorFunc, parameters any) stream.StandardPrimedDialContextFunc {
+	return func(ctx context.Context) (net.Conn, error) {
+		c, err := conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		tlsConn := obfuscatorFunc(c, parameters)
+		if handshaker, ok := tlsConn.(handshakeContextConn); ok {
+			if err := handshaker.HandshakeContext(ctx); err != nil {
+				_ = tlsConn.Close()
+				return nil, err
+			}
+		}
+		return tlsConn, nil
+	}
+}
+
+func wrapContextDialer(conn types.StreamDialContextFunc, obfuscatorFunc StandardObfuscatorFunc, parameters any) types.StreamDialContextFunc {
+	dialer := createTLSContextDialer(conn, obfuscatorFunc, parameters)
+	// redialing happens later, outside the lifetime of dial context.
+	redialer := func() (net.Conn, error) {
+		return dialer(context.Background())
+	}
+	return func(ctx context.Context) (types.StreamConn, error) {
+		conn, err := dialer(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return stream.WrapConn(conn, redialer, nil), nil
+	}
+}
+
 func createTLSDialer(conn types.StreamDialFunc, obfuscatorFunc StandardObfuscatorFunc, parameters any) stream.StandardPrimedDialFunc {
 	return func() (net.Conn, error) {
 		c, err := conn()
@@ -92,7 +153,17 @@ func wrapDialer(conn types.StreamDialFunc, obfuscatorFunc StandardObfuscatorFunc
 	}
 }
 
+func (p *TLSImplementation) ClientParametersHint() []utils.ParameterHint {
+	return ClientParametersHint()
+}
+
+func (p *TLSImplementation) ServerParametersHint() []utils.ParameterHint {
+	return ServerParametersHint()
+}
+
 var _ types.StreamObfuscatorImplementation = &TLSImplementation{}
+var _ types.HasParametersHint = &TLSImplementation{}
+var _ types.StreamObfuscatorContextImplementation = &TLSImplementation{}
 
 func WrapImplementation(client, server StandardObfuscatorFunc, configFunc StandardParseConfigFunc) *TLSImplementation {
 	return &TLSImplementation{clientFunc: client, serverFunc: server, configParserFunc: configFunc}
@@ -101,3 +172,11 @@ func WrapImplementation(client, server StandardObfuscatorFunc, configFunc Standa
 func NewTLSImplementation() types.StreamObfuscatorImplementation {
 	return WrapImplementation(ClientTLS, ServerTLS, ParseTLS)
 }
+
+// NewTLSImplementationWithConfig returns an implementation that always uses given config and ignores parameters.
+func NewTLSImplementationWithConfig(config *tls.Config) types.StreamObfuscatorImplementation {
+	params := configFromStandard(config)
+	return WrapImplementation(ClientTLS, ServerTLS, func(parameters utils.Parameters, isClient bool) (any, error) {
+		return params, nil
+	})
+}
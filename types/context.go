@@ -0,0 +1,102 @@
+package types
+
+import (
+	"context"
+	"io"
+)
+
+// awaitResult is declared outside of AwaitWithContext, as go1.19 doesn't allow type declarations in generic functions.
+type awaitResult[T any] struct {
+	value T
+	err   error
+}
+
+// AwaitWithContext runs fn and waits for it to return, unless ctx is done first. In that case the result is
+// discarded once it arrives, closing it if it was successfully established.
+func AwaitWithContext[T io.Closer](ctx context.Context, fn func() (T, error)) (T, error) {
+	var none T
+	if err := ctx.Err(); err != nil {
+		return none, err
+	}
+	if ctx.Done() == nil {
+		// context can never be cancelled.
+		return fn()
+	}
+	channel := make(chan awaitResult[T], 1)
+	go func() {
+		value, err := fn()
+		channel <- awaitResult[T]{value: value, err: err}
+	}()
+	select {
+	case r := <-channel:
+		return r.value, r.err
+	case <-ctx.Done():
+		go func() {
+			r := <-channel
+			if r.err == nil && any(r.value) != nil {
+				_ = r.value.Close()
+			}
+		}()
+		return none, ctx.Err()
+	}
+}
+
+func (f PacketConnFunc) WithContext() PacketConnContextFunc {
+	return func(ctx context.Context) (PacketConn, error) {
+		return AwaitWithContext[PacketConn](ctx, f)
+	}
+}
+
+func (f PacketConnContextFunc) WithoutContext() PacketConnFunc {
+	return func() (PacketConn, error) {
+		return f(context.Background())
+	}
+}
+
+func (f StreamDialFunc) WithContext() StreamDialContextFunc {
+	return func(ctx context.Context) (StreamConn, error) {
+		return AwaitWithContext[StreamConn](ctx, f)
+	}
+}
+
+func (f StreamDialContextFunc) WithoutContext() StreamDialFunc {
+	return func() (StreamConn, error) {
+		return f(context.Background())
+	}
+}
+
+func (f StreamListenFunc) WithContext() StreamListenContextFunc {
+	return func(ctx context.Context) (StreamListener, error) {
+		return AwaitWithContext[StreamListener](ctx, f)
+	}
+}
+
+func (f StreamListenContextFunc) WithoutContext() StreamListenFunc {
+	return func() (StreamListener, error) {
+		return f(context.Background())
+	}
+}
+
+func (f MuxDialFunc) WithContext() MuxDialContextFunc {
+	return func(ctx context.Context) (MuxedSocket, error) {
+		return AwaitWithContext[MuxedSocket](ctx, f)
+	}
+}
+
+func (f MuxDialContextFunc) WithoutContext() MuxDialFunc {
+	return func() (MuxedSocket, error) {
+		return f(context.Background())
+	}
+}
+
+func (f MuxListenFunc) WithContext() MuxListenContextFunc {
+	return func(ctx context.Context) (MuxedListener, error) {
+		return AwaitWithContext[MuxedListener](ctx, f)
+	}
+}
+
+func (f MuxListenContextFunc) WithoutContext() MuxListenFunc {
+	return func() (MuxedListener, error) {
+		return f(context.Background())
+	}
+}
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"context"
 	"github.com/hadi77ir/muxedsocket/utils"
 )
 
@@ -14,6 +15,14 @@ type MuxListenFunc func() (MuxedListener, error)
 type MuxDialFunc func() (MuxedSocket, error)
 type MuxStreamConnectFunc func() (MuxStream, error)
 
+// Context-aware counterparts of the functions above. The context bounds establishing the connection (or listener),
+// not its lifetime.
+type PacketConnContextFunc func(ctx context.Context) (PacketConn, error)
+type StreamDialContextFunc func(ctx context.Context) (StreamConn, error)
+type StreamListenContextFunc func(ctx context.Context) (StreamListener, error)
+type MuxListenContextFunc func(ctx context.Context) (MuxedListener, error)
+type MuxDialContextFunc func(ctx context.Context) (MuxedSocket, error)
+
 type PacketConnImplementation interface {
 	Server(addr string, parameters utils.Parameters) (PacketConnFunc, error)
 	Client(addr string, parameters utils.Parameters) (PacketConnFunc, error)
@@ -64,3 +73,51 @@ type HasParametersHint interface {
 	ClientParametersHint() []utils.ParameterHint
 	ServerParametersHint() []utils.ParameterHint
 }
+
+// Implementations may additionally satisfy the following context-aware interfaces. When they do, chaining prefers them
+// over the plain ones, so cancellation reaches every layer of the chain instead of only the outermost one.
+
+type PacketConnContextImplementation interface {
+	ServerContext(addr string, parameters utils.Parameters) (PacketConnContextFunc, error)
+	ClientContext(addr string, parameters utils.Parameters) (PacketConnContextFunc, error)
+}
+
+type StreamConnContextImplementation interface {
+	ServerContext(addr string, parameters utils.Parameters) (StreamListenContextFunc, error)
+	ClientContext(addr string, parameters utils.Parameters) (StreamDialContextFunc, error)
+}
+
+type AddrSolutionContextImplementation interface {
+	ServerContext(addr string, parameters utils.Parameters) (MuxListenContextFunc, error)
+	ClientContext(addr string, parameters utils.Parameters) (MuxDialContextFunc, error)
+}
+
+type StreamAdapterContextImplementation interface {
+	ServerContext(conn PacketConnContextFunc, parameters utils.Parameters) (StreamListenContextFunc, error)
+	ClientContext(conn PacketConnContextFunc, parameters utils.Parameters) (StreamDialContextFunc, error)
+}
+
+type PacketAdapterContextImplementation interface {
+	ServerContext(listener StreamListenContextFunc, parameters utils.Parameters) (PacketConnContextFunc, error)
+	ClientContext(dialFunc StreamDialContextFunc, parameters utils.Parameters) (PacketConnContextFunc, error)
+}
+
+type StreamObfuscatorContextImplementation interface {
+	ServerContext(conn StreamListenContextFunc, parameters utils.Parameters) (StreamListenContextFunc, error)
+	ClientContext(conn StreamDialContextFunc, parameters utils.Parameters) (StreamDialContextFunc, error)
+}
+
+type PacketObfuscatorContextImplementation interface {
+	ServerContext(conn PacketConnContextFunc, parameters utils.Parameters) (PacketConnContextFunc, error)
+	ClientContext(conn PacketConnContextFunc, parameters utils.Parameters) (PacketConnContextFunc, error)
+}
+
+type PacketSolutionContextImplementation interface {
+	ServerContext(conn PacketConnContextFunc, parameters utils.Parameters) (MuxListenContextFunc, error)
+	ClientContext(conn PacketConnContextFunc, parameters utils.Parameters) (MuxDialContextFunc, error)
+}
+
+type StreamSolutionContextImplementation interface {
+	ServerContext(conn StreamListenContextFunc, parameters utils.Parameters) (MuxListenContextFunc, error)
+	ClientContext(conn StreamDialContextFunc, parameters utils.Parameters) (MuxDialContextFunc, error)
+}
@@ -36,3 +36,12 @@ func ReadFile(path string) ([]byte, error) {
 	}
 	return os.ReadFile(path)
 }
+
+// ReadPEMFile is ReadFile for values that hold PEM: PEM contents, which "env:" and "file:" references resolve to, are
+// returned as is.
+func ReadPEMFile(path string) ([]byte, error) {
+	if strings.Contains(path, "-----BEGIN ") {
+		return []byte(path), nil
+	}
+	return ReadFile(path)
+}
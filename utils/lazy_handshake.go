@@ -9,14 +9,15 @@ import (
 
 type LazyHandshakeConn struct {
 	net.Conn
-	handshakeFn      func(ctx context.Context) error
-	handshakeStarted atomic.Bool
-	handshakeDone    chan struct{}
-	handshakeContext context.Context
+	handshakeFn       func(ctx context.Context) error
+	handshakeStarted  atomic.Bool
+	handshakeDone     chan struct{}
+	handshakeErr      error
+	handshakeDeadline time.Time
 }
 
 func (c *LazyHandshakeConn) SetDeadline(t time.Time) error {
-	c.handshakeContext, _ = context.WithDeadline(context.Background(), t)
+	c.handshakeDeadline = t
 	return c.Conn.SetDeadline(t)
 }
 
@@ -34,17 +35,35 @@ func (c *LazyHandshakeConn) Write(b []byte) (n int, err error) {
 	return c.Conn.Write(b)
 }
 
-func (c *LazyHandshakeConn) guardedHandshake() error {
+// HandshakeContext runs the handshake now instead of on first Read or Write, bounded by ctx. If the handshake was
+// already started, it waits for it to finish and returns its result.
+func (c *LazyHandshakeConn) HandshakeContext(ctx context.Context) error {
 	oldState := c.handshakeStarted.Swap(true)
 	if oldState == false {
-		return c.handshakeFn(c.handshakeContext)
+		c.handshakeErr = c.handshakeFn(ctx)
+		close(c.handshakeDone)
+		return c.handshakeErr
+	}
+	select {
+	case <-c.handshakeDone:
+		return c.handshakeErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *LazyHandshakeConn) guardedHandshake() error {
+	ctx := context.Background()
+	if !c.handshakeDeadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.handshakeDeadline)
+		defer cancel()
 	}
-	<-c.handshakeDone
-	return nil
+	return c.HandshakeContext(ctx)
 }
 
 var _ net.Conn = &LazyHandshakeConn{}
 
 func WrapLazyHandshakingConn(conn net.Conn, handshakeFn func(ctx context.Context) error) net.Conn {
-	return &LazyHandshakeConn{Conn: conn, handshakeFn: handshakeFn, handshakeDone: make(chan struct{}, 1), handshakeContext: context.Background()}
+	return &LazyHandshakeConn{Conn: conn, handshakeFn: handshakeFn, handshakeDone: make(chan struct{}, 1)}
 }
@@ -15,7 +15,7 @@ type Parameters map[string]string
 type ParameterType int
 
 const (
-	ParameterTypeInt = iota
+	ParameterTypeInt ParameterType = iota
 	ParameterTypeBool
 	ParameterTypeDuration
 	ParameterTypeDurationFalse
@@ -23,12 +23,54 @@ const (
 	ParameterTypeMultiString
 )
 
+var parameterTypeNames = map[ParameterType]string{
+	ParameterTypeInt:           "int",
+	ParameterTypeBool:          "bool",
+	ParameterTypeDuration:      "duration",
+	ParameterTypeDurationFalse: "duration|false",
+	ParameterTypeString:        "string",
+	ParameterTypeMultiString:   "multistring",
+}
+
+func (t ParameterType) String() string {
+	if name, found := parameterTypeNames[t]; found {
+		return name
+	}
+	return fmt.Sprintf("ParameterType(%d)", int(t))
+}
+
+func (t ParameterType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// CheckValue returns an error if value can't be parsed as this type. Error doesn't include value, as it may be a
+// secret.
+func (t ParameterType) CheckValue(value string) error {
+	var err error
+	switch t {
+	case ParameterTypeInt:
+		_, err = strconv.Atoi(value)
+	case ParameterTypeBool:
+		_, err = ParseBool(value)
+	case ParameterTypeDuration:
+		_, err = time.ParseDuration(value)
+	case ParameterTypeDurationFalse:
+		if !StrIsFalse(value) {
+			_, err = time.ParseDuration(value)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("expected %s", t)
+	}
+	return nil
+}
+
 // ParameterHint contains info on how a parameter
 type ParameterHint struct {
-	Key          string
-	Description  string
-	Type         ParameterType
-	DefaultValue string
+	Key          string        `json:"key"`
+	Description  string        `json:"description,omitempty"`
+	Type         ParameterType `json:"type"`
+	DefaultValue string        `json:"default,omitempty"`
 }
 
 // Todo: was this necessary?
@@ -37,7 +79,7 @@ func TryGetParamsSectionIndex(indexedSchemePart string) (string, int, bool) {
 		openingIndex := strings.LastIndex(indexedSchemePart, "[")
 		if openingIndex != -1 {
 			// now get what's in between
-			between := indexedSchemePart[openingIndex : len(indexedSchemePart)-1]
+			between := indexedSchemePart[openingIndex+1 : len(indexedSchemePart)-1]
 			value, err := strconv.Atoi(between)
 			if err != nil {
 				return indexedSchemePart, 0, false
@@ -156,16 +198,18 @@ func (p Parameters) Section(section string) Parameters {
 	return newP
 }
 
+// SectionWithCommon returns parameters of section along with common ones, which have no section. Keys given both ways
+// take the value of section.
 func (p Parameters) SectionWithCommon(section string) Parameters {
 	newP := make(map[string]string)
-	prefix := strings.TrimRight(section, ".") + "."
 	for key, value := range p {
-		if strings.HasPrefix(key, prefix) || !strings.ContainsAny(key, ".") {
-			if value != "" {
-				newP[key[len(prefix):]] = value
-			}
+		if value != "" && !strings.ContainsAny(key, ".") {
+			newP[key] = value
 		}
 	}
+	for key, value := range p.Section(section) {
+		newP[key] = value
+	}
 	return newP
 }
 
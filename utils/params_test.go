@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestSectionWithCommonPrefersSection(t *testing.T) {
+	p := Parameters{"sni": "a", "tls[0].sni": "b", "alpn": "h2", "tls[1].sni": "c", "quic[0].sni": "d"}
+	// map iteration order varies, so try a few times.
+	for i := 0; i < 20; i++ {
+		section := p.SectionWithCommon("tls[0]")
+		if section["sni"] != "b" || section["alpn"] != "h2" || len(section) != 2 {
+			t.Fatal(section)
+		}
+	}
+	if section := p.SectionWithCommon("tls[2]"); section["sni"] != "a" || len(section) != 2 {
+		t.Fatal(section)
+	}
+}
@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+type queuedPacket struct {
+	payload []byte
+	addr    net.Addr
+}
+
+// Deadline gives out a channel that is closed once the time set on it passes.
+type Deadline struct {
+	mutex   sync.Mutex
+	timer   *time.Timer
+	expired chan struct{}
+}
+
+func NewDeadline() *Deadline {
+	return &Deadline{expired: make(chan struct{})}
+}
+
+// Set arms deadline for t. Zero t disarms it.
+func (d *Deadline) Set(t time.Time) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	stale := false
+	if d.timer != nil {
+		// if timer has fired (or is firing), its channel is closed (or about to be).
+		stale = !d.timer.Stop()
+		d.timer = nil
+	}
+	select {
+	case <-d.expired:
+		stale = true
+	default:
+	}
+	if stale {
+		d.expired = make(chan struct{})
+	}
+	if t.IsZero() {
+		return
+	}
+	wait := time.Until(t)
+	if wait <= 0 {
+		close(d.expired)
+		return
+	}
+	expired := d.expired
+	d.timer = time.AfterFunc(wait, func() {
+		close(expired)
+	})
+}
+
+// Done returns a channel that is closed once deadline passes.
+func (d *Deadline) Done() <-chan struct{} {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.expired
+}
+
+// PacketQueue is the reading half of a packet connection whose packets are received in background, for example from
+// several streams at once. It implements ReadFrom, CloseChan and deadlines of types.PacketConn. Write deadline is only
+// stored, for writers to apply.
+type PacketQueue struct {
+	incoming      chan queuedPacket
+	closed        chan struct{}
+	closeOnce     sync.Once
+	readDeadline  *Deadline
+	deadlineMutex sync.Mutex
+	writeDeadline time.Time
+}
+
+// NewPacketQueue creates a queue holding up to size packets that are not read yet.
+func NewPacketQueue(size int) *PacketQueue {
+	return &PacketQueue{
+		incoming:     make(chan queuedPacket, size),
+		closed:       make(chan struct{}),
+		readDeadline: NewDeadline(),
+	}
+}
+
+func (q *PacketQueue) ReadFrom(p []byte) (int, net.Addr, error) {
+	select {
+	case <-q.closed:
+		return 0, nil, net.ErrClosed
+	default:
+	}
+	select {
+	case received := <-q.incoming:
+		return copy(p, received.payload), received.addr, nil
+	case <-q.closed:
+		return 0, nil, net.ErrClosed
+	case <-q.readDeadline.Done():
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+// Deliver queues a received packet, waiting for room unless queue gets shut down. It returns false in that case.
+func (q *PacketQueue) Deliver(payload []byte, addr net.Addr) bool {
+	select {
+	case q.incoming <- queuedPacket{payload: payload, addr: addr}:
+		return true
+	case <-q.closed:
+		return false
+	}
+}
+
+// TryDeliver queues a received packet if there is room, and drops it otherwise, as a congested network would. It
+// returns false if queue is shut down.
+func (q *PacketQueue) TryDeliver(payload []byte, addr net.Addr) bool {
+	select {
+	case <-q.closed:
+		return false
+	default:
+	}
+	select {
+	case q.incoming <- queuedPacket{payload: payload, addr: addr}:
+	case <-q.closed:
+		return false
+	default:
+	}
+	return true
+}
+
+// Shutdown wakes up readers and makes further reads fail. It returns true only the first time it is called, so that
+// the caller knows it is the one to release resources.
+func (q *PacketQueue) Shutdown() bool {
+	first := false
+	q.closeOnce.Do(func() {
+		close(q.closed)
+		first = true
+	})
+	return first
+}
+
+func (q *PacketQueue) IsClosed() bool {
+	select {
+	case <-q.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *PacketQueue) CloseChan() <-chan struct{} {
+	return q.closed
+}
+
+func (q *PacketQueue) SetDeadline(t time.Time) error {
+	_ = q.SetReadDeadline(t)
+	return q.SetWriteDeadline(t)
+}
+
+func (q *PacketQueue) SetReadDeadline(t time.Time) error {
+	q.readDeadline.Set(t)
+	return nil
+}
+
+func (q *PacketQueue) SetWriteDeadline(t time.Time) error {
+	q.deadlineMutex.Lock()
+	defer q.deadlineMutex.Unlock()
+	q.writeDeadline = t
+	return nil
+}
+
+// WriteDeadline returns what was last set by SetWriteDeadline or SetDeadline.
+func (q *PacketQueue) WriteDeadline() time.Time {
+	q.deadlineMutex.Lock()
+	defer q.deadlineMutex.Unlock()
+	return q.writeDeadline
+}
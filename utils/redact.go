@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+)
+
+const RedactedValue = "REDACTED"
+
+// SensitiveKeys are parameter keys whose values are always redacted, regardless of their section.
+var SensitiveKeys = []string{"key", "psk", "password", "passphrase", "secret", "token"}
+
+// inline encodings understood by ReadFile carry the secret itself.
+var inlinePrefixes = []string{"base64:", "base32:"}
+
+func isSensitive(resolvers *Registry[ValueResolver], key string, value string) bool {
+	if dot := strings.LastIndex(key, "."); dot != -1 {
+		key = key[dot+1:]
+	}
+	key = strings.ToLower(key)
+	for _, sensitive := range SensitiveKeys {
+		if key == sensitive {
+			return true
+		}
+	}
+	for _, prefix := range inlinePrefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return IsReference(resolvers, value)
+}
+
+// Redacted returns a copy of parameters, suitable for printing, in which values of sensitive keys, inline encoded
+// values and references are replaced with RedactedValue.
+func (p Parameters) Redacted(resolvers *Registry[ValueResolver]) Parameters {
+	redacted := make(Parameters, len(p))
+	for key, value := range p {
+		redacted[key] = RedactValue(resolvers, key, value)
+	}
+	return redacted
+}
+
+// RedactValue returns value of key as Parameters.Redacted would print it.
+func RedactValue(resolvers *Registry[ValueResolver], key string, value string) string {
+	if isSensitive(resolvers, key, value) {
+		return RedactedValue
+	}
+	return value
+}
+
+// RedactURI redacts the query of uri the same way Parameters.Redacted does. Password of userinfo is redacted as well.
+func RedactURI(resolvers *Registry[ValueResolver], uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return RedactedValue
+	}
+	if _, hasPassword := parsed.User.Password(); hasPassword {
+		parsed.User = url.UserPassword(parsed.User.Username(), RedactedValue)
+	}
+	query := parsed.Query()
+	for key, values := range query {
+		for i, value := range values {
+			if isSensitive(resolvers, key, value) {
+				values[i] = RedactedValue
+			}
+		}
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
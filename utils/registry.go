@@ -1,41 +1,95 @@
 package utils
 
-type Registry[T any] struct {
-	_initialized bool
-	creators     map[string]T
-}
+import "sync"
 
-func (r *Registry[T]) init() {
-	r.creators = make(map[string]T)
-	r._initialized = true
+// Registry maps names to implementations. It is safe for concurrent use, and its zero value is ready to use.
+type Registry[T any] struct {
+	mutex    sync.RWMutex
+	creators map[string]T
+	aliases  map[string]string
 }
 
+// Register registers value with given name, replacing whatever was registered or aliased with it before.
 func (r *Registry[T]) Register(name string, value T) {
-	if !r._initialized {
-		r.init()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.creators == nil {
+		r.creators = make(map[string]T)
 	}
+	delete(r.aliases, name)
 	r.creators[name] = value
 }
-func (r *Registry[T]) Get(name string) (T, bool) {
-	if !r._initialized {
-		r.init()
+
+// Alias makes alias another name for name. The alias follows name, so registering name again changes what the alias
+// gets too. An alias may point to another alias; an alias that ends up pointing to itself gets nothing.
+func (r *Registry[T]) Alias(alias string, name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.aliases == nil {
+		r.aliases = make(map[string]string)
 	}
-	if value, ok := r.creators[name]; ok {
-		return value, true
+	delete(r.creators, alias)
+	r.aliases[alias] = name
+}
+
+// Unregister removes the implementation or alias registered with given name, if any. Aliases pointing to it are
+// kept, but get nothing until name is registered again.
+func (r *Registry[T]) Unregister(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.creators, name)
+	delete(r.aliases, name)
+}
+
+// Get returns the implementation registered with given name, following aliases.
+func (r *Registry[T]) Get(name string) (T, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	// each alias is followed at most once, which stops at cycles.
+	for i := 0; i <= len(r.aliases); i++ {
+		if value, ok := r.creators[name]; ok {
+			return value, true
+		}
+		target, isAlias := r.aliases[name]
+		if !isAlias {
+			break
+		}
+		name = target
 	}
 	var none T
 	return none, false
 }
 
+// Keys returns names of registered implementations and aliases.
 func (r *Registry[T]) Keys() []string {
-	if !r._initialized {
-		r.init()
-	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
 	i := 0
-	keys := make([]string, len(r.creators))
+	keys := make([]string, len(r.creators)+len(r.aliases))
 	for k := range r.creators {
 		keys[i] = k
 		i++
 	}
+	for k := range r.aliases {
+		keys[i] = k
+		i++
+	}
 	return keys
 }
+
+// Clone returns a registry holding the same entries and aliases. Changes to either one don't affect the other.
+func (r *Registry[T]) Clone() *Registry[T] {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	clone := &Registry[T]{
+		creators: make(map[string]T, len(r.creators)),
+		aliases:  make(map[string]string, len(r.aliases)),
+	}
+	for name, value := range r.creators {
+		clone.creators[name] = value
+	}
+	for alias, name := range r.aliases {
+		clone.aliases[alias] = name
+	}
+	return clone
+}
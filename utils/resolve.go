@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var ErrValueNotFound = errors.New("referenced value not found")
+
+// ValueResolver returns the value that a reference points to. Reference is the part of a parameter value after the
+// scheme, like "HOME" in "env:HOME".
+type ValueResolver func(reference string) (string, error)
+
+// ResolveEnv resolves "env:NAME" to the value of environment variable NAME.
+func ResolveEnv(reference string) (string, error) {
+	if value, found := os.LookupEnv(reference); found {
+		return value, nil
+	}
+	return "", ErrValueNotFound
+}
+
+// ResolveFile resolves "file:path" to contents of the file.
+func ResolveFile(reference string) (string, error) {
+	contents, err := os.ReadFile(reference)
+	if err != nil {
+		return "", err
+	}
+	return string(contents), nil
+}
+
+// ResolveHex resolves "hex:..." to the bytes it encodes.
+func ResolveHex(reference string) (string, error) {
+	decoded, err := hex.DecodeString(reference)
+	if err != nil {
+		return "", err
+	}
+	return string(decoded), nil
+}
+
+// RegisterDefaultResolvers registers "env", "file" and "hex" resolvers.
+func RegisterDefaultResolvers(resolvers *Registry[ValueResolver]) {
+	resolvers.Register("env", ResolveEnv)
+	resolvers.Register("file", ResolveFile)
+	resolvers.Register("hex", ResolveHex)
+}
+
+func findResolver(resolvers *Registry[ValueResolver], value string) (ValueResolver, string, bool) {
+	if resolvers == nil {
+		return nil, "", false
+	}
+	colon := strings.Index(value, ":")
+	if colon < 1 {
+		return nil, "", false
+	}
+	resolver, found := resolvers.Get(value[:colon])
+	if !found || resolver == nil {
+		return nil, "", false
+	}
+	return resolver, value[colon+1:], true
+}
+
+// IsReference reports whether value, or any of its comma-separated elements, starts with the scheme of one of the
+// resolvers, like "env:".
+func IsReference(resolvers *Registry[ValueResolver], value string) bool {
+	for _, element := range strings.Split(value, ",") {
+		if _, _, found := findResolver(resolvers, element); found {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveValue returns what value refers to, or value itself if it is not a reference. Comma-separated values, like
+// "env:A,env:B", are resolved element by element.
+func ResolveValue(resolvers *Registry[ValueResolver], value string) (string, error) {
+	if !IsReference(resolvers, value) {
+		return value, nil
+	}
+	elements := strings.Split(value, ",")
+	for i, element := range elements {
+		resolver, reference, found := findResolver(resolvers, element)
+		if !found {
+			continue
+		}
+		resolved, err := resolver(reference)
+		if err != nil {
+			return "", err
+		}
+		elements[i] = resolved
+	}
+	return strings.Join(elements, ","), nil
+}
+
+// Resolve returns a copy of parameters with references replaced by what they refer to. Errors name the key, but never
+// the value.
+func (p Parameters) Resolve(resolvers *Registry[ValueResolver]) (Parameters, error) {
+	resolved := make(Parameters, len(p))
+	for key, value := range p {
+		value, err := ResolveValue(resolvers, value)
+		if err != nil {
+			return nil, fmt.Errorf("resolving parameter %q: %w", key, err)
+		}
+		resolved[key] = value
+	}
+	return resolved, nil
+}
@@ -0,0 +1,59 @@
+package muxedsocket
+
+import (
+	"github.com/hadi77ir/muxedsocket/chaining"
+	"github.com/hadi77ir/muxedsocket/utils"
+	"net/url"
+)
+
+func validateURL(creators *Creators, addr *url.URL, server bool) error {
+	return chaining.ValidateMuxLayersParameters(creators, GetDefaults(creators), GetSchemeParts(addr.Scheme), utils.ParametersFromURL(addr.Query()), server)
+}
+
+// validateIfStrict validates parameters only if strict mode is enabled through ParamStrict.
+func validateIfStrict(creators *Creators, addr *url.URL, server bool) error {
+	if !utils.BoolFromParameters(utils.ParametersFromURL(addr.Query()), ParamStrict, false) {
+		return nil
+	}
+	return validateURL(creators, addr, server)
+}
+
+// ValidateDialURIWithRegistry checks parameters of the URI against hints of the layers that dialing it would use,
+// as strict mode does. Every problem is reported in a single ErrInvalidParameters.
+func ValidateDialURIWithRegistry(creators *Creators, uri string) error {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	return validateURL(creators, parsed, false)
+}
+
+func ValidateDialURI(uri string) error {
+	return ValidateDialURIWithRegistry(creators, uri)
+}
+
+// ValidateListenURIWithRegistry is like ValidateDialURIWithRegistry, but checks against server side hints.
+func ValidateListenURIWithRegistry(creators *Creators, uri string) error {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	return validateURL(creators, parsed, true)
+}
+
+func ValidateListenURI(uri string) error {
+	return ValidateListenURIWithRegistry(creators, uri)
+}
+
+// ParametersHelpWithRegistry lists parameters of the layers used by scheme, or of every registered implementation
+// if scheme is empty. Render it with chaining.WriteReferenceText or chaining.WriteReferenceJSON.
+func ParametersHelpWithRegistry(creators *Creators, scheme string) ([]chaining.ImplementationReference, error) {
+	if scheme == "" {
+		return chaining.ParametersReference(creators), nil
+	}
+	return chaining.SchemeParametersReference(creators, GetDefaults(creators), GetSchemeParts(scheme))
+}
+
+func ParametersHelp(scheme string) ([]chaining.ImplementationReference, error) {
+	return ParametersHelpWithRegistry(creators, scheme)
+}
@@ -2,18 +2,52 @@ package yamux
 
 import (
 	"github.com/hadi77ir/muxedsocket"
+	"github.com/hadi77ir/muxedsocket/utils"
 	Y "github.com/hashicorp/yamux"
 	"io"
+	"time"
 )
 
-// getConfig creates a new instance of Config, with prefilled values.
-func getConfig(params muxedsocket.CommonParams) *Y.Config {
+const (
+	ParamAcceptBacklog      = "acceptbacklog"
+	ParamMaxStreamWindow    = "maxstreamwindow"
+	ParamWriteTimeout       = "writetimeout"
+	ParamStreamOpenTimeout  = "streamopentimeout"
+	ParamStreamCloseTimeout = "streamclosetimeout"
+
+	DefaultAcceptBacklog      = 256
+	DefaultMaxStreamWindow    = 256 * 1024
+	DefaultWriteTimeout       = 10 * time.Second
+	DefaultStreamOpenTimeout  = 75 * time.Second
+	DefaultStreamCloseTimeout = 5 * time.Minute
+)
+
+var parametersHint = []utils.ParameterHint{
+	{Key: ParamAcceptBacklog, Description: "streams waiting to be accepted", Type: utils.ParameterTypeInt, DefaultValue: "256"},
+	{Key: ParamMaxStreamWindow, Description: "largest window of a stream, at least 262144", Type: utils.ParameterTypeInt, DefaultValue: "262144"},
+	{Key: ParamWriteTimeout, Description: "write timeout, after which connection is assumed broken", Type: utils.ParameterTypeDuration, DefaultValue: DefaultWriteTimeout.String()},
+	{Key: ParamStreamOpenTimeout, Description: "wait for peer to acknowledge a new stream", Type: utils.ParameterTypeDuration, DefaultValue: DefaultStreamOpenTimeout.String()},
+	{Key: ParamStreamCloseTimeout, Description: "wait for a half-closed stream before resetting it", Type: utils.ParameterTypeDuration, DefaultValue: DefaultStreamCloseTimeout.String()},
+}
+
+// getConfig creates a new instance of Config from parameters, and verifies it.
+func getConfig(parameters utils.Parameters) (*Y.Config, error) {
 	config := Y.DefaultConfig()
 	// discard logs
 	config.LogOutput = io.Discard
-	config.ConnectionWriteTimeout = params.MaxIdleTimeout
-	config.EnableKeepAlive = params.KeepalivePeriod >= 0 && params.MaxIdleTimeout >= params.KeepalivePeriod
-	config.KeepAliveInterval = params.KeepalivePeriod
-	config.StreamCloseTimeout = params.MaxIdleTimeout
-	return config
+	if interval, _ := muxedsocket.KeepAliveFromParameters(parameters); interval > 0 {
+		config.KeepAliveInterval = interval
+	} else {
+		// interval has to stay valid, even if unused.
+		config.EnableKeepAlive = false
+	}
+	config.AcceptBacklog = utils.IntegerFromParameters(parameters, ParamAcceptBacklog, DefaultAcceptBacklog)
+	config.MaxStreamWindowSize = uint32(utils.IntegerFromParameters(parameters, ParamMaxStreamWindow, DefaultMaxStreamWindow))
+	config.ConnectionWriteTimeout = utils.DurationFromParameters(parameters, ParamWriteTimeout, DefaultWriteTimeout)
+	config.StreamOpenTimeout = utils.DurationFromParameters(parameters, ParamStreamOpenTimeout, DefaultStreamOpenTimeout)
+	config.StreamCloseTimeout = utils.DurationFromParameters(parameters, ParamStreamCloseTimeout, DefaultStreamCloseTimeout)
+	if err := Y.VerifyConfig(config); err != nil {
+		return nil, err
+	}
+	return config, nil
 }
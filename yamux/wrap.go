@@ -3,16 +3,16 @@ package yamux
 import (
 	"github.com/hadi77ir/muxedsocket/types"
 	Y "github.com/hashicorp/yamux"
-	"net"
 )
 
-func wrapConn(conn *Y.Session) types.MuxedSocket {
+func wrapConn(session *Y.Session, dialFunc types.MuxDialContextFunc) types.MuxedSocket {
 	return &Conn{
-		session: conn,
+		session:  session,
+		dialFunc: dialFunc,
 	}
 }
 
-func wrapListener(listener net.Listener, config *Y.Config) *Listener {
+func wrapListener(listener types.StreamListener, config *Y.Config) *Listener {
 	return &Listener{listener: listener, config: config}
 }
 
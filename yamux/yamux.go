@@ -0,0 +1,75 @@
+package yamux
+
+import (
+	"context"
+	"github.com/hadi77ir/muxedsocket/types"
+	"github.com/hadi77ir/muxedsocket/utils"
+	Y "github.com/hashicorp/yamux"
+)
+
+type Implementation struct {
+	// nothing.
+}
+
+var _ types.StreamSolutionImplementation = &Implementation{}
+var _ types.StreamSolutionContextImplementation = &Implementation{}
+var _ types.HasParametersHint = &Implementation{}
+
+func (i *Implementation) Server(conn types.StreamListenFunc, parameters utils.Parameters) (types.MuxListenFunc, error) {
+	listenFunc, err := i.ServerContext(conn.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return listenFunc.WithoutContext(), nil
+}
+
+func (i *Implementation) Client(conn types.StreamDialFunc, parameters utils.Parameters) (types.MuxDialFunc, error) {
+	dialFunc, err := i.ClientContext(conn.WithContext(), parameters)
+	if err != nil {
+		return nil, err
+	}
+	return dialFunc.WithoutContext(), nil
+}
+
+func (i *Implementation) ServerContext(conn types.StreamListenContextFunc, parameters utils.Parameters) (types.MuxListenContextFunc, error) {
+	config, err := getConfig(parameters)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) (types.MuxedListener, error) {
+		listener, err := conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return wrapListener(listener, config), nil
+	}, nil
+}
+
+func (i *Implementation) ClientContext(conn types.StreamDialContextFunc, parameters utils.Parameters) (types.MuxDialContextFunc, error) {
+	config, err := getConfig(parameters)
+	if err != nil {
+		return nil, err
+	}
+	var dialFunc types.MuxDialContextFunc
+	dialFunc = func(ctx context.Context) (types.MuxedSocket, error) {
+		c, err := conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		session, err := Y.Client(c, config)
+		if err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+		return wrapConn(session, dialFunc), nil
+	}
+	return dialFunc, nil
+}
+
+func (i *Implementation) ClientParametersHint() []utils.ParameterHint {
+	return parametersHint
+}
+
+func (i *Implementation) ServerParametersHint() []utils.ParameterHint {
+	return parametersHint
+}